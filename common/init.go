@@ -122,6 +122,26 @@ func initConstantEnv() {
 	constant.GenerateDefaultToken = GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
 	// 是否启用错误日志
 	constant.ErrorLogEnabled = GetEnvOrDefaultBool("ERROR_LOG_ENABLED", false)
+	// 对象存储：local 或 s3（兼容 S3 协议的存储均可）
+	constant.StorageType = GetEnvOrDefaultString("STORAGE_TYPE", "local")
+	constant.StorageLocalDir = GetEnvOrDefaultString("STORAGE_LOCAL_DIR", "./data/storage")
+	constant.StorageS3Endpoint = GetEnvOrDefaultString("STORAGE_S3_ENDPOINT", "")
+	constant.StorageS3Region = GetEnvOrDefaultString("STORAGE_S3_REGION", "us-east-1")
+	constant.StorageS3Bucket = GetEnvOrDefaultString("STORAGE_S3_BUCKET", "")
+	constant.StorageS3AccessKeyId = GetEnvOrDefaultString("STORAGE_S3_ACCESS_KEY_ID", "")
+	constant.StorageS3SecretAccessKey = GetEnvOrDefaultString("STORAGE_S3_SECRET_ACCESS_KEY", "")
+	constant.StorageS3UsePathStyle = GetEnvOrDefaultBool("STORAGE_S3_USE_PATH_STYLE", true)
+	// 设置后访问 /metrics 需要携带 Authorization: Bearer <token>，未设置时需要管理员登录
+	constant.MetricsToken = GetEnvOrDefaultString("METRICS_TOKEN", "")
+	// OpenTelemetry，导出端点使用 OTEL_EXPORTER_OTLP_ENDPOINT 等标准环境变量
+	constant.OtelEnabled = GetEnvOrDefaultBool("OTEL_ENABLED", false)
+	constant.OtelServiceName = GetEnvOrDefaultString("OTEL_SERVICE_NAME", "yunshu-api")
+	constant.OtelSampleRatio = 1
+	if v, err := strconv.ParseFloat(GetEnvOrDefaultString("OTEL_SAMPLE_RATIO", "1"), 64); err == nil && v >= 0 && v <= 1 {
+		constant.OtelSampleRatio = v
+	}
+	// 是否向上游渠道传递 W3C traceparent，可在渠道设置中单独关闭
+	constant.OtelPropagateUpstream = GetEnvOrDefaultBool("OTEL_PROPAGATE_UPSTREAM", true)
 
 	soraPatchStr := GetEnvOrDefaultString("TASK_PRICE_PATCH", "")
 	if soraPatchStr != "" {
@@ -0,0 +1,17 @@
+-- 并发数限制
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 最大并发数
+-- ARGV[2]: 计数过期时间（毫秒），防止进程异常退出后计数无法释放
+-- 返回: {是否允许, 当前并发数}
+
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+
+local current = tonumber(redis.call('GET', key) or '0')
+if current >= limit then
+    return {0, current}
+end
+current = redis.call('INCR', key)
+redis.call('PEXPIRE', key, ttl)
+return {1, current}
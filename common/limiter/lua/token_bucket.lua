@@ -0,0 +1,47 @@
+-- 令牌桶限流器（毫秒精度），支持扣减、强制扣减（允许透支）和仅检查三种模式
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 请求令牌数
+-- ARGV[2]: 桶容量
+-- ARGV[3]: 桶从空到满所需时间（毫秒）
+-- ARGV[4]: 模式 take / force / peek
+-- 返回: {是否允许, 剩余令牌数, 需等待毫秒数, 桶回满毫秒数}
+
+local key = KEYS[1]
+local requested = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local mode = ARGV[4]
+local rate = capacity / period
+
+local now = redis.call('TIME')
+local nowInMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+local bucket = redis.call('HMGET', key, 'tokens', 'last_time')
+local tokens = tonumber(bucket[1])
+local last_time = tonumber(bucket[2])
+
+if not tokens or not last_time then
+    tokens = capacity
+else
+    local elapsed = math.max(0, nowInMillis - last_time)
+    tokens = math.min(capacity, tokens + elapsed * rate)
+end
+
+local allowed = 0
+if tokens >= requested then
+    allowed = 1
+end
+if mode == 'force' or (mode == 'take' and allowed == 1) then
+    tokens = tokens - requested
+end
+
+local retry_after = 0
+if allowed == 0 then
+    retry_after = math.ceil((requested - tokens) / rate)
+end
+local reset_after = math.ceil((capacity - tokens) / rate)
+
+redis.call('HMSET', key, 'tokens', tostring(tokens), 'last_time', nowInMillis)
+redis.call('PEXPIRE', key, reset_after + 1000)
+
+return {allowed, math.floor(math.max(tokens, 0)), retry_after, reset_after}
@@ -0,0 +1,223 @@
+package limiter
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//go:embed lua/token_bucket.lua
+var tokenBucketScriptSource string
+
+//go:embed lua/concurrency.lua
+var concurrencyScriptSource string
+
+var (
+	tokenBucketScript  = redis.NewScript(tokenBucketScriptSource)
+	concurrencyScript  = redis.NewScript(concurrencyScriptSource)
+	concurrencyRelease = redis.NewScript(`
+local current = redis.call('DECR', KEYS[1])
+if current <= 0 then
+    redis.call('DEL', KEYS[1])
+end
+return current`)
+)
+
+// BucketMode 令牌桶的扣减方式
+type BucketMode string
+
+const (
+	// BucketTake 令牌足够时扣减，否则拒绝
+	BucketTake BucketMode = "take"
+	// BucketForce 无论是否足够都扣减，允许透支，用于请求结束后按实际用量扣减
+	BucketForce BucketMode = "force"
+	// BucketPeek 只检查令牌是否足够，不扣减
+	BucketPeek BucketMode = "peek"
+)
+
+// BucketResult 令牌桶检查结果
+type BucketResult struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	RetryAfter time.Duration // 被拒绝时需要等待的时间
+	ResetAfter time.Duration // 桶回满所需时间
+}
+
+// TokenBucket 令牌桶限流器，limit 为一个周期内的容量，period 为桶从空到满所需的时间
+type TokenBucket interface {
+	Take(ctx context.Context, key string, limit int64, period time.Duration, requested int64, mode BucketMode) (*BucketResult, error)
+}
+
+// ConcurrencyLimiter 并发数限制
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context, key string, limit int64) (bool, error)
+	Release(ctx context.Context, key string)
+}
+
+// GetTokenBucket 启用 Redis 时使用 Redis 令牌桶，否则使用内存令牌桶
+func GetTokenBucket() TokenBucket {
+	if common.RedisEnabled {
+		return &redisTokenBucket{client: common.RDB}
+	}
+	return defaultMemoryTokenBucket
+}
+
+// GetConcurrencyLimiter 启用 Redis 时使用 Redis 计数，否则使用内存计数
+func GetConcurrencyLimiter() ConcurrencyLimiter {
+	if common.RedisEnabled {
+		return &redisConcurrencyLimiter{client: common.RDB}
+	}
+	return defaultMemoryConcurrencyLimiter
+}
+
+type redisTokenBucket struct {
+	client *redis.Client
+}
+
+func (b *redisTokenBucket) Take(ctx context.Context, key string, limit int64, period time.Duration, requested int64, mode BucketMode) (*BucketResult, error) {
+	values, err := tokenBucketScript.Run(ctx, b.client, []string{key}, requested, limit, period.Milliseconds(), string(mode)).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("token bucket failed: %w", err)
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("token bucket failed: unexpected result %v", values)
+	}
+	return &BucketResult{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// 并发计数的过期时间，进程异常退出时计数最终会被释放
+const concurrencyKeyTTL = 30 * time.Minute
+
+type redisConcurrencyLimiter struct {
+	client *redis.Client
+}
+
+func (l *redisConcurrencyLimiter) Acquire(ctx context.Context, key string, limit int64) (bool, error) {
+	values, err := concurrencyScript.Run(ctx, l.client, []string{key}, limit, concurrencyKeyTTL.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, fmt.Errorf("concurrency limit failed: %w", err)
+	}
+	return len(values) > 0 && values[0] == 1, nil
+}
+
+func (l *redisConcurrencyLimiter) Release(ctx context.Context, key string) {
+	if err := concurrencyRelease.Run(ctx, l.client, []string{key}).Err(); err != nil {
+		common.SysLog("failed to release concurrency limit: " + err.Error())
+	}
+}
+
+type memoryBucket struct {
+	tokens   float64
+	lastTime time.Time
+	capacity float64
+	rate     float64 // 每毫秒生成的令牌数
+}
+
+type memoryTokenBucket struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	cleanOnce sync.Once
+}
+
+var defaultMemoryTokenBucket = &memoryTokenBucket{buckets: make(map[string]*memoryBucket)}
+
+// NewMemoryTokenBucket 创建仅保存在当前节点内存中的令牌桶
+func NewMemoryTokenBucket() TokenBucket {
+	return &memoryTokenBucket{buckets: make(map[string]*memoryBucket)}
+}
+
+func (b *memoryTokenBucket) Take(_ context.Context, key string, limit int64, period time.Duration, requested int64, mode BucketMode) (*BucketResult, error) {
+	b.cleanOnce.Do(func() {
+		go b.clearExpiredBuckets()
+	})
+	now := time.Now()
+	capacity := float64(limit)
+	rate := capacity / float64(period.Milliseconds())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: capacity}
+		b.buckets[key] = bucket
+	} else {
+		elapsed := float64(now.Sub(bucket.lastTime).Milliseconds())
+		if elapsed > 0 {
+			bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*rate)
+		}
+	}
+	bucket.lastTime = now
+	bucket.capacity = capacity
+	bucket.rate = rate
+
+	allowed := bucket.tokens >= float64(requested)
+	if mode == BucketForce || (mode == BucketTake && allowed) {
+		bucket.tokens -= float64(requested)
+	}
+	result := &BucketResult{
+		Allowed:    allowed,
+		Limit:      limit,
+		Remaining:  int64(math.Max(bucket.tokens, 0)),
+		ResetAfter: time.Duration(math.Ceil((capacity-bucket.tokens)/rate)) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((float64(requested)-bucket.tokens)/rate)) * time.Millisecond
+	}
+	return result, nil
+}
+
+// clearExpiredBuckets 定期删除已回满的令牌桶，回满的桶与不存在的桶等价
+func (b *memoryTokenBucket) clearExpiredBuckets() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now()
+		b.mu.Lock()
+		for key, bucket := range b.buckets {
+			elapsed := float64(now.Sub(bucket.lastTime).Milliseconds())
+			if bucket.tokens+elapsed*bucket.rate >= bucket.capacity {
+				delete(b.buckets, key)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+type memoryConcurrencyLimiter struct {
+	mu      sync.Mutex
+	counter map[string]int64
+}
+
+var defaultMemoryConcurrencyLimiter = &memoryConcurrencyLimiter{counter: make(map[string]int64)}
+
+func (l *memoryConcurrencyLimiter) Acquire(_ context.Context, key string, limit int64) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counter[key] >= limit {
+		return false, nil
+	}
+	l.counter[key]++
+	return true, nil
+}
+
+func (l *memoryConcurrencyLimiter) Release(_ context.Context, key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counter[key]--
+	if l.counter[key] <= 0 {
+		delete(l.counter, key)
+	}
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 基于 Redis 的租约：同一时间只有一个持有者，持有者在过期前续期，节点退出后租约到期由其他节点接管
+
+var (
+	leaseAcquireScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner == ARGV[1] then
+    redis.call('PEXPIRE', KEYS[1], ARGV[2])
+    return 1
+end
+if not owner then
+    redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+    return 1
+end
+return 0`)
+	leaseReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// NodeId 当前进程的唯一标识，用作租约持有者
+var NodeId = GetUUID()
+
+// RedisAcquireLease 获取租约，已由当前节点持有时续期，返回是否持有租约
+func RedisAcquireLease(key string, ttl time.Duration) (bool, error) {
+	result, err := leaseAcquireScript.Run(context.Background(), RDB, []string{key}, NodeId, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// RedisReleaseLease 释放当前节点持有的租约
+func RedisReleaseLease(key string) error {
+	return leaseReleaseScript.Run(context.Background(), RDB, []string{key}, NodeId).Err()
+}
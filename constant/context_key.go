@@ -5,6 +5,8 @@ type ContextKey string
 const (
 	ContextKeyTokenCountMeta ContextKey = "token_count_meta"
 	ContextKeyPromptTokens   ContextKey = "prompt_tokens"
+	// 本次请求实际消耗的 token 总数，记录消费日志时写入
+	ContextKeyUsageTotalTokens ContextKey = "usage_total_tokens"
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
@@ -17,6 +19,10 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenRpmLimit          ContextKey = "token_rpm_limit"
+	ContextKeyTokenTpmLimit          ContextKey = "token_tpm_limit"
+	ContextKeyTokenConcurrencyLimit  ContextKey = "token_concurrency_limit"
+	ContextKeyTokenCallbackUrl       ContextKey = "token_callback_url"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -35,6 +41,10 @@ const (
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
+	// 会话粘性路由命中的绑定，用于继续使用绑定的 key
+	ContextKeySessionAffinityBinding ContextKey = "session_affinity_binding"
+	// 请求的模型没有可用渠道、分发时已降级到备用模型时记录原始请求的模型
+	ContextKeyModelFallbackFrom ContextKey = "model_fallback_from"
 
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
@@ -47,4 +57,10 @@ const (
 	ContextKeyUserName    ContextKey = "username"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
+
+	// 仅由批处理后台任务设置，标记请求来自批处理
+	ContextKeyBatchId ContextKey = "batch_id"
+
+	// 标记本次请求开启了调试抓取
+	ContextKeyPayloadCapture ContextKey = "payload_capture"
 )
@@ -14,5 +14,24 @@ var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
 var ErrorLogEnabled bool
 
+// gateway-owned object storage (uploaded files, batch outputs, etc.)
+var StorageType string
+var StorageLocalDir string
+var StorageS3Endpoint string
+var StorageS3Region string
+var StorageS3Bucket string
+var StorageS3AccessKeyId string
+var StorageS3SecretAccessKey string
+var StorageS3UsePathStyle bool
+
+// Prometheus /metrics 访问令牌，为空时仅允许管理员访问
+var MetricsToken string
+
+// OpenTelemetry 链路追踪
+var OtelEnabled bool
+var OtelServiceName string
+var OtelSampleRatio float64
+var OtelPropagateUpstream bool
+
 // temporary variable for sora patch, will be removed in future
 var TaskPricePatches []string
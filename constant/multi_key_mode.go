@@ -3,6 +3,10 @@ package constant
 type MultiKeyMode string
 
 const (
-	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
-	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	MultiKeyModeRandom             MultiKeyMode = "random"               // 随机
+	MultiKeyModePolling            MultiKeyMode = "polling"              // 轮询
+	MultiKeyModeLeastRecentlyUsed  MultiKeyMode = "least_recently_used"  // 最久未使用
+	MultiKeyModeLeastInFlight      MultiKeyMode = "least_in_flight"      // 进行中请求最少
+	MultiKeyModeMostRemainingQuota MultiKeyMode = "most_remaining_quota" // 每分钟预算剩余比例最高
+	MultiKeyModeStickyUser         MultiKeyMode = "sticky_user"          // 按用户固定 key，保持上游提示词缓存命中
 )
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yunshuAPI/logger"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetArtifact 通过签名地址访问任务转存文件，不需要登录
+func GetArtifact(c *gin.Context) {
+	fileId := c.Param("id")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !service.VerifyArtifactSignature(fileId, expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"message": "Invalid or expired signature",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	file, err := model.GetFileByFileId(fileId)
+	if err != nil || file.IsExpired() || file.Purpose != service.FilePurposeTaskOutput {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "Artifact not found",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	serveStoredFile(c, file)
+}
+
+// serveStoredFile 输出网关存储中的文件内容，本地存储支持 Range 请求
+func serveStoredFile(c *gin.Context, file *model.File) {
+	reader, err := service.OpenFileContent(c.Request.Context(), file)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to read file %s: %s", file.FileId, err.Error()))
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "File content is not available",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	defer reader.Close()
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	if file.ExpiresAt > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", max(file.ExpiresAt-time.Now().Unix(), 0)))
+	}
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, file.Filename, time.Unix(file.CreatedAt, 0), seeker)
+		return
+	}
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to write file %s content: %s", file.FileId, err.Error()))
+	}
+}
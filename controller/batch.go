@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/dto"
+	"yunshuAPI/logger"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+	"yunshuAPI/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 批处理支持的接口及对应的转发格式
+var batchEndpointFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+}
+
+const batchCompletionWindow = "24h"
+
+func optionalInt64(v int64) *int64 {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+func optionalString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func batchToOpenAIBatch(batch *model.Batch) dto.OpenAIBatch {
+	resp := dto.OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalInt64(batch.InProgressAt),
+		ExpiresAt:        optionalInt64(batch.ExpiresAt),
+		FinalizingAt:     optionalInt64(batch.FinalizingAt),
+		CompletedAt:      optionalInt64(batch.CompletedAt),
+		FailedAt:         optionalInt64(batch.FailedAt),
+		ExpiredAt:        optionalInt64(batch.ExpiredAt),
+		CancellingAt:     optionalInt64(batch.CancellingAt),
+		CancelledAt:      optionalInt64(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+		Metadata: batch.Metadata,
+	}
+	if batch.ErrorMessage != "" {
+		resp.Errors = &dto.BatchErrors{
+			Object: "list",
+			Data: []dto.BatchError{{
+				Code:    "batch_failed",
+				Message: batch.ErrorMessage,
+			}},
+		}
+	}
+	return resp
+}
+
+func getBatchOrAbort(c *gin.Context) *model.Batch {
+	batchId := c.Param("id")
+	batch, err := model.GetUserBatchById(c.GetInt("id"), batchId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such Batch object: %s", batchId))
+		} else {
+			respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to query batch")
+		}
+		return nil
+	}
+	return batch
+}
+
+// CreateBatch POST /v1/batches
+func CreateBatch(c *gin.Context) {
+	var req dto.BatchCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if _, ok := batchEndpointFormats[req.Endpoint]; !ok {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid value for 'endpoint': %s", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid value for 'completion_window': %s, only %s is supported", req.CompletionWindow, batchCompletionWindow))
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := service.GetUsableUserFile(userId, req.InputFileId)
+	if err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No such File object: %s", req.InputFileId))
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("File %s must be uploaded with purpose 'batch'", req.InputFileId))
+		return
+	}
+
+	now := time.Now()
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetRandomString(24),
+		UserId:           userId,
+		TokenId:          common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		Endpoint:         req.Endpoint,
+		CompletionWindow: req.CompletionWindow,
+		InputFileId:      inputFile.FileId,
+		Status:           model.BatchStatusValidating,
+		Metadata:         req.Metadata,
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+	}
+	if err := batch.Insert(); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to create batch: %s", err.Error()))
+		respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to create batch")
+		return
+	}
+	c.JSON(http.StatusOK, batchToOpenAIBatch(batch))
+}
+
+// RetrieveBatch GET /v1/batches/:id
+func RetrieveBatch(c *gin.Context) {
+	batch := getBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, batchToOpenAIBatch(batch))
+}
+
+// CancelBatch POST /v1/batches/:id/cancel
+func CancelBatch(c *gin.Context) {
+	batch := getBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	if err := model.CancelBatch(batch); err != nil {
+		respondOpenAIError(c, http.StatusConflict, "invalid_request_error", fmt.Sprintf("Cannot cancel batch with status '%s'", batch.Status))
+		return
+	}
+	c.JSON(http.StatusOK, batchToOpenAIBatch(batch))
+}
+
+// ListBatches GET /v1/batches
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No such Batch object: %s", c.Query("after")))
+		} else {
+			respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to query batches")
+		}
+		return
+	}
+	resp := dto.OpenAIBatchList{
+		Object: "list",
+		Data:   make([]dto.OpenAIBatch, 0, len(batches)),
+	}
+	if len(batches) > limit {
+		resp.HasMore = true
+		batches = batches[:limit]
+	}
+	for _, batch := range batches {
+		resp.Data = append(resp.Data, batchToOpenAIBatch(batch))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
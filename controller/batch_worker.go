@@ -0,0 +1,536 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/dto"
+	"yunshuAPI/middleware"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+	"yunshuAPI/service/storage"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 每处理完一个分片就持久化一次进度
+const batchChunkSize = 100
+
+// 分片结果和进度的保存重试次数
+const batchWriteRetries = 5
+
+type batchContextKey struct{}
+
+var (
+	batchEngine     *gin.Engine
+	batchEngineOnce sync.Once
+
+	runningBatches sync.Map
+)
+
+// getBatchEngine 返回批处理内部使用的路由，复用与在线请求相同的鉴权、分发和转发流程
+func getBatchEngine() *gin.Engine {
+	batchEngineOnce.Do(func() {
+		engine := gin.New()
+		// 单行请求的 panic 只影响该行，返回 500 结果
+		engine.Use(middleware.RelayPanicRecover())
+		markBatchRequest := func(c *gin.Context) {
+			if batchId, ok := c.Request.Context().Value(batchContextKey{}).(string); ok {
+				common.SetContextKey(c, constant.ContextKeyBatchId, batchId)
+			}
+			c.Next()
+		}
+		for endpoint, format := range batchEndpointFormats {
+			relayFormat := format
+			engine.POST(endpoint, middleware.RequestId(), markBatchRequest, middleware.TokenAuth(), middleware.Distribute(), func(c *gin.Context) {
+				Relay(c, relayFormat)
+			})
+		}
+		batchEngine = engine
+	})
+	return batchEngine
+}
+
+// StartBatchWorker 后台执行批处理任务，仅在主节点运行
+func StartBatchWorker() {
+	for {
+		time.Sleep(10 * time.Second)
+		batchSetting := operation_setting.GetBatchSetting()
+		if !batchSetting.Enabled {
+			continue
+		}
+		batches, err := model.GetPendingBatches(100)
+		if err != nil {
+			common.SysLog("failed to query pending batches: " + err.Error())
+			continue
+		}
+		running := 0
+		runningBatches.Range(func(_, _ any) bool {
+			running++
+			return true
+		})
+		for _, batch := range batches {
+			if running >= batchSetting.MaxConcurrentBatches {
+				break
+			}
+			if _, loaded := runningBatches.LoadOrStore(batch.Id, true); loaded {
+				continue
+			}
+			running++
+			go func(batch *model.Batch) {
+				defer runningBatches.Delete(batch.Id)
+				defer func() {
+					if r := recover(); r != nil {
+						common.SysLog(fmt.Sprintf("batch %s panic: %v", batch.BatchId, r))
+					}
+				}()
+				runBatch(batch)
+			}(batch)
+		}
+	}
+}
+
+// failBatch 将批处理置为失败，状态已被其他操作（如取消）修改时放弃，由下一轮按最新状态处理
+func failBatch(batch *model.Batch, message string) {
+	preStatus := batch.Status
+	batch.Status = model.BatchStatusFailed
+	batch.ErrorMessage = message
+	batch.FailedAt = common.GetTimestamp()
+	updated, err := batch.UpdateWithStatus(preStatus, "status", "error_message", "failed_at")
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+	} else if !updated {
+		common.SysLog(fmt.Sprintf("batch %s is no longer %s, skip marking it as failed", batch.BatchId, preStatus))
+	}
+}
+
+// errBatchStopped 批处理被取消或已过期，停止读取输入文件
+var errBatchStopped = errors.New("batch stopped")
+
+// scanBatchInput 逐行读取输入文件，跳过空行，index 为非空行的序号
+func scanBatchInput(batch *model.Batch, fn func(index int, line string) error) error {
+	inputFile, err := service.GetUsableUserFile(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return fmt.Errorf("input file %s is not available", batch.InputFileId)
+	}
+	reader, err := service.OpenFileContent(context.Background(), inputFile)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	index := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := fn(index, line); err != nil {
+			return err
+		}
+		index++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	return nil
+}
+
+// validateBatchInput 校验输入文件，返回请求数和错误说明
+func validateBatchInput(batch *model.Batch) (int, string, error) {
+	maxRequests := operation_setting.GetBatchSetting().MaxRequestsPerBatch
+	customIds := make(map[string]struct{})
+	count := 0
+	message := ""
+	err := scanBatchInput(batch, func(i int, line string) error {
+		count++
+		if maxRequests > 0 && count > maxRequests {
+			message = fmt.Sprintf("input file contains more than %d requests", maxRequests)
+			return errBatchStopped
+		}
+		var req dto.BatchRequestLine
+		if err := common.UnmarshalJsonStr(line, &req); err != nil {
+			message = fmt.Sprintf("line %d: invalid JSON", i+1)
+		} else if req.CustomId == "" {
+			message = fmt.Sprintf("line %d: missing custom_id", i+1)
+		} else if _, ok := customIds[req.CustomId]; ok {
+			message = fmt.Sprintf("line %d: duplicate custom_id %s", i+1, req.CustomId)
+		} else if !strings.EqualFold(req.Method, http.MethodPost) {
+			message = fmt.Sprintf("line %d: method must be POST", i+1)
+		} else if req.Url != batch.Endpoint {
+			message = fmt.Sprintf("line %d: url %s does not match batch endpoint %s", i+1, req.Url, batch.Endpoint)
+		} else if req.Body == nil {
+			message = fmt.Sprintf("line %d: missing body", i+1)
+		}
+		if message != "" {
+			return errBatchStopped
+		}
+		customIds[req.CustomId] = struct{}{}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchStopped) {
+		return 0, "", err
+	}
+	if message == "" && count == 0 {
+		message = "input file is empty"
+	}
+	return count, message, nil
+}
+
+func runBatch(batch *model.Batch) {
+	// 重启前已进入 finalizing 的批处理直接重新合并结果
+	if batch.Status == model.BatchStatusFinalizing {
+		finalizeBatch(batch, model.BatchStatusCompleted)
+		return
+	}
+
+	if batch.Status == model.BatchStatusValidating {
+		count, message, err := validateBatchInput(batch)
+		if err != nil {
+			failBatch(batch, err.Error())
+			return
+		}
+		if message != "" {
+			failBatch(batch, message)
+			return
+		}
+		batch.Status = model.BatchStatusInProgress
+		batch.TotalCount = count
+		batch.InProgressAt = common.GetTimestamp()
+		updated, err := batch.UpdateWithStatus(model.BatchStatusValidating, "status", "total_count", "in_progress_at")
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+			return
+		}
+		if !updated {
+			// 校验期间被取消，下一轮按取消处理
+			return
+		}
+	}
+
+	token, err := model.GetTokenByIds(batch.TokenId, batch.UserId)
+	if err != nil {
+		failBatch(batch, "token used to create the batch is no longer available")
+		return
+	}
+
+	finalStatus := model.BatchStatusCompleted
+	chunk := make([]string, 0, batchChunkSize)
+	runChunk := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		status, err := model.GetBatchStatus(batch.Id)
+		if err == nil && status == model.BatchStatusCancelling {
+			batch.Status = status
+			finalStatus = model.BatchStatusCancelled
+			return errBatchStopped
+		}
+		if batch.ExpiresAt > 0 && common.GetTimestamp() > batch.ExpiresAt {
+			finalStatus = model.BatchStatusExpired
+			return errBatchStopped
+		}
+		results := runBatchChunk(batch, token.Key, chunk)
+		batch.ProcessedLines += len(chunk)
+		chunk = chunk[:0]
+		// 分片内的请求已执行并扣费，结果无法保存时也要记录进度，之后结束批处理而不是重新执行
+		partErr := retryBatchWrite(func() error { return writeBatchPart(batch, results) })
+		saveBatchProgress(batch)
+		if partErr != nil {
+			failBatch(batch, "failed to write batch results: "+partErr.Error())
+			return fmt.Errorf("failed to write part: %w", partErr)
+		}
+		return nil
+	}
+	err = scanBatchInput(batch, func(i int, line string) error {
+		if i < batch.ProcessedLines {
+			return nil
+		}
+		chunk = append(chunk, line)
+		if len(chunk) < batchChunkSize {
+			return nil
+		}
+		return runChunk()
+	})
+	if err == nil {
+		err = runChunk()
+	}
+	if err != nil && !errors.Is(err, errBatchStopped) {
+		common.SysLog(fmt.Sprintf("batch %s: %s", batch.BatchId, err.Error()))
+		return
+	}
+	if status, err := model.GetBatchStatus(batch.Id); err == nil && status == model.BatchStatusCancelling {
+		batch.Status = status
+		finalStatus = model.BatchStatusCancelled
+	}
+	finalizeBatch(batch, finalStatus)
+}
+
+func batchPartKey(batch *model.Batch, part int, kind string) string {
+	return fmt.Sprintf("batches/%s/part-%06d.%s.jsonl", batch.BatchId, part, kind)
+}
+
+// retryBatchWrite 保存已执行分片的结果或进度，失败时按指数退避重试
+func retryBatchWrite(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < batchWriteRetries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		time.Sleep(time.Second << attempt)
+	}
+	return err
+}
+
+// saveBatchProgress 保存已执行的进度，失败时一直重试，进度丢失会导致下一轮重复执行已扣费的请求
+func saveBatchProgress(batch *model.Batch) {
+	for attempt := 0; ; attempt++ {
+		err := model.DB.Model(batch).Select("processed_lines", "part_count", "completed_count", "failed_count").Updates(batch).Error
+		if err == nil {
+			return
+		}
+		common.SysLog(fmt.Sprintf("failed to update progress of batch %s: %s", batch.BatchId, err.Error()))
+		time.Sleep(min(time.Second<<min(attempt, 6), time.Minute))
+	}
+}
+
+// runBatchChunk 并发执行一个分片内的请求，结果按输入顺序返回
+func runBatchChunk(batch *model.Batch, tokenKey string, lines []string) []dto.BatchResponseLine {
+	results := make([]dto.BatchResponseLine, len(lines))
+	workers := operation_setting.GetBatchSetting().WorkersPerBatch
+	if workers <= 0 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, line := range lines {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, line string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysLog(fmt.Sprintf("batch %s line panic: %v", batch.BatchId, r))
+					results[i] = dto.BatchResponseLine{
+						Id:       "batch_req_" + common.GetRandomString(24),
+						CustomId: gjson.Get(line, "custom_id").String(),
+						Error:    &dto.BatchLineError{Code: "internal_error", Message: fmt.Sprintf("%v", r)},
+					}
+				}
+			}()
+			results[i] = executeBatchLine(batch, tokenKey, line)
+		}(i, line)
+	}
+	wg.Wait()
+	return results
+}
+
+// writeBatchPart 将分片结果写入分片文件，成功后才计入完成数和分片数，可重复执行
+func writeBatchPart(batch *model.Batch, results []dto.BatchResponseLine) error {
+	var output, errorOutput bytes.Buffer
+	completed, failed := 0, 0
+	for _, result := range results {
+		data, err := common.Marshal(result)
+		if err != nil {
+			return err
+		}
+		if result.Error == nil && result.Response != nil && result.Response.StatusCode < 300 {
+			output.Write(data)
+			output.WriteByte('\n')
+			completed++
+		} else {
+			errorOutput.Write(data)
+			errorOutput.WriteByte('\n')
+			failed++
+		}
+	}
+
+	store, err := storage.GetStorage()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, batchPartKey(batch, batch.PartCount, "output"), bytes.NewReader(output.Bytes()), int64(output.Len()), "application/jsonl"); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, batchPartKey(batch, batch.PartCount, "error"), bytes.NewReader(errorOutput.Bytes()), int64(errorOutput.Len()), "application/jsonl"); err != nil {
+		return err
+	}
+	batch.PartCount++
+	batch.CompletedCount += completed
+	batch.FailedCount += failed
+	return nil
+}
+
+// executeBatchLine 通过内部路由执行单行请求
+func executeBatchLine(batch *model.Batch, tokenKey string, line string) dto.BatchResponseLine {
+	var req dto.BatchRequestLine
+	result := dto.BatchResponseLine{Id: "batch_req_" + common.GetRandomString(24)}
+	if err := common.UnmarshalJsonStr(line, &req); err != nil {
+		result.Error = &dto.BatchLineError{Code: "invalid_json_line", Message: err.Error()}
+		return result
+	}
+	result.CustomId = req.CustomId
+
+	// 批处理不支持流式输出
+	delete(req.Body, "stream")
+	delete(req.Body, "stream_options")
+	body, err := common.Marshal(req.Body)
+	if err != nil {
+		result.Error = &dto.BatchLineError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+
+	ctx := context.WithValue(context.Background(), batchContextKey{}, batch.BatchId)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, batch.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		result.Error = &dto.BatchLineError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+
+	recorder := httptest.NewRecorder()
+	getBatchEngine().ServeHTTP(recorder, httpReq)
+
+	var respBody any
+	if err := common.Unmarshal(recorder.Body.Bytes(), &respBody); err != nil {
+		respBody = recorder.Body.String()
+	}
+	result.Response = &dto.BatchResponseBody{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       respBody,
+	}
+	return result
+}
+
+// concatBatchParts 合并分片文件，分片在批处理最终状态保存后才删除，便于中断后重新合并
+func concatBatchParts(batch *model.Batch, kind string) ([]byte, error) {
+	store, err := storage.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	var buf bytes.Buffer
+	for part := 0; part < batch.PartCount; part++ {
+		reader, err := store.Get(ctx, batchPartKey(batch, part, kind))
+		if err != nil {
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		_, err = buf.ReadFrom(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func deleteBatchParts(batch *model.Batch) {
+	store, err := storage.GetStorage()
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	for part := 0; part < batch.PartCount; part++ {
+		_ = store.Delete(ctx, batchPartKey(batch, part, "output"))
+		_ = store.Delete(ctx, batchPartKey(batch, part, "error"))
+	}
+}
+
+// storeBatchResultFile 合并分片并保存为结果文件，已保存过的结果文件不再重复生成
+func storeBatchResultFile(batch *model.Batch, kind string, fileId *string) error {
+	if *fileId != "" {
+		return nil
+	}
+	content, err := concatBatchParts(batch, kind)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	file, err := service.StoreFile(context.Background(), service.StoreFileParams{
+		UserId:      batch.UserId,
+		TokenId:     batch.TokenId,
+		Filename:    fmt.Sprintf("%s_%s.jsonl", batch.BatchId, kind),
+		Purpose:     "batch_output",
+		ContentType: "application/jsonl",
+		Size:        int64(len(content)),
+		Reader:      bytes.NewReader(content),
+	})
+	if err != nil {
+		return err
+	}
+	*fileId = file.FileId
+	return model.DB.Model(batch).Select("output_file_id", "error_file_id").Updates(batch).Error
+}
+
+// finalizeBatch 生成结果文件并保存最终状态，可重复执行
+func finalizeBatch(batch *model.Batch, finalStatus string) {
+	if batch.FinalizingAt == 0 {
+		batch.FinalizingAt = common.GetTimestamp()
+	}
+	if finalStatus == model.BatchStatusCompleted && batch.Status != model.BatchStatusFinalizing {
+		preStatus := batch.Status
+		batch.Status = model.BatchStatusFinalizing
+		updated, err := batch.UpdateWithStatus(preStatus, "status", "finalizing_at")
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+			return
+		}
+		if !updated {
+			// 处理完最后一个分片后被取消，下一轮按取消处理
+			return
+		}
+	}
+
+	if err := storeBatchResultFile(batch, "output", &batch.OutputFileId); err != nil {
+		failBatch(batch, "failed to write output file: "+err.Error())
+		return
+	}
+	if err := storeBatchResultFile(batch, "error", &batch.ErrorFileId); err != nil {
+		failBatch(batch, "failed to write error file: "+err.Error())
+		return
+	}
+
+	now := common.GetTimestamp()
+	preStatus := batch.Status
+	batch.Status = finalStatus
+	switch finalStatus {
+	case model.BatchStatusCompleted:
+		batch.CompletedAt = now
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+	}
+	updated, err := batch.UpdateWithStatus(preStatus, "status", "finalizing_at", "completed_at", "cancelled_at", "expired_at")
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+		return
+	}
+	if !updated {
+		// 状态已变化时保留分片，下一轮按最新状态重新合并
+		return
+	}
+	deleteBatchParts(batch)
+}
@@ -60,6 +60,18 @@ func clearChannelInfo(channel *model.Channel) {
 		channel.ChannelInfo.MultiKeyDisabledReason = nil
 		channel.ChannelInfo.MultiKeyDisabledTime = nil
 	}
+	channel.Health = model.GetChannelHealthInfo(channel.Id)
+}
+
+// ResetChannelHealth 清空渠道健康统计并关闭熔断
+func ResetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.ResetChannelHealth(id)
+	common.ApiSuccess(c, nil)
 }
 
 func GetAllChannels(c *gin.Context) {
@@ -1131,6 +1143,8 @@ type KeyStatus struct {
 	DisabledTime int64  `json:"disabled_time,omitempty"`
 	Reason       string `json:"reason,omitempty"`
 	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+	// 当前节点上该 key 的使用计数
+	Usage *model.ChannelKeyUsageInfo `json:"usage,omitempty"`
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1224,6 +1238,7 @@ func ManageMultiKeys(c *gin.Context) {
 				DisabledTime: disabledTime,
 				Reason:       reason,
 				KeyPreview:   keyPreview,
+				Usage:        model.GetChannelKeyUsageInfo(channel.Id, i),
 			})
 		}
 
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// 自动禁用渠道（及多 key 渠道中被禁用的 key）的恢复探测，探测失败后按指数退避延长间隔
+
+type recoveryTarget struct {
+	channelId int
+	keyIndex  int // 单 key 渠道为 -1
+}
+
+type recoveryState struct {
+	disabledAt  int64
+	attempts    int
+	nextProbeAt time.Time
+}
+
+var (
+	recoveryStates     = make(map[recoveryTarget]*recoveryState)
+	recoveryStatesLock sync.Mutex
+)
+
+func recoveryBackoff(attempts int) time.Duration {
+	setting := operation_setting.GetChannelRecoverySetting()
+	initial := float64(setting.InitialIntervalSeconds)
+	if initial <= 0 {
+		initial = 60
+	}
+	multiplier := setting.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	seconds := initial * math.Pow(multiplier, float64(attempts))
+	if setting.MaxIntervalSeconds > 0 && seconds > float64(setting.MaxIntervalSeconds) {
+		seconds = float64(setting.MaxIntervalSeconds)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func channelDisabledTime(channel *model.Channel) int64 {
+	if statusTime, ok := channel.GetOtherInfo()["status_time"].(float64); ok {
+		return int64(statusTime)
+	}
+	return 0
+}
+
+// collectRecoveryTargets 返回所有需要探测的渠道和 key 及其禁用时间
+func collectRecoveryTargets(channels []*model.Channel) map[recoveryTarget]int64 {
+	targets := make(map[recoveryTarget]int64)
+	for _, channel := range channels {
+		if lo.Contains(unsupportedTestChannelTypes, channel.Type) {
+			continue
+		}
+		if channel.ChannelInfo.IsMultiKey {
+			// 手动禁用的渠道不做探测
+			if channel.Status == common.ChannelStatusManuallyDisabled {
+				continue
+			}
+			for keyIndex, status := range channel.ChannelInfo.MultiKeyStatusList {
+				if status != common.ChannelStatusAutoDisabled {
+					continue
+				}
+				targets[recoveryTarget{channel.Id, keyIndex}] = channel.ChannelInfo.MultiKeyDisabledTime[keyIndex]
+			}
+			continue
+		}
+		if channel.Status == common.ChannelStatusAutoDisabled {
+			targets[recoveryTarget{channel.Id, -1}] = channelDisabledTime(channel)
+		}
+	}
+	return targets
+}
+
+// probeChannel 使用渠道的测试模型探测渠道或指定 key，返回探测使用的 key
+func probeChannel(channel *model.Channel, keyIndex int) (string, testResult) {
+	probe := *channel
+	if keyIndex >= 0 {
+		keys := channel.GetKeys()
+		if keyIndex >= len(keys) {
+			return "", testResult{localErr: fmt.Errorf("key index %d out of range", keyIndex)}
+		}
+		// 以单 key 渠道的方式探测指定 key，绕过多 key 的启用状态筛选
+		probe.Key = keys[keyIndex]
+		probe.Keys = nil
+		probe.ChannelInfo.IsMultiKey = false
+	}
+	return probe.Key, testChannel(&probe, "", channel.GetOtherSettings().TestEndpointType)
+}
+
+func recoverDisabledChannels() {
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		common.SysLog("failed to get channels for recovery: " + err.Error())
+		return
+	}
+	channelMap := make(map[int]*model.Channel, len(channels))
+	for _, channel := range channels {
+		channelMap[channel.Id] = channel
+	}
+	targets := collectRecoveryTargets(channels)
+
+	now := time.Now()
+	var due []recoveryTarget
+	recoveryStatesLock.Lock()
+	for target := range recoveryStates {
+		if _, ok := targets[target]; !ok {
+			delete(recoveryStates, target)
+		}
+	}
+	for target, disabledAt := range targets {
+		state := recoveryStates[target]
+		// 新禁用或再次被禁用时重新开始退避
+		if state == nil || state.disabledAt != disabledAt {
+			start := now
+			if disabledAt > 0 {
+				start = time.Unix(disabledAt, 0)
+			}
+			state = &recoveryState{disabledAt: disabledAt, nextProbeAt: start.Add(recoveryBackoff(0))}
+			recoveryStates[target] = state
+		}
+		if !now.Before(state.nextProbeAt) {
+			due = append(due, target)
+		}
+	}
+	recoveryStatesLock.Unlock()
+
+	for _, target := range due {
+		channel := channelMap[target.channelId]
+		tik := time.Now()
+		usingKey, result := probeChannel(channel, target.keyIndex)
+		milliseconds := time.Since(tik).Milliseconds()
+		success := result.localErr == nil && result.newAPIError == nil
+
+		recoveryStatesLock.Lock()
+		state := recoveryStates[target]
+		state.attempts++
+		attempt := state.attempts
+		state.nextProbeAt = time.Now().Add(recoveryBackoff(state.attempts))
+		recoveryStatesLock.Unlock()
+
+		probe := &model.ChannelProbe{
+			ChannelId:    target.channelId,
+			KeyIndex:     target.keyIndex,
+			Attempt:      attempt,
+			Success:      success,
+			ResponseTime: milliseconds,
+		}
+		if success {
+			service.EnableChannel(channel.Id, usingKey, channel.Name)
+			channel.UpdateResponseTime(milliseconds)
+			probe.Recovered = true
+			recoveryStatesLock.Lock()
+			delete(recoveryStates, target)
+			recoveryStatesLock.Unlock()
+		} else if result.newAPIError != nil {
+			probe.Message = result.newAPIError.Error()
+		} else {
+			probe.Message = result.localErr.Error()
+		}
+		model.RecordChannelProbe(probe)
+		time.Sleep(common.RequestInterval)
+	}
+}
+
+var autoRecoverChannelsOnce sync.Once
+
+// AutomaticallyRecoverChannels 定时探测自动禁用的渠道和 key，成功后重新启用
+func AutomaticallyRecoverChannels() {
+	// 只在Master节点探测
+	if !common.IsMasterNode {
+		return
+	}
+	autoRecoverChannelsOnce.Do(func() {
+		lastCleanup := time.Time{}
+		for {
+			setting := operation_setting.GetChannelRecoverySetting()
+			interval := time.Duration(setting.ScanIntervalSeconds) * time.Second
+			if interval < 5*time.Second {
+				interval = 5 * time.Second
+			}
+			if setting.Enabled {
+				recoverDisabledChannels()
+			}
+			if time.Since(lastCleanup) > 24*time.Hour && setting.HistoryRetentionDays > 0 {
+				if _, err := model.DeleteChannelProbesBefore(time.Now().AddDate(0, 0, -setting.HistoryRetentionDays)); err != nil {
+					common.SysLog("failed to cleanup channel probes: " + err.Error())
+				}
+				lastCleanup = time.Now()
+			}
+			time.Sleep(interval)
+		}
+	})
+}
+
+// GetChannelProbes 返回渠道最近的恢复探测记录及各 key 的下次探测时间
+func GetChannelProbes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	probes, err := model.GetChannelProbes(id, limit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	nextProbeAt := make(map[int]int64)
+	recoveryStatesLock.Lock()
+	for target, state := range recoveryStates {
+		if target.channelId == id {
+			nextProbeAt[target.keyIndex] = state.nextProbeAt.Unix()
+		}
+	}
+	recoveryStatesLock.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"probes":        probes,
+			"next_probe_at": nextProbeAt,
+		},
+	})
+}
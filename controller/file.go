@@ -11,6 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -38,47 +41,7 @@ func UploadFile(c *gin.Context) {
 			}
 		}
 
-		// 生成唯一文件名
-		filename := generateUniqueFilename() + ext
-		fullPath := filepath.Join("./files", filename)
-
-		// 创建目录（如果不存在）
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			log.Printf("创建目录失败: %v", err)
-			c.JSON(http.StatusOK, gin.H{
-				"message": "创建目录失败",
-				"success": false,
-			})
-			return
-		}
-
-		// 保存文件
-		outFile, err := os.Create(fullPath)
-		if err != nil {
-			log.Printf("创建文件失败: %v", err)
-			c.JSON(http.StatusOK, gin.H{
-				"message": "创建文件失败",
-				"success": false,
-			})
-			return
-		}
-		defer outFile.Close()
-
-		if _, err = io.Copy(outFile, file); err != nil {
-			log.Printf("保存文件失败: %v", err)
-			c.JSON(http.StatusOK, gin.H{
-				"message": "保存文件失败",
-				"success": false,
-			})
-			return
-		}
-
-		// 返回成功信息
-		c.JSON(http.StatusOK, gin.H{
-			"file_url": "/file/" + filename,
-			"filename": filename,
-			"success":  true,
-		})
+		saveUploadedFile(c, file, header.Size, ext, header.Header.Get("Content-Type"))
 		return
 	}
 
@@ -212,54 +175,45 @@ func UploadFile(c *gin.Context) {
 			}
 		}
 
-		// 生成唯一文件�?
-		filename := generateUniqueFilename() + ext
-		fullPath := filepath.Join("./files", filename)
-
-		// 创建目录（如果不存在�?
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			log.Printf("创建目录失败: %v", err)
-			c.JSON(http.StatusOK, gin.H{
-				"message": "创建目录失败",
-				"success": false,
-			})
-			return
-		}
-
-		// 保存文件
-		outFile, err := os.Create(fullPath)
-		if err != nil {
-			log.Printf("创建文件失败: %v", err)
-			c.JSON(http.StatusOK, gin.H{
-				"message": "创建文件失败",
-				"success": false,
-			})
-			return
-		}
-		defer outFile.Close()
+		saveUploadedFile(c, resp.Body, resp.ContentLength, ext, resp.Header.Get("Content-Type"))
+		return
+	}
 
-		if _, err = io.Copy(outFile, resp.Body); err != nil {
-			log.Printf("保存文件失败: %v", err)
-			c.JSON(http.StatusOK, gin.H{
-				"message": "保存文件失败",
-				"success": false,
-			})
-			return
-		}
+	// 两种方式都失败
+	c.JSON(http.StatusOK, gin.H{
+		"message": "获取文件失败，请检查请求格式",
+		"success": false,
+	})
+}
 
-		// 返回成功信息
+// saveUploadedFile 将上传或下载的文件写入网关存储，按 artifact_setting 中的保留时间自动清理
+func saveUploadedFile(c *gin.Context, reader io.Reader, size int64, ext string, contentType string) {
+	if contentType == "" || strings.HasPrefix(contentType, "application/octet-stream") {
+		contentType = getContentTypeFromExtension(strings.ToLower(ext))
+	}
+	file, err := service.StoreFile(c.Request.Context(), service.StoreFileParams{
+		Filename:    generateUniqueFilename() + ext,
+		Purpose:     service.FilePurposeUpload,
+		ContentType: contentType,
+		Size:        size,
+		Reader:      reader,
+		ExpiresAt:   service.UploadExpiresAt(),
+	})
+	if err != nil {
+		log.Printf("保存文件失败: %v", err)
 		c.JSON(http.StatusOK, gin.H{
-			"file_url": "/file/" + filename,
-			"filename": filename,
-			"success":  true,
+			"message": "保存文件失败",
+			"success": false,
 		})
 		return
 	}
 
-	// 两种方式都失败
+	// 返回成功信息
+	filename := file.FileId + ext
 	c.JSON(http.StatusOK, gin.H{
-		"message": "获取文件失败，请检查请求格式",
-		"success": false,
+		"file_url": "/file/" + filename,
+		"filename": filename,
+		"success":  true,
 	})
 }
 
@@ -283,6 +237,20 @@ func GetFile(c *gin.Context) {
 		return
 	}
 
+	// 上传文件保存在网关存储中，文件名为 file id 加扩展名
+	if file, err := model.GetFileByFileId(strings.TrimSuffix(filename, filepath.Ext(filename))); err == nil {
+		if file.Purpose != service.FilePurposeUpload || file.IsExpired() {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "文件不存在",
+				"success": false,
+			})
+			return
+		}
+		serveStoredFile(c, file)
+		return
+	}
+
+	// 兼容改版前直接写入本地目录的文件
 	fullPath := filepath.Join("./files", filename)
 
 	// 检查文件是否存�?
@@ -366,50 +334,3 @@ func getContentTypeFromExtension(ext string) string {
 	}
 	return contentType
 }
-
-// CleanupExpiredFiles 定时清理过期文件
-func CleanupExpiredFiles() {
-	// 每天执行一次清�?
-	cleanupInterval := 24 * time.Hour
-	// 文件有效期为1�?
-	fileLifetime := 24 * time.Hour
-
-	for {
-		log.Println("开始清理过期文�?..")
-		filesDir := "./files"
-
-		// 遍历files目录
-		err := filepath.Walk(filesDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				log.Printf("遍历文件失败: %v", err)
-				return nil
-			}
-
-			// 跳过目录
-			if info.IsDir() {
-				return nil
-			}
-
-			// 检查文件是否过�?
-			if time.Since(info.ModTime()) > fileLifetime {
-				// 删除过期文件
-				if err := os.Remove(path); err != nil {
-					log.Printf("删除过期文件失败 %s: %v", path, err)
-				} else {
-					log.Printf("已删除过期文�? %s", path)
-				}
-			}
-
-			return nil
-		})
-
-		if err != nil {
-			log.Printf("清理过期文件时发生错�? %v", err)
-		}
-
-		log.Println("过期文件清理完成")
-
-		// 等待下一次清�?
-		time.Sleep(cleanupInterval)
-	}
-}
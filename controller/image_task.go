@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"yunshuAPI/constant"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetrieveImageTask GET /v1/images/generations/:task_id
+// 查询同步图片接口未等到结果时返回的任务，结果由后台任务轮询更新
+func RetrieveImageTask(c *gin.Context) {
+	taskId := c.Param("task_id")
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), taskId)
+	if err != nil {
+		respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to query task")
+		return
+	}
+	if !exist || task.Action != constant.TaskActionImageGenerate {
+		respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such image task: %s", taskId))
+		return
+	}
+	c.JSON(http.StatusOK, service.ImageTaskResponse(task))
+}
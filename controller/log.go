@@ -167,3 +167,24 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetPayloadCapture 管理员按请求 ID 查看调试抓取的请求和响应内容
+func GetPayloadCapture(c *gin.Context) {
+	capture, err := model.GetPayloadCaptureByRequestId(c.Param("request_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if capture == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "抓取内容不存在或已过期",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    capture,
+	})
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"os"
+
+	"yunshuAPI/common"
+	"yunshuAPI/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunLogRetention 管理员手动按保留策略执行一次日志清理
+func RunLogRetention(c *gin.Context) {
+	results, err := service.RunLogRetention(c.Request.Context())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    results,
+	})
+}
+
+func GetLogArchives(c *gin.Context) {
+	files, err := service.ListLogArchives()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    files,
+	})
+}
+
+func DownloadLogArchive(c *gin.Context) {
+	name := c.Param("name")
+	f, err := service.OpenLogArchive(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "归档文件不存在",
+			})
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	defer f.Close()
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", "attachment; filename="+name)
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, f)
+}
+
+type importLogArchiveRequest struct {
+	Name string `json:"name"`
+}
+
+// ImportLogArchive 将归档文件重新导入日志表，用于审计
+func ImportLogArchive(c *gin.Context) {
+	var req importLogArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	count, err := service.ImportLogArchive(req.Name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
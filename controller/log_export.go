@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const logExportBatchSize = 1000
+
+var logExportCsvHeader = []string{"id", "created_at", "type", "username", "token_name", "model_name", "quota",
+	"prompt_tokens", "completion_tokens", "use_time", "is_stream", "channel", "channel_name", "group", "ip", "content", "other"}
+
+func logExportCsvRow(log *model.Log) []string {
+	return []string{
+		strconv.Itoa(log.Id),
+		time.Unix(log.CreatedAt, 0).Format(time.RFC3339),
+		strconv.Itoa(log.Type),
+		log.Username,
+		log.TokenName,
+		log.ModelName,
+		strconv.Itoa(log.Quota),
+		strconv.Itoa(log.PromptTokens),
+		strconv.Itoa(log.CompletionTokens),
+		strconv.Itoa(log.UseTime),
+		strconv.FormatBool(log.IsStream),
+		strconv.Itoa(log.ChannelId),
+		log.ChannelName,
+		log.Group,
+		log.Ip,
+		log.Content,
+		log.Other,
+	}
+}
+
+func parseLogExportFilter(c *gin.Context) model.LogExportFilter {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	return model.LogExportFilter{
+		LogType:        logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      c.Query("model_name"),
+		Username:       c.Query("username"),
+		TokenName:      c.Query("token_name"),
+		Channel:        channel,
+		Group:          c.Query("group"),
+	}
+}
+
+// streamLogExport 按 format 参数（csv 或 jsonl）分批写出日志，响应头发送后出错只能中断输出
+func streamLogExport(c *gin.Context, filter model.LogExportFilter) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的导出格式，仅支持 csv 和 jsonl",
+		})
+		return
+	}
+	filename := fmt.Sprintf("logs-%s.%s", time.Now().Format("20060102150405"), format)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(c.Writer)
+	if format == "csv" {
+		// 写入 BOM 以便 Excel 正确识别 UTF-8
+		_, _ = c.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
+		_ = csvWriter.Write(logExportCsvHeader)
+	}
+	err := model.ExportLogs(filter, logExportBatchSize, func(logs []*model.Log) error {
+		if err := c.Request.Context().Err(); err != nil {
+			return err
+		}
+		for _, log := range logs {
+			if format == "csv" {
+				if err := csvWriter.Write(logExportCsvRow(log)); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := common.Marshal(log)
+			if err != nil {
+				return err
+			}
+			if _, err = c.Writer.Write(append(data, '\n')); err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		common.SysLog("log export interrupted: " + err.Error())
+	}
+}
+
+// ExportAllLogs 管理员按筛选条件导出全部日志
+func ExportAllLogs(c *gin.Context) {
+	streamLogExport(c, parseLogExportFilter(c))
+}
+
+// ExportUserLogs 用户导出自己的日志
+func ExportUserLogs(c *gin.Context) {
+	filter := parseLogExportFilter(c)
+	filter.UserId = c.GetInt("id")
+	filter.Username = ""
+	filter.Channel = 0
+	streamLogExport(c, filter)
+}
@@ -130,6 +130,7 @@ func UpdateMidjourneyTaskBulk() {
 				if !checkMjTaskNeedUpdate(task, responseItem) {
 					continue
 				}
+				preStatus := task.Status
 				task.Code = 1
 				task.Progress = responseItem.Progress
 				task.PromptEn = responseItem.PromptEn
@@ -176,13 +177,16 @@ func UpdateMidjourneyTaskBulk() {
 				if err != nil {
 					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else {
+					service.FinishMidjourneyTask(task, preStatus)
 					if shouldReturnQuota {
 						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
 						if err != nil {
 							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
+						} else {
+							service.RecordQuotaSpend(task.UserId, task.TokenId, -task.Quota)
 						}
 						logContent := fmt.Sprintf("构图失败 %s，补�?%s", task.MjId, logger.LogQuota(task.Quota))
-						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+						model.RecordRefundLog(task.UserId, task.Quota, logContent)
 					}
 				}
 			}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/dto"
+	"yunshuAPI/logger"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+	"yunshuAPI/service/storage"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func respondOpenAIError(c *gin.Context, statusCode int, errType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: message,
+			Type:    errType,
+		},
+	})
+}
+
+func getOpenAIFileOrAbort(c *gin.Context) *model.File {
+	fileId := c.Param("id")
+	file, err := service.GetUsableUserFile(c.GetInt("id"), fileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", fileId))
+		} else {
+			respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to query file")
+		}
+		return nil
+	}
+	return file
+}
+
+// UploadOpenAIFile POST /v1/files
+func UploadOpenAIFile(c *gin.Context) {
+	fileSetting := operation_setting.GetFileSetting()
+	purpose := c.PostForm("purpose")
+	if purpose == "" {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Missing required parameter: 'purpose'")
+		return
+	}
+	if !fileSetting.IsPurposeAllowed(purpose) {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid value for 'purpose': %s", purpose))
+		return
+	}
+	upload, header, err := c.Request.FormFile("file")
+	if err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "Missing required parameter: 'file'")
+		return
+	}
+	defer upload.Close()
+
+	maxSize := int64(fileSetting.MaxFileSizeMB) << 20
+	if maxSize > 0 && header.Size > maxSize {
+		respondOpenAIError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("File is too large, max size is %d MB", fileSetting.MaxFileSizeMB))
+		return
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(header.Filename)); byExt != "" {
+			contentType = byExt
+		}
+	}
+
+	file, err := service.StoreFile(c.Request.Context(), service.StoreFileParams{
+		UserId:         c.GetInt("id"),
+		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
+		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		Filename:       filepath.Base(header.Filename),
+		Purpose:        purpose,
+		ContentType:    contentType,
+		Size:           header.Size,
+		Reader:         upload,
+		ChargeQuota:    true,
+	})
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to upload file: %s", err.Error()))
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAIFile(file))
+}
+
+// ListOpenAIFiles GET /v1/files
+func ListOpenAIFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	ascending := c.Query("order") == "asc"
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1, ascending)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No such File object: %s", c.Query("after")))
+		} else {
+			respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to query files")
+		}
+		return
+	}
+	resp := dto.OpenAIFileList{
+		Object: "list",
+		Data:   make([]dto.OpenAIFile, 0, len(files)),
+	}
+	if len(files) > limit {
+		resp.HasMore = true
+		files = files[:limit]
+	}
+	for _, file := range files {
+		resp.Data = append(resp.Data, service.FileToOpenAIFile(file))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RetrieveOpenAIFile GET /v1/files/:id
+func RetrieveOpenAIFile(c *gin.Context) {
+	file := getOpenAIFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAIFile(file))
+}
+
+// DeleteOpenAIFile DELETE /v1/files/:id
+func DeleteOpenAIFile(c *gin.Context) {
+	file := getOpenAIFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	if err := service.DeleteStoredFile(c.Request.Context(), file); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to delete file %s: %s", file.FileId, err.Error()))
+		respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to delete file")
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{
+		Id:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+// GetOpenAIFileContent GET /v1/files/:id/content
+func GetOpenAIFileContent(c *gin.Context) {
+	file := getOpenAIFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.OpenFileContent(c.Request.Context(), file)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("Content of file %s is not available", file.FileId))
+		} else {
+			logger.LogError(c, fmt.Sprintf("failed to read file %s: %s", file.FileId, err.Error()))
+			respondOpenAIError(c, http.StatusInternalServerError, "server_error", "Failed to read file content")
+		}
+		return
+	}
+	defer reader.Close()
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to write file %s content: %s", file.FileId, err.Error()))
+	}
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"yunshuAPI/model"
 	"yunshuAPI/service"
 	"yunshuAPI/setting/ratio_setting"
@@ -46,6 +48,7 @@ func GetPricing(c *gin.Context) {
 		"usable_group":       usableGroup,
 		"supported_endpoint": model.GetSupportedEndpointMap(),
 		"auto_groups":        service.GetUserAutoGroup(group),
+		"ratio_schedules":    ratio_setting.GetRatioScheduleStatuses(time.Now()),
 	})
 }
 
@@ -6,12 +6,15 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"yunshuAPI/common"
 	"yunshuAPI/constant"
 	"yunshuAPI/dto"
 	"yunshuAPI/logger"
+	"yunshuAPI/metrics"
 	"yunshuAPI/middleware"
 	"yunshuAPI/model"
 	"yunshuAPI/relay"
@@ -20,12 +23,14 @@ import (
 	"yunshuAPI/relay/helper"
 	"yunshuAPI/service"
 	"yunshuAPI/setting"
+	"yunshuAPI/tracing"
 	"yunshuAPI/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
@@ -72,6 +77,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		ws          *websocket.Conn
 	)
 
+	startTime := time.Now()
+	defer func() {
+		// 在错误响应写入之后执行，记录最终返回的状态码
+		metrics.ObserveRelayRequest(originalModel, group, common.GetContextKeyInt(c, constant.ContextKeyChannelId), c.Writer.Status(), time.Since(startTime))
+	}()
+
 	if relayFormat == types.RelayFormatOpenAIRealtime {
 		var err error
 		ws, err = upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -108,12 +119,27 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	// 将引用网关文件的 file_id 替换为内联内容
+	if err = service.ResolveFileReferences(c, request); err != nil {
+		newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		return
+	}
+
 	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, ws)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
 		return
 	}
 
+	service.StartPayloadCapture(c, relayInfo)
+	defer func() {
+		statusCode := http.StatusOK
+		if newAPIError != nil {
+			statusCode = newAPIError.StatusCode
+		}
+		service.SavePayloadCapture(c, relayInfo, statusCode)
+	}()
+
 	meta := request.GetTokenCountMeta()
 
 	if setting.ShouldCheckPromptSensitive() {
@@ -125,7 +151,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	countSpan, endCountSpan := tracing.StartGinSpan(c, "count_request_token")
 	tokens, err := service.CountRequestToken(c, meta, relayInfo)
+	tracing.RecordError(countSpan, err)
+	endCountSpan()
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
 		return
@@ -133,7 +162,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetPromptTokens(tokens)
 
+	priceSpan, endPriceSpan := tracing.StartGinSpan(c, "model_price")
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+	tracing.RecordError(priceSpan, err)
+	endPriceSpan()
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
 		return
@@ -144,12 +176,20 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
+		preConsumeSpan, endPreConsumeSpan := tracing.StartGinSpan(c, "pre_consume_quota", attribute.Int("quota", priceData.QuotaToPreConsume))
 		newAPIError = service.PreConsumeQuota(c, priceData.QuotaToPreConsume, relayInfo)
+		if newAPIError != nil {
+			tracing.RecordError(preConsumeSpan, newAPIError)
+		}
+		endPreConsumeSpan()
 		if newAPIError != nil {
 			return
 		}
 	}
 
+	// 请求结束后释放消费上限的剩余预留，实际消费在结算时已记录
+	defer service.ReleaseSpendReservation(relayInfo)
+
 	defer func() {
 		// Only return quota if downstream failed and quota was actually pre-consumed
 		if newAPIError != nil && relayInfo.FinalPreConsumedQuota != 0 {
@@ -157,37 +197,91 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			logger.LogError(c, err.Error())
-			newAPIError = err
-			break
-		}
+	cacheSpan, endCacheSpan := tracing.StartGinSpan(c, "response_cache_lookup")
+	cacheLookup, cacheEntry := service.LookupResponseCache(c, relayInfo, fetchResponseCacheEmbedding)
+	cacheSpan.SetAttributes(attribute.Bool("hit", cacheEntry != nil))
+	endCacheSpan()
+	if cacheEntry != nil {
+		serveResponseCache(c, relayInfo, cacheLookup, cacheEntry)
+		return
+	}
+	var cacheWriter *responseCaptureWriter
+	if cacheLookup != nil {
+		cacheWriter = newResponseCaptureWriter(c.Writer)
+		c.Writer = cacheWriter
+	}
 
-		addUsedChannel(c, channel.Id)
-		requestBody, _ := common.GetRequestBody(c)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	// 请求模型在分发时已降级，降级链从请求的模型开始计算
+	requestedModel := originalModel
+	if from := common.GetContextKeyString(c, constant.ContextKeyModelFallbackFrom); from != "" {
+		requestedModel = from
+	}
+	models := append([]string{requestedModel}, service.GetModelFallbackChain(c, group, requestedModel)...)
+	start := slices.Index(models, originalModel)
+	if start < 0 {
+		models, start = []string{originalModel}, 0
+	}
+	if start > 0 {
+		relayInfo.ModelFallbackPath = slices.Clone(models[:start+1])
+	}
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+	for m := start; m < len(models); m++ {
+		currentModel := models[m]
+		if m > start {
+			if !shouldFallbackModel(c, newAPIError) {
+				break
+			}
+			logger.LogWarn(c, fmt.Sprintf("模型 %s 所有渠道均失败，降级到模型 %s", relayInfo.OriginModelName, currentModel))
+			if err := switchFallbackModel(c, relayInfo, currentModel, tokens, meta); err != nil {
+				newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
+				break
+			}
 		}
+		for i := 0; i <= common.RetryTimes; i++ {
+			var channel *model.Channel
+			// 首次尝试使用分发中间件选择的渠道，降级后的模型需要重新选择渠道
+			if m == start {
+				channel, newAPIError = getChannel(c, group, currentModel, i)
+			} else {
+				channel, newAPIError = selectChannel(c, group, currentModel, i)
+			}
+			if newAPIError != nil {
+				logger.LogError(c, newAPIError.Error())
+				break
+			}
 
-		if newAPIError == nil {
-			return
-		}
+			addUsedChannel(c, channel.Id)
+			if i > 0 {
+				metrics.IncRelayRetry(currentModel, group)
+			}
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			if shouldHedgeRequest(c, relayFormat, relayInfo) {
+				newAPIError = relayWithHedge(c, relayFormat, relayInfo, channel, group, currentModel, i)
+			} else {
+				newAPIError = runRelayAttempt(c, relayFormat, relayInfo, channel)
+				if newAPIError != nil {
+					processChannelError(c, newContextChannelError(c, channel), newAPIError)
+				}
+			}
+			if newAPIError == nil {
+				if relayInfo.IsStream && relayInfo.FirstResponseTime.After(relayInfo.StartTime) {
+					metrics.ObserveRelayTTFT(currentModel, group, common.GetContextKeyInt(c, constant.ContextKeyChannelId), relayInfo.FirstResponseTime.Sub(relayInfo.StartTime))
+				}
+				// 降级后的响应不写入请求模型的缓存
+				if cacheWriter != nil && len(relayInfo.ModelFallbackPath) == 0 {
+					if body := cacheWriter.captured(); body != nil {
+						body = bytes.Clone(body)
+						gopool.Go(func() {
+							service.StoreResponseCache(cacheLookup, relayInfo, body)
+						})
+					}
+				}
+				return
+			}
 
-		if !shouldRetry(c, newAPIError, common.RetryTimes-i) {
-			break
+			if !shouldRetry(c, newAPIError, common.RetryTimes-i) {
+				break
+			}
 		}
 	}
 
@@ -211,6 +305,60 @@ func addUsedChannel(c *gin.Context, channelId int) {
 	c.Set("use_channel", useChannel)
 }
 
+// runRelayAttempt 使用当前上下文中的渠道发起一次转发
+func runRelayAttempt(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, channel *model.Channel) *types.NewAPIError {
+	span, endSpan := tracing.StartGinSpan(c, "relay_attempt",
+		attribute.Int("channel_id", channel.Id),
+		attribute.Int("channel_type", common.GetContextKeyInt(c, constant.ContextKeyChannelType)),
+		attribute.Int("hedge_attempt", relayInfo.HedgeAttempt),
+	)
+	defer endSpan()
+	requestBody, _ := common.GetRequestBody(c)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+
+	var newAPIError *types.NewAPIError
+	attemptStart := time.Now()
+	isMultiKey := common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey)
+	keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	requestDone := model.ChannelRequestStarted(channel.Id)
+	keyRequestDone := func() {}
+	if isMultiKey {
+		keyRequestDone = model.ChannelKeyRequestStarted(channel.Id, keyIndex)
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		newAPIError = relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		newAPIError = relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		newAPIError = geminiRelayHandler(c, relayInfo)
+	default:
+		newAPIError = relayHandler(c, relayInfo)
+	}
+	requestDone()
+	keyRequestDone()
+
+	if newAPIError != nil {
+		tracing.RecordError(span, newAPIError)
+		span.SetAttributes(attribute.Int("status_code", newAPIError.StatusCode))
+	}
+	if newAPIError == nil {
+		model.RecordChannelHealth(channel.Id, isMultiKey, keyIndex, true)
+		if isMultiKey {
+			model.RecordChannelKeyTokens(channel.Id, keyIndex, common.GetContextKeyInt(c, constant.ContextKeyUsageTotalTokens), channel.GetOtherSettings().MultiKeyTPMLimit)
+		}
+		if relayFormat != types.RelayFormatOpenAIRealtime {
+			recordChannelLatency(channel.Id, relayInfo, attemptStart)
+		}
+	}
+	return newAPIError
+}
+
+// newContextChannelError 首次尝试的渠道来自 Distribute 中间件，多 key 信息需要从上下文读取
+func newContextChannelError(c *gin.Context, channel *model.Channel) types.ChannelError {
+	return *types.NewChannelError(channel.Id, channel.Type, channel.Name, common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey), common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan())
+}
+
 func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*model.Channel, *types.NewAPIError) {
 	if retryCount == 0 {
 		autoBan := c.GetBool("auto_ban")
@@ -225,6 +373,11 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
+	return selectChannel(c, group, originalModel, retryCount)
+}
+
+// selectChannel 为模型重新选择渠道并写入上下文
+func selectChannel(c *gin.Context, group, originalModel string, retryCount int) (*model.Channel, *types.NewAPIError) {
 	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, group, originalModel, retryCount)
 	if err != nil {
 		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry：%s", selectGroup, originalModel, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
@@ -239,6 +392,17 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 	return channel, nil
 }
 
+// recordChannelLatency 记录本次尝试的延迟：流式请求记录首字延迟，非流式请求记录总耗时
+func recordChannelLatency(channelId int, relayInfo *relaycommon.RelayInfo, attemptStart time.Time) {
+	if !relayInfo.IsStream {
+		model.RecordChannelLatency(channelId, false, time.Since(attemptStart))
+		return
+	}
+	if relayInfo.FirstResponseTime.After(attemptStart) {
+		model.RecordChannelLatency(channelId, true, relayInfo.FirstResponseTime.Sub(attemptStart))
+	}
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -281,10 +445,43 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 	return true
 }
 
+// shouldFallbackModel 当前模型的渠道全部失败或无可用渠道时才降级到下一个模型
+func shouldFallbackModel(c *gin.Context, err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	// 已经向客户端输出了内容，无法再切换模型
+	if c.Writer.Written() {
+		return false
+	}
+	if err.GetErrorCode() == types.ErrorCodeGetChannelFailed {
+		return true
+	}
+	return shouldRetry(c, err, 1)
+}
+
+// switchFallbackModel 切换到降级模型并按该模型重新计算价格，预扣费在结算时按实际模型补差
+func switchFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string, tokens int, meta *types.TokenCountMeta) error {
+	if len(relayInfo.ModelFallbackPath) == 0 {
+		relayInfo.ModelFallbackPath = []string{relayInfo.OriginModelName}
+	}
+	relayInfo.ModelFallbackPath = append(relayInfo.ModelFallbackPath, modelName)
+	relayInfo.OriginModelName = modelName
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, modelName)
+	_, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+	return err
+}
+
 func processChannelError(c *gin.Context, channelError types.ChannelError, err *types.NewAPIError) {
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
+	keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	if service.ShouldCountChannelFailure(err) {
+		model.RecordChannelHealth(channelError.ChannelId, channelError.IsMultiKey, keyIndex, false)
+	} else {
+		model.ReleaseChannelHealthProbe(channelError.ChannelId, channelError.IsMultiKey, keyIndex)
+	}
 	if service.ShouldDisableChannel(channelError.ChannelId, err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.Error())
@@ -316,6 +513,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 			adminInfo["is_multi_key"] = true
 			adminInfo["multi_key_index"] = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
 		}
+		service.AppendPayloadCaptureInfo(c, adminInfo)
 		other["admin_info"] = adminInfo
 		model.RecordErrorLog(c, userId, channelId, modelName, tokenName, err.MaskSensitiveError(), tokenId, 0, false, userGroup, other)
 	}
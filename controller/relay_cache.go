@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/dto"
+	"yunshuAPI/logger"
+	"yunshuAPI/middleware"
+	"yunshuAPI/model"
+	"yunshuAPI/relay"
+	relaycommon "yunshuAPI/relay/common"
+	"yunshuAPI/relay/helper"
+	"yunshuAPI/service"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseCaptureWriter 在写给客户端的同时保存响应内容，用于写入响应缓存
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func newResponseCaptureWriter(w gin.ResponseWriter) *responseCaptureWriter {
+	return &responseCaptureWriter{
+		ResponseWriter: w,
+		limit:          operation_setting.GetResponseCacheSetting().MaxResponseSizeKB << 10,
+	}
+}
+
+func (w *responseCaptureWriter) capture(b []byte) {
+	if w.overflow {
+		return
+	}
+	if w.limit > 0 && w.buf.Len()+len(b) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(b)
+}
+
+func (w *responseCaptureWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// captured 返回完整的成功响应，响应过大或失败时返回 nil
+func (w *responseCaptureWriter) captured() []byte {
+	if w.overflow || w.Status() != http.StatusOK {
+		return nil
+	}
+	return w.buf.Bytes()
+}
+
+// serveResponseCache 返回缓存的响应并按缓存倍率计费
+func serveResponseCache(c *gin.Context, relayInfo *relaycommon.RelayInfo, lookup *service.ResponseCacheLookup, entry *service.ResponseCacheEntry) {
+	relayInfo.ResponseCacheHit = true
+	relayInfo.InitChannelMeta(c)
+	relayInfo.SetFirstResponseTime()
+	helper.ApplyResponseCacheRatio(relayInfo)
+	logger.LogInfo(c, fmt.Sprintf("response cache hit, similarity: %.4f", lookup.Similarity))
+	if err := service.ReplayResponseCache(c, relayInfo, entry); err != nil {
+		logger.LogError(c, "failed to replay cached response: "+err.Error())
+	}
+	usage := entry.Response.Usage
+	relay.PostConsumeCachedResponse(c, relayInfo, &usage)
+}
+
+// fetchResponseCacheEmbedding 调用分组下支持向量模型的渠道计算文本向量。
+// 请求经过渠道适配器转换（支持模型映射、代理及非 OpenAI 渠道），在独立的上下文中执行，
+// 不影响当前请求选中的渠道；该调用属于网关内部开销，不向用户计费
+func fetchResponseCacheEmbedding(c *gin.Context, group string, text string) ([]float32, error) {
+	embeddingModel := operation_setting.GetResponseCacheSetting().EmbeddingModel
+	if embeddingModel == "" {
+		return nil, errors.New("embedding model is not configured")
+	}
+	channel, err := model.GetRandomSatisfiedChannel(group, embeddingModel, 0)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("no available channel for embedding model %s in group %s", embeddingModel, group)
+	}
+
+	request := &dto.EmbeddingRequest{
+		Model: embeddingModel,
+		Input: text,
+	}
+	body, err := common.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	ec, _ := gin.CreateTestContext(recorder)
+	ec.Request, err = http.NewRequestWithContext(c.Request.Context(), http.MethodPost, "/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ec.Request.Header.Set("Content-Type", "application/json")
+	// 复制用户和令牌信息，渠道信息由 SetupContextForSelectedChannel 重新写入
+	for k, v := range c.Keys {
+		ec.Set(k, v)
+	}
+	common.SetContextKey(ec, constant.ContextKeyOriginalModel, embeddingModel)
+	if apiErr := middleware.SetupContextForSelectedChannel(ec, channel, embeddingModel); apiErr != nil {
+		return nil, apiErr
+	}
+	info := relaycommon.GenRelayInfoEmbedding(ec, request)
+	if apiErr := relay.EmbeddingWithoutBilling(ec, info); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var embeddingResponse dto.OpenAIEmbeddingResponse
+	if err := common.Unmarshal(recorder.Body.Bytes(), &embeddingResponse); err != nil {
+		return nil, err
+	}
+	if len(embeddingResponse.Data) == 0 {
+		return nil, errors.New("empty embedding response")
+	}
+	vector := make([]float32, len(embeddingResponse.Data[0].Embedding))
+	for i, v := range embeddingResponse.Data[0].Embedding {
+		vector[i] = float32(v)
+	}
+	return vector, nil
+}
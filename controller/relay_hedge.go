@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"yunshuAPI/logger"
+	"yunshuAPI/middleware"
+	"yunshuAPI/model"
+	relaycommon "yunshuAPI/relay/common"
+	"yunshuAPI/service"
+	"yunshuAPI/setting/operation_setting"
+	"yunshuAPI/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 对冲请求：首个渠道在设定时间内没有返回时，向另一个渠道并行发起相同请求，
+// 先成功的一方返回给客户端并计费，另一方被取消
+
+type hedgeAttempt struct {
+	attempt  int
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+	cancel   context.CancelFunc
+	channel  *model.Channel
+	info     *relaycommon.RelayInfo
+	err      *types.NewAPIError
+}
+
+func shouldHedgeRequest(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) bool {
+	if relayFormat == types.RelayFormatOpenAIRealtime || relayInfo.IsStream {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return operation_setting.GetHedgeSetting().ShouldHedge(relayInfo.OriginModelName)
+}
+
+// newHedgeContext 为每个尝试创建独立的 gin 上下文，响应先写入 recorder，获胜后再复制给客户端
+func newHedgeContext(c *gin.Context) (*gin.Context, *httptest.ResponseRecorder, context.CancelFunc) {
+	recorder := httptest.NewRecorder()
+	hc, _ := gin.CreateTestContext(recorder)
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	hc.Request = c.Request.Clone(ctx)
+	hc.Keys = make(map[string]any, len(c.Keys))
+	for k, v := range c.Keys {
+		hc.Keys[k] = v
+	}
+	return hc, recorder, cancel
+}
+
+func startHedgeAttempt(relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, gate *relaycommon.HedgeGate, attempt *hedgeAttempt, results chan<- *hedgeAttempt) {
+	info := *relayInfo
+	info.HedgeGate = gate
+	info.HedgeAttempt = attempt.attempt
+	attempt.info = &info
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				attempt.err = types.NewError(fmt.Errorf("hedge attempt panic: %v", r), types.ErrorCodeBadResponse)
+			}
+			results <- attempt
+		}()
+		attempt.err = runRelayAttempt(attempt.ctx, relayFormat, attempt.info, attempt.channel)
+	}()
+}
+
+// selectHedgeChannel 选择与首个渠道不同的渠道，没有可用渠道时返回 nil
+func selectHedgeChannel(c *gin.Context, group, originalModel string, retry int, primary *model.Channel) *hedgeAttempt {
+	hc, recorder, cancel := newHedgeContext(c)
+	channel, _, err := service.CacheGetRandomSatisfiedChannel(hc, group, originalModel, retry)
+	if err != nil || channel == nil || channel.Id == primary.Id {
+		cancel()
+		return nil
+	}
+	if newAPIError := middleware.SetupContextForSelectedChannel(hc, channel, originalModel); newAPIError != nil {
+		cancel()
+		return nil
+	}
+	return &hedgeAttempt{
+		attempt:  1,
+		ctx:      hc,
+		recorder: recorder,
+		cancel:   cancel,
+		channel:  channel,
+	}
+}
+
+// writeHedgeResponse 将获胜尝试的响应和上下文写回原请求
+func writeHedgeResponse(c *gin.Context, winner *hedgeAttempt) {
+	for k, v := range winner.ctx.Keys {
+		c.Set(k, v)
+	}
+	for k, v := range winner.recorder.Header() {
+		c.Writer.Header()[k] = v
+	}
+	status := winner.recorder.Code
+	if status == 0 {
+		status = http.StatusOK
+	}
+	c.Writer.WriteHeader(status)
+	if _, err := c.Writer.Write(winner.recorder.Body.Bytes()); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to write hedged response: %s", err.Error()))
+	}
+}
+
+func relayWithHedge(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, channel *model.Channel, group, originalModel string, retry int) *types.NewAPIError {
+	gate := relaycommon.NewHedgeGate()
+	results := make(chan *hedgeAttempt, 2)
+
+	hc, recorder, cancel := newHedgeContext(c)
+	primary := &hedgeAttempt{
+		attempt:  0,
+		ctx:      hc,
+		recorder: recorder,
+		cancel:   cancel,
+		channel:  channel,
+	}
+	attempts := []*hedgeAttempt{primary}
+	startHedgeAttempt(relayFormat, relayInfo, gate, primary, results)
+
+	timer := time.NewTimer(time.Duration(operation_setting.GetHedgeSetting().DelayMs) * time.Millisecond)
+	defer timer.Stop()
+
+	running := 1
+	var lastErr *types.NewAPIError
+	for running > 0 {
+		select {
+		case <-timer.C:
+			secondary := selectHedgeChannel(c, group, originalModel, retry, channel)
+			if secondary == nil {
+				logger.LogDebug(c, "no alternative channel available for hedged request")
+				continue
+			}
+			logger.LogInfo(c, fmt.Sprintf("channel #%d did not respond in %dms, hedging to channel #%d", channel.Id, operation_setting.GetHedgeSetting().DelayMs, secondary.channel.Id))
+			addUsedChannel(c, secondary.channel.Id)
+			attempts = append(attempts, secondary)
+			startHedgeAttempt(relayFormat, relayInfo, gate, secondary, results)
+			running++
+		case result := <-results:
+			running--
+			if result.err == nil {
+				if !gate.Claim(result.attempt) {
+					// 另一方已经计费，丢弃本次结果
+					continue
+				}
+				for _, attempt := range attempts {
+					attempt.cancel()
+				}
+				writeHedgeResponse(c, result)
+				*relayInfo = *result.info
+				relayInfo.HedgeGate = nil
+				return nil
+			}
+			if result.ctx.Request.Context().Err() == nil {
+				processChannelError(result.ctx, newContextChannelError(result.ctx, result.channel), result.err)
+			}
+			result.cancel()
+			lastErr = result.err
+		}
+	}
+	return lastErr
+}
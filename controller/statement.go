@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const statementMonthCount = 12
+
+// renderStatement 按 format 参数输出对账单，支持 json（默认）、csv 和 pdf；未指定月份时返回可查询的月份
+func renderStatement(c *gin.Context, userId int) {
+	month := c.Query("month")
+	if month == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    service.GetStatementMonths(statementMonthCount),
+		})
+		return
+	}
+	statement, err := service.BuildMonthlyStatement(userId, month)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	filename := fmt.Sprintf("statement-%d-%s", userId, month)
+	switch c.DefaultQuery("format", "json") {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		// 写入 BOM 以便 Excel 正确识别 UTF-8
+		_, _ = c.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
+		if err := service.WriteStatementCSV(c.Writer, statement); err != nil {
+			common.SysLog("failed to write statement csv: " + err.Error())
+		}
+	case "pdf":
+		c.Header("Content-Type", "application/pdf")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", filename))
+		if err := service.WriteStatementPDF(c.Writer, statement); err != nil {
+			common.SysLog("failed to write statement pdf: " + err.Error())
+		}
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    statement,
+		})
+	}
+}
+
+// GetSelfStatements 当前用户的月度对账单
+func GetSelfStatements(c *gin.Context) {
+	renderStatement(c, c.GetInt("id"))
+}
+
+// GetUserStatements 管理员查看指定用户的月度对账单
+func GetUserStatements(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权获取同级或更高等级用户的信息",
+		})
+		return
+	}
+	renderStatement(c, id)
+}
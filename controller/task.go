@@ -9,7 +9,7 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
-	"time"
+	"sync"
 
 	"yunshuAPI/common"
 	"yunshuAPI/constant"
@@ -17,80 +17,43 @@ import (
 	"yunshuAPI/logger"
 	"yunshuAPI/model"
 	"yunshuAPI/relay"
+	"yunshuAPI/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
 )
 
-func UpdateTaskBulk() {
-	//revocer
-	//imageModel := "midjourney"
-	for {
-		time.Sleep(time.Duration(15) * time.Second)
-		common.SysLog("任务进度轮询开启")
-		ctx := context.TODO()
-		allTasks := model.GetAllUnFinishSyncTasks(500)
-		platformTask := make(map[constant.TaskPlatform][]*model.Task)
-		for _, t := range allTasks {
-			platformTask[t.Platform] = append(platformTask[t.Platform], t)
-		}
-		for platform, tasks := range platformTask {
-			if len(tasks) == 0 {
-				continue
-			}
-			taskChannelM := make(map[int][]string)
-			taskM := make(map[string]*model.Task)
-			nullTaskIds := make([]int64, 0)
-			for _, task := range tasks {
-				if task.TaskID == "" {
-					// 统计失败的未完成任务
-					nullTaskIds = append(nullTaskIds, task.ID)
-					continue
-				}
-				taskM[task.TaskID] = task
-				taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.TaskID)
-			}
-			if len(nullTaskIds) > 0 {
-				err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
-					"status":   "FAILURE",
-					"progress": "100%",
-				})
-				if err != nil {
-					logger.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
-				} else {
-					logger.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
-				}
-			}
-			if len(taskChannelM) == 0 {
-				continue
-			}
-
-			UpdateTaskByPlatform(platform, taskChannelM, taskM)
-		}
-		common.SysLog("任务进度轮询完成")
-	}
-}
-
-func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
+func UpdateTaskByPlatform(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
 	switch platform {
 	case constant.TaskPlatformMidjourney:
 		//_ = UpdateMidjourneyTaskAll(context.Background(), tasks)
 	case constant.TaskPlatformSuno:
-		_ = UpdateSunoTaskAll(context.Background(), taskChannelM, taskM)
+		_ = UpdateSunoTaskAll(ctx, taskChannelM, taskM)
 	default:
-		if err := UpdateVideoTaskAll(context.Background(), platform, taskChannelM, taskM); err != nil {
+		if err := UpdateVideoTaskAll(ctx, platform, taskChannelM, taskM); err != nil {
 			common.SysLog(fmt.Sprintf("UpdateVideoTaskAll fail: %s", err))
 		}
 	}
 }
 
 func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	var wg sync.WaitGroup
 	for channelId, taskIds := range taskChannelM {
-		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
-		}
+		wg.Add(1)
+		go func(channelId int, taskIds []string) {
+			defer wg.Done()
+			taskPollSlots.acquire(channelId)
+			defer taskPollSlots.release(channelId)
+			if ctx.Err() != nil {
+				return
+			}
+			err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
+			}
+		}(channelId, taskIds)
 	}
+	wg.Wait()
 	return nil
 }
 
@@ -102,13 +65,16 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	channel, err := model.CacheGetChannel(channelId)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("CacheGetChannel: %v", err))
+		failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
 		err = model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if err != nil {
 			common.SysLog(fmt.Sprintf("UpdateMidjourneyTask error2: %v", err))
+		} else {
+			notifyBulkFailedTasks(taskIds, taskM, failReason)
 		}
 		return err
 	}
@@ -150,6 +116,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			continue
 		}
 
+		preStatus := task.Status
 		task.Status = lo.If(model.TaskStatus(responseItem.Status) != "", model.TaskStatus(responseItem.Status)).Else(task.Status)
 		task.FailReason = lo.If(responseItem.FailReason != "", responseItem.FailReason).Else(task.FailReason)
 		task.SubmitTime = lo.If(responseItem.SubmitTime != 0, responseItem.SubmitTime).Else(task.SubmitTime)
@@ -167,9 +134,11 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 					err = model.IncreaseUserQuota(task.UserId, quota, false)
 					if err != nil {
 						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
+					} else {
+						service.RecordQuotaSpend(task.UserId, task.TokenId, -quota)
 					}
 					logContent := fmt.Sprintf("异步任务执行失败 %s，补�?%s", task.TaskID, logger.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+					model.RecordRefundLog(task.UserId, quota, logContent)
 				}
 			}
 		}
@@ -181,11 +150,28 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		err = task.Update()
 		if err != nil {
 			common.SysLog("UpdateMidjourneyTask task error: " + err.Error())
+		} else {
+			service.NotifyTaskFinished(task, preStatus)
 		}
 	}
 	return nil
 }
 
+// notifyBulkFailedTasks 为批量标记为失败的任务投递完成回调
+func notifyBulkFailedTasks(taskIds []string, taskM map[string]*model.Task, failReason string) {
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		if task == nil {
+			continue
+		}
+		preStatus := task.Status
+		task.Status = model.TaskStatusFailure
+		task.Progress = "100%"
+		task.FailReason = failReason
+		service.NotifyTaskFinished(task, preStatus)
+	}
+}
+
 func checkTaskNeedUpdate(oldTask *model.Task, newTask dto.SunoDataResponse) bool {
 
 	if oldTask.SubmitTime != newTask.SubmitTime {
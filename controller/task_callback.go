@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getTaskCallbackDeliveries(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	deliveries, total, err := model.GetTaskCallbackDeliveries(userId, c.Query("task_id"), c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetAllTaskCallbacks 管理员查看所有任务回调的投递记录
+func GetAllTaskCallbacks(c *gin.Context) {
+	getTaskCallbackDeliveries(c, 0)
+}
+
+// GetUserTaskCallbacks 用户查看自己任务回调的投递记录
+func GetUserTaskCallbacks(c *gin.Context) {
+	getTaskCallbackDeliveries(c, c.GetInt("id"))
+}
+
+// RetryTaskCallback 重新投递失败的回调，管理员可以重试任意用户的回调
+func RetryTaskCallback(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	if c.GetInt("role") >= common.RoleAdminUser {
+		userId = 0
+	}
+	delivery, err := model.GetTaskCallbackDeliveryById(id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = service.RetryTaskCallback(delivery); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"yunshuAPI/constant"
+	"yunshuAPI/dto"
+	"yunshuAPI/logger"
+	"yunshuAPI/model"
+	"yunshuAPI/relay"
+	"yunshuAPI/relay/channel"
+	"yunshuAPI/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 取消异步任务：先调用上游取消接口，成功后把任务标记为已取消并退还预扣额度。
+// 只有实现了 channel.TaskCanceler 的平台允许取消
+
+const taskCancelReason = "cancelled by user"
+
+// CancelVideoTask DELETE /v1/videos/:task_id
+func CancelVideoTask(c *gin.Context) {
+	task, taskErr := cancelUserTask(c, c.Param("task_id"))
+	if taskErr != nil {
+		errType := "invalid_request_error"
+		if taskErr.StatusCode >= http.StatusInternalServerError {
+			errType = "server_error"
+		}
+		respondOpenAIError(c, taskErr.StatusCode, errType, taskErr.Message)
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIVideoDeleted{
+		ID:      task.TaskID,
+		Object:  "video.deleted",
+		Deleted: true,
+	})
+}
+
+// CancelTask POST /v1/tasks/:id/cancel
+func CancelTask(c *gin.Context) {
+	task, taskErr := cancelUserTask(c, c.Param("id"))
+	if taskErr != nil {
+		c.JSON(taskErr.StatusCode, taskErr)
+		return
+	}
+	c.JSON(http.StatusOK, dto.TaskResponse[any]{
+		Code: "success",
+		Data: relay.TaskModel2Dto(task),
+	})
+}
+
+func cancelUserTask(c *gin.Context, taskId string) (*model.Task, *dto.TaskError) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), taskId)
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+	}
+	if !exist {
+		return nil, service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusNotFound)
+	}
+	if task.IsFinished() {
+		return nil, service.TaskErrorWrapperLocal(fmt.Errorf("task %s is already finished", taskId), "task_already_finished", http.StatusBadRequest)
+	}
+
+	adaptor := relay.GetTaskAdaptor(task.Platform)
+	canceler, ok := adaptor.(channel.TaskCanceler)
+	if adaptor == nil || !ok {
+		return nil, service.TaskErrorWrapperLocal(fmt.Errorf("platform %s does not support cancelling tasks", task.Platform), "cancel_not_supported", http.StatusBadRequest)
+	}
+	ch, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "get_channel_failed", http.StatusInternalServerError)
+	}
+	baseURL := constant.ChannelBaseURLs[ch.Type]
+	if ch.GetBaseURL() != "" {
+		baseURL = ch.GetBaseURL()
+	}
+	if err := canceler.Cancel(baseURL, ch.Key, task); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to cancel task %s upstream: %s", task.TaskID, err.Error()))
+		return nil, service.TaskErrorWrapper(err, "upstream_cancel_failed", http.StatusBadGateway)
+	}
+
+	preStatus := task.Status
+	cancelled, err := task.Cancel(taskCancelReason)
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "cancel_task_failed", http.StatusInternalServerError)
+	}
+	if !cancelled {
+		// 上游取消期间任务已由轮询更新为完成
+		return nil, service.TaskErrorWrapperLocal(fmt.Errorf("task %s is already finished", taskId), "task_already_finished", http.StatusBadRequest)
+	}
+	logger.LogInfo(c, fmt.Sprintf("Task %s cancelled by user %d", task.TaskID, task.UserId))
+	if task.Quota != 0 {
+		refundTaskQuota(c, task, task.Quota, fmt.Sprintf("Async task cancelled %s, refund %s", task.TaskID, logger.LogQuota(task.Quota)))
+	}
+	service.NotifyTaskFinished(task, preStatus)
+	return task, nil
+}
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/logger"
+	"yunshuAPI/metrics"
+	"yunshuAPI/model"
+	"yunshuAPI/service"
+	"yunshuAPI/setting/operation_setting"
+)
+
+// 异步任务轮询调度：每个平台一轮取出到期的任务，按渠道并发查询上游。
+// 每个任务的下次轮询时间随运行时间增长，超过平台最长运行时间的任务判为失败并退款。
+// 启用 Redis 时各节点通过租约分担平台，未启用时只在主节点运行
+
+const (
+	taskPollLeaseKeyPrefix = "task_poll:lease:"
+	taskPollMinLeaseTTL    = 30 * time.Second
+)
+
+// taskPollLeaseTTL 租约在每轮调度时续期，有效期至少覆盖三轮调度间隔，避免间隔较长时租约在两次续期之间过期
+func taskPollLeaseTTL(interval time.Duration) time.Duration {
+	return max(taskPollMinLeaseTTL, 3*interval)
+}
+
+// taskPollLimiter 限制同时查询上游的请求数，上限读取当前设置
+type taskPollLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	total   int
+	channel map[int]int
+}
+
+var taskPollSlots = newTaskPollLimiter()
+
+func newTaskPollLimiter() *taskPollLimiter {
+	l := &taskPollLimiter{channel: make(map[int]int)}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *taskPollLimiter) acquire(channelId int) {
+	setting := operation_setting.GetTaskPollSetting()
+	l.mu.Lock()
+	for l.total >= max(setting.Concurrency, 1) || l.channel[channelId] >= max(setting.ChannelConcurrency, 1) {
+		l.cond.Wait()
+	}
+	l.total++
+	l.channel[channelId]++
+	l.mu.Unlock()
+}
+
+func (l *taskPollLimiter) release(channelId int) {
+	l.mu.Lock()
+	l.total--
+	if l.channel[channelId]--; l.channel[channelId] <= 0 {
+		delete(l.channel, channelId)
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// UpdateTaskBulk 按最小轮询间隔调度各平台的任务，上一轮未结束的平台跳过本次调度。
+// 每次调度都为仍在轮询的平台续期租约，续期失败时取消该平台本轮尚未开始的查询
+func UpdateTaskBulk() {
+	var mu sync.Mutex
+	running := make(map[constant.TaskPlatform]context.CancelFunc)
+	// 当前节点持有租约的平台，平台没有未完成任务时释放租约
+	leased := make(map[constant.TaskPlatform]bool)
+	for {
+		setting := operation_setting.GetTaskPollSetting()
+		interval := time.Duration(max(setting.MinIntervalSeconds, 1)) * time.Second
+		leaseTTL := taskPollLeaseTTL(interval)
+		counts, err := model.CountUnfinishedTasksByPlatform()
+		if err != nil {
+			common.SysLog("failed to count unfinished tasks: " + err.Error())
+		}
+		queueDepth := make(map[string]int, len(counts))
+		for _, count := range counts {
+			queueDepth[string(count.Platform)] = count.Count
+			if count.Platform == constant.TaskPlatformMidjourney {
+				continue
+			}
+			mu.Lock()
+			_, isRunning := running[count.Platform]
+			mu.Unlock()
+			if isRunning {
+				continue
+			}
+			if !acquireTaskPollLease(count.Platform, leaseTTL) {
+				delete(leased, count.Platform)
+				continue
+			}
+			leased[count.Platform] = true
+			platform := count.Platform
+			ctx, cancel := context.WithCancel(context.Background())
+			mu.Lock()
+			running[platform] = cancel
+			mu.Unlock()
+			go func() {
+				defer func() {
+					cancel()
+					mu.Lock()
+					delete(running, platform)
+					mu.Unlock()
+				}()
+				pollPlatformTasks(ctx, platform)
+			}()
+		}
+		// 平台的未完成任务可能在本轮统计后全部结束，仍需续期正在轮询的平台
+		mu.Lock()
+		for platform, cancel := range running {
+			if acquireTaskPollLease(platform, leaseTTL) {
+				leased[platform] = true
+			} else {
+				delete(leased, platform)
+				cancel()
+			}
+		}
+		if err == nil {
+			for platform := range leased {
+				if _, isRunning := running[platform]; !isRunning && queueDepth[string(platform)] == 0 {
+					releaseTaskPollLease(platform)
+					delete(leased, platform)
+				}
+			}
+		}
+		mu.Unlock()
+		metrics.SetTaskQueueDepth(queueDepth)
+		time.Sleep(interval)
+	}
+}
+
+// acquireTaskPollLease 获取或续期平台的轮询租约，未启用 Redis 时由主节点负责全部平台
+func acquireTaskPollLease(platform constant.TaskPlatform, ttl time.Duration) bool {
+	if !common.RedisEnabled {
+		return common.IsMasterNode
+	}
+	ok, err := common.RedisAcquireLease(taskPollLeaseKeyPrefix+string(platform), ttl)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to acquire task poll lease of platform %s: %s", platform, err.Error()))
+		return false
+	}
+	return ok
+}
+
+// releaseTaskPollLease 平台空闲时释放租约，其他节点可以立即接管
+func releaseTaskPollLease(platform constant.TaskPlatform) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisReleaseLease(taskPollLeaseKeyPrefix + string(platform)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to release task poll lease of platform %s: %s", platform, err.Error()))
+	}
+}
+
+// pollPlatformTasks 轮询平台中到期的任务
+func pollPlatformTasks(ctx context.Context, platform constant.TaskPlatform) {
+	setting := operation_setting.GetTaskPollSetting()
+	now := time.Now().Unix()
+	tasks, err := model.GetDueUnfinishedTasks(platform, now, max(setting.BatchSize, 1))
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to query due tasks of platform %s: %s", platform, err.Error()))
+		return
+	}
+	if len(tasks) == 0 {
+		return
+	}
+
+	maxAge := setting.GetMaxAgeSeconds(string(platform))
+	taskChannelM := make(map[int][]string)
+	taskM := make(map[string]*model.Task)
+	nullTaskIds := make([]int64, 0)
+	nextPollIds := make(map[int64][]int64)
+	for _, task := range tasks {
+		if task.TaskID == "" {
+			// 统计失败的未完成任务
+			nullTaskIds = append(nullTaskIds, task.ID)
+			continue
+		}
+		if maxAge > 0 && task.SubmitTime > 0 && now-task.SubmitTime > maxAge {
+			failTimedOutTask(ctx, task, maxAge)
+			continue
+		}
+		// 先推迟下次轮询时间，查询出错的任务同样按间隔重试；任务保存时也会带上这个时间
+		task.NextPollAt = nextTaskPollAt(task, now, setting)
+		nextPollIds[task.NextPollAt] = append(nextPollIds[task.NextPollAt], task.ID)
+		taskM[task.TaskID] = task
+		taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.TaskID)
+	}
+	if len(nullTaskIds) > 0 {
+		err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+		}
+	}
+	for nextPollAt, ids := range nextPollIds {
+		if err := model.TaskBulkUpdateByID(ids, map[string]any{"next_poll_at": nextPollAt}); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to update next poll time of tasks: %s", err.Error()))
+		}
+	}
+	// 租约已被其他节点接管时不再查询上游
+	if len(taskChannelM) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	UpdateTaskByPlatform(ctx, platform, taskChannelM, taskM)
+}
+
+// nextTaskPollAt 计算下次轮询时间：间隔为已运行时间的 BackoffPercent%，限制在最小和最大间隔之间
+func nextTaskPollAt(task *model.Task, now int64, setting *operation_setting.TaskPollSetting) int64 {
+	minInterval := int64(max(setting.MinIntervalSeconds, 1))
+	maxInterval := max(int64(setting.MaxIntervalSeconds), minInterval)
+	interval := minInterval
+	if task.SubmitTime > 0 && now > task.SubmitTime {
+		interval = (now - task.SubmitTime) * int64(setting.BackoffPercent) / 100
+	}
+	return now + min(max(interval, minInterval), maxInterval)
+}
+
+// failTimedOutTask 超过最长运行时间的任务判为失败并退还预扣额度
+func failTimedOutTask(ctx context.Context, task *model.Task, maxAge int64) {
+	preStatus := task.Status
+	quota := task.Quota
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FinishTime = time.Now().Unix()
+	task.FailReason = fmt.Sprintf("task timed out after %d minutes", maxAge/60)
+	if updated, err := task.UpdateWithStatus(preStatus); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to mark task %s as timed out: %s", task.TaskID, err.Error()))
+		return
+	} else if !updated {
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("Task %s timed out after %d minutes", task.TaskID, maxAge/60))
+	service.FinishTask(task, preStatus)
+	if quota != 0 {
+		refundTaskQuota(ctx, task, quota, fmt.Sprintf("Async task timed out %s, refund %s", task.TaskID, logger.LogQuota(quota)))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"yunshuAPI/common"
@@ -15,15 +16,22 @@ import (
 	"yunshuAPI/relay"
 	"yunshuAPI/relay/channel"
 	relaycommon "yunshuAPI/relay/common"
+	"yunshuAPI/service"
 	"yunshuAPI/setting/ratio_setting"
 )
 
 func UpdateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	var wg sync.WaitGroup
 	for channelId, taskIds := range taskChannelM {
-		if err := updateVideoTaskAll(ctx, platform, channelId, taskIds, taskM); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("Channel #%d failed to update video async tasks: %s", channelId, err.Error()))
-		}
+		wg.Add(1)
+		go func(channelId int, taskIds []string) {
+			defer wg.Done()
+			if err := updateVideoTaskAll(ctx, platform, channelId, taskIds, taskM); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("Channel #%d failed to update video async tasks: %s", channelId, err.Error()))
+			}
+		}(channelId, taskIds)
 	}
+	wg.Wait()
 	return nil
 }
 
@@ -34,13 +42,16 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 	}
 	cacheGetChannel, err := model.CacheGetChannel(channelId)
 	if err != nil {
+		failReason := fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId)
 		errUpdate := model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if errUpdate != nil {
 			common.SysLog(fmt.Sprintf("UpdateVideoTask error: %v", errUpdate))
+		} else {
+			notifyBulkFailedTasks(taskIds, taskM, failReason)
 		}
 		return fmt.Errorf("CacheGetChannel failed: %w", err)
 	}
@@ -53,11 +64,24 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 		ChannelBaseUrl: cacheGetChannel.GetBaseURL(),
 	}
 	adaptor.Init(info)
+	// 同一渠道的任务并发查询，并发数受 task_poll_setting 限制
+	var wg sync.WaitGroup
 	for _, taskId := range taskIds {
-		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
-		}
+		wg.Add(1)
+		go func(taskId string) {
+			defer wg.Done()
+			taskPollSlots.acquire(channelId)
+			defer taskPollSlots.release(channelId)
+			// 轮询租约已失效，剩余任务交给持有租约的节点
+			if ctx.Err() != nil {
+				return
+			}
+			if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
+			}
+		}(taskId)
 	}
+	wg.Wait()
 	return nil
 }
 
@@ -118,6 +142,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 
 	// 记录原本的状态，防止重复退款
 	shouldRefund := false
+	var settleQuota func()
 	quota := task.Quota
 	preStatus := task.Status
 
@@ -186,12 +211,17 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 									logger.LogQuota(preConsumedQuota),
 									taskResult.TotalTokens,
 								))
-								if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("补扣费失败：%s", err.Error()))
-								} else {
+								task.Quota = actualQuota // 更新任务记录的实际扣费金额，与任务状态一起条件写入
+								// 任务状态保存成功后才调整额度，避免与取消、超时或其他节点重复结算
+								settleQuota = func() {
+									if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
+										logger.LogError(ctx, fmt.Sprintf("补扣费失败：%s", err.Error()))
+										restoreTaskQuota(ctx, task, preConsumedQuota)
+										return
+									}
+									service.RecordQuotaSpend(task.UserId, task.TokenId, quotaDelta)
 									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
 									model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
-									task.Quota = actualQuota // 更新任务记录的实际扣费金额
 
 									// 记录消费日志
 									logContent := fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
@@ -209,16 +239,20 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 									logger.LogQuota(preConsumedQuota),
 									taskResult.TotalTokens,
 								))
-								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
-								} else {
-									task.Quota = actualQuota // 更新任务记录的实际扣费额�?
+								task.Quota = actualQuota // 更新任务记录的实际扣费金额，与任务状态一起条件写入
+								settleQuota = func() {
+									if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
+										logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
+										restoreTaskQuota(ctx, task, preConsumedQuota)
+										return
+									}
+									service.RecordQuotaSpend(task.UserId, task.TokenId, -refundQuota)
 
 									// 记录退款日�?
 									logContent := fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣�?%s，退�?%s",
 										modelRatio, finalGroupRatio, taskResult.TotalTokens,
 										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(refundQuota))
-									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+									model.RecordRefundLog(task.UserId, refundQuota, logContent)
 								}
 							} else {
 								// quotaDelta == 0, 预扣费刚好准�?
@@ -253,23 +287,46 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	if taskResult.Progress != "" {
 		task.Progress = taskResult.Progress
 	}
-	if err := task.Update(); err != nil {
+	if updated, err := task.UpdateWithStatus(preStatus); err != nil {
 		common.SysLog("UpdateVideoTask task error: " + err.Error())
 		shouldRefund = false
+	} else if !updated {
+		// 轮询期间任务已被取消，或已由其他节点、超时处理更新，放弃本次结果
+		logger.LogDebug(ctx, fmt.Sprintf("Task %s status changed during polling, skip update", task.TaskID))
+		shouldRefund = false
+	} else {
+		if settleQuota != nil {
+			settleQuota()
+		}
+		service.FinishTask(task, preStatus)
 	}
 
 	if shouldRefund {
-		// 任务失败且之前状态不是失败才退还额度，防止重复退�?
-		if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
-			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
-		}
-		logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota))
-		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+		// 任务失败且之前状态不是失败才退还额度，防止重复退款
+		refundTaskQuota(ctx, task, quota, fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota)))
 	}
 
 	return nil
 }
 
+// restoreTaskQuota 按实际用量调整额度失败时，把任务记录的扣费金额恢复为预扣额度
+func restoreTaskQuota(ctx context.Context, task *model.Task, quota int) {
+	task.Quota = quota
+	if err := model.TaskBulkUpdateByID([]int64{task.ID}, map[string]any{"quota": quota}); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to restore quota of task %s: %s", task.TaskID, err.Error()))
+	}
+}
+
+// refundTaskQuota 退还任务预扣的额度并记录退款日志
+func refundTaskQuota(ctx context.Context, task *model.Task, quota int, logContent string) {
+	if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
+		logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
+	} else {
+		service.RecordQuotaSpend(task.UserId, task.TokenId, -quota)
+	}
+	model.RecordRefundLog(task.UserId, quota, logContent)
+}
+
 func redactVideoResponseBody(body []byte) []byte {
 	var m map[string]any
 	if err := json.Unmarshal(body, &m); err != nil {
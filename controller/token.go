@@ -11,6 +11,22 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// TokenWithSpendLimits 令牌信息附带各窗口消费上限的用量
+type TokenWithSpendLimits struct {
+	*model.Token
+	SpendLimits []model.SpendLimitStatus `json:"spend_limits,omitempty"`
+}
+
+func withSpendLimits(tokens []*model.Token) []TokenWithSpendLimits {
+	result := make([]TokenWithSpendLimits, 0, len(tokens))
+	for _, token := range tokens {
+		item := TokenWithSpendLimits{Token: token}
+		item.SpendLimits, _ = model.GetSpendLimitStatus(model.SpendSubjectToken, token.Id, token.GetSpendLimits())
+		result = append(result, item)
+	}
+	return result
+}
+
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
 	pageInfo := common.GetPageQuery(c)
@@ -21,7 +37,7 @@ func GetAllTokens(c *gin.Context) {
 	}
 	total, _ := model.CountUserTokens(userId)
 	pageInfo.SetTotal(int(total))
-	pageInfo.SetItems(tokens)
+	pageInfo.SetItems(withSpendLimits(tokens))
 	common.ApiSuccess(c, pageInfo)
 	return
 }
@@ -38,7 +54,7 @@ func SearchTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    tokens,
+		"data":    withSpendLimits(tokens),
 	})
 	return
 }
@@ -58,7 +74,7 @@ func GetToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    token,
+		"data":    withSpendLimits([]*model.Token{token})[0],
 	})
 	return
 }
@@ -117,6 +133,7 @@ func GetTokenUsage(c *gin.Context) {
 	if expiredAt == -1 {
 		expiredAt = 0
 	}
+	spendLimits, _ := model.GetSpendLimitStatus(model.SpendSubjectToken, token.Id, token.GetSpendLimits())
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    true,
@@ -131,6 +148,7 @@ func GetTokenUsage(c *gin.Context) {
 			"model_limits":         token.GetModelLimitsMap(),
 			"model_limits_enabled": false,
 			"expires_at":           expiredAt,
+			"spend_limits":         spendLimits,
 		},
 	})
 }
@@ -176,6 +194,13 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		DailyQuotaLimit:    token.DailyQuotaLimit,
+		WeeklyQuotaLimit:   token.WeeklyQuotaLimit,
+		MonthlyQuotaLimit:  token.MonthlyQuotaLimit,
+		RpmLimit:           token.RpmLimit,
+		TpmLimit:           token.TpmLimit,
+		ConcurrencyLimit:   token.ConcurrencyLimit,
+		CallbackUrl:        token.CallbackUrl,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -253,6 +278,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.DailyQuotaLimit = token.DailyQuotaLimit
+		cleanToken.WeeklyQuotaLimit = token.WeeklyQuotaLimit
+		cleanToken.MonthlyQuotaLimit = token.MonthlyQuotaLimit
+		cleanToken.RpmLimit = token.RpmLimit
+		cleanToken.TpmLimit = token.TpmLimit
+		cleanToken.ConcurrencyLimit = token.ConcurrencyLimit
+		cleanToken.CallbackUrl = token.CallbackUrl
 	}
 	err = cleanToken.Update()
 	if err != nil {
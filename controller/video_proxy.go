@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"yunshuAPI/constant"
 	"yunshuAPI/logger"
 	"yunshuAPI/model"
+	"yunshuAPI/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -58,78 +61,17 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
-	channel, err := model.CacheGetChannel(task.ChannelId)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get task %s: not found", taskID))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": "Failed to retrieve channel information",
-				"type":    "server_error",
-			},
-		})
-		return
-	}
-	baseURL := channel.GetBaseURL()
-	if baseURL == "" {
-		baseURL = "https://api.openai.com"
-	}
-
-	var videoURL string
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-	}
-
-	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, "", nil)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create request: %s", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": "Failed to create proxy request",
-				"type":    "server_error",
-			},
-		})
-		return
-	}
-
-	switch channel.Type {
-	case constant.ChannelTypeGemini:
-		apiKey := task.PrivateData.Key
-		if apiKey == "" {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Missing stored API key for Gemini task %s", taskID))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": gin.H{
-					"message": "API key not stored for task",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-
-		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
-		if err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve Gemini video URL for task %s: %s", taskID, err.Error()))
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error": gin.H{
-					"message": "Failed to resolve Gemini video URL",
-					"type":    "server_error",
-				},
-			})
+	if task.PrivateData.ArtifactId != "" {
+		if file, err := model.GetFileByFileId(task.PrivateData.ArtifactId); err == nil && !file.IsExpired() {
+			serveStoredFile(c, file)
 			return
 		}
-		req.Header.Set("x-goog-api-key", apiKey)
-	case constant.ChannelTypeAli:
-		// Video URL is directly in task.FailReason
-		videoURL = task.FailReason
-	default:
-		// Default (Sora, etc.): Use original logic
-		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
 	}
 
-	req.URL, err = url.Parse(videoURL)
+	req, err := newTaskContentRequest(c.Request.Context(), task)
 	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to parse URL %s: %s", videoURL, err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create proxy request for task %s: %s", taskID, err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{
 			"error": gin.H{
 				"message": "Failed to create proxy request",
 				"type":    "server_error",
@@ -137,7 +79,11 @@ func VideoProxy(c *gin.Context) {
 		})
 		return
 	}
+	videoURL := req.URL.String()
 
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to fetch video from %s: %s", videoURL, err.Error()))
@@ -175,3 +121,60 @@ func VideoProxy(c *gin.Context) {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream video content: %s", err.Error()))
 	}
 }
+
+func init() {
+	service.SetTaskContentOpener(openTaskContent)
+}
+
+// newTaskContentRequest 按渠道类型构造获取任务结果内容的上游请求
+func newTaskContentRequest(ctx context.Context, task *model.Task) (*http.Request, error) {
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve channel information: %w", err)
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var videoURL string
+	switch channel.Type {
+	case constant.ChannelTypeGemini:
+		apiKey := task.PrivateData.Key
+		if apiKey == "" {
+			return nil, errors.New("API key not stored for task")
+		}
+		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve Gemini video URL: %w", err)
+		}
+		req.Header.Set("x-goog-api-key", apiKey)
+	case constant.ChannelTypeAli, constant.ChannelTypeSuchuang, constant.ChannelTypeKieai:
+		// Result URL is directly in task.FailReason
+		videoURL = task.FailReason
+	default:
+		// Default (Sora, etc.): Use original logic
+		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
+		req.Header.Set("Authorization", "Bearer "+channel.Key)
+	}
+
+	req.URL, err = url.Parse(videoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL %s: %w", videoURL, err)
+	}
+	return req, nil
+}
+
+// openTaskContent 获取任务结果内容，供转存使用
+func openTaskContent(ctx context.Context, task *model.Task) (*http.Response, error) {
+	req, err := newTaskContentRequest(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetHttpClient().Do(req)
+}
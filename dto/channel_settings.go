@@ -24,13 +24,18 @@ const (
 )
 
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion   string        `json:"azure_responses_version,omitempty"`
+	VertexKeyType           VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise    *bool         `json:"openrouter_enterprise,omitempty"`
+	AllowServiceTier        bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore            bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier   bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType              AwsKeyType    `json:"aws_key_type,omitempty"`
+	UpstreamCostRatio       float64       `json:"upstream_cost_ratio,omitempty"`       // 上游成本系数，用于 lowest_cost 路由策略，未设置按 1 计算
+	DisableTracePropagation bool          `json:"disable_trace_propagation,omitempty"` // 是否禁止向该渠道传递 traceparent
+	TestEndpointType        string        `json:"test_endpoint_type,omitempty"`        // 自动恢复探测使用的端点类型，为空时按测试模型自动判断
+	MultiKeyRPMLimit        int           `json:"multi_key_rpm_limit,omitempty"`       // 多 key 渠道中每个 key 的每分钟请求数预算
+	MultiKeyTPMLimit        int           `json:"multi_key_tpm_limit,omitempty"`       // 多 key 渠道中每个 key 的每分钟 token 数预算
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
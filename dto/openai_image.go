@@ -176,3 +176,14 @@ type ImageData struct {
 	B64Json       string `json:"b64_json"`
 	RevisedPrompt string `json:"revised_prompt"`
 }
+
+// ImageTaskResponse 同步图片接口未等到结果时返回的任务对象，通过 GET /v1/images/generations/:task_id 查询，
+// 任务成功后 data 与 ImageResponse 相同
+type ImageTaskResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Status  string       `json:"status"`
+	Created int64        `json:"created"`
+	Data    []ImageData  `json:"data"`
+	Error   *OpenAIError `json:"error,omitempty"`
+}
@@ -50,3 +50,10 @@ type OpenAIVideoError struct {
 	Message string `json:"message"`
 	Code    string `json:"code"`
 }
+
+// OpenAIVideoDeleted DELETE /v1/videos/{id} 的响应
+type OpenAIVideoDeleted struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -20,6 +21,7 @@ import (
 	"yunshuAPI/router"
 	"yunshuAPI/service"
 	"yunshuAPI/setting/ratio_setting"
+	"yunshuAPI/tracing"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-contrib/sessions"
@@ -53,6 +55,10 @@ func main() {
 		common.SysLog("running in debug mode")
 	}
 
+	defer func() {
+		_ = tracing.Shutdown(context.Background())
+	}()
+
 	defer func() {
 		err := model.CloseDB()
 		if err != nil {
@@ -102,10 +108,15 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	go controller.AutomaticallyRecoverChannels()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
 		})
+	}
+	// 启用 Redis 时各节点通过租约分担异步任务轮询
+	if (common.IsMasterNode || common.RedisEnabled) && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateTaskBulk()
 		})
@@ -125,8 +136,15 @@ func main() {
 	}
 
 	// 启动定时清理过期文件任务
-	go controller.CleanupExpiredFiles()
-	common.SysLog("定时清理过期文件任务已启动")
+	if common.IsMasterNode {
+		go service.CleanupExpiredStoredFiles()
+		go controller.StartBatchWorker()
+		go model.CleanupQuotaSpend()
+		go service.SnapshotUserQuotasMonthly()
+		go service.RunLogRetentionTask()
+		go service.CleanupExpiredPayloadCaptures()
+		go service.RunTaskCallbackWorker()
+	}
 
 	// Initialize HTTP server
 	server := gin.New()
@@ -227,6 +245,10 @@ func InitResources() error {
 
 	logger.SetupLogger()
 
+	if err = tracing.InitTracing(); err != nil {
+		common.SysLog("failed to initialize tracing: " + err.Error())
+	}
+
 	// Initialize model settings
 	ratio_setting.InitRatioSettings()
 
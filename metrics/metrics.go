@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Prometheus 指标，通过 /metrics 暴露
+
+const namespace = "yunshu"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "requests_total",
+		Help:      "Total number of relay requests.",
+	}, []string{"model", "group", "channel", "status_code"})
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "request_duration_seconds",
+		Help:      "Relay request duration in seconds.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "group", "channel", "status_code"})
+
+	relayTTFT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "time_to_first_token_seconds",
+		Help:      "Time to first token of streaming relay requests in seconds.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60},
+	}, []string{"model", "group", "channel"})
+
+	relayTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "tokens_total",
+		Help:      "Total number of billed tokens.",
+	}, []string{"model", "group", "channel", "type"})
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "retries_total",
+		Help:      "Total number of relay retries to another channel.",
+	}, []string{"model", "group"})
+
+	channelAutoDisabled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "auto_disabled_total",
+		Help:      "Total number of channel (or channel key) auto-disable events.",
+	}, []string{"channel"})
+
+	taskQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "task",
+		Name:      "queue_depth",
+		Help:      "Number of unfinished async tasks per platform seen by the last polling round.",
+	}, []string{"platform"})
+
+	quotaPreConsumed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "pre_consumed_total",
+		Help:      "Total quota pre-consumed before relaying.",
+	})
+
+	quotaRefunded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "refunded_total",
+		Help:      "Total pre-consumed quota refunded after failed requests.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayDuration,
+		relayTTFT,
+		relayTokens,
+		relayRetries,
+		channelAutoDisabled,
+		taskQueueDepth,
+		quotaPreConsumed,
+		quotaRefunded,
+	)
+}
+
+func channelLabel(channelId int) string {
+	return strconv.Itoa(channelId)
+}
+
+// ObserveRelayRequest 记录一次转发请求的结果和耗时
+func ObserveRelayRequest(model, group string, channelId int, statusCode int, duration time.Duration) {
+	status := strconv.Itoa(statusCode)
+	channel := channelLabel(channelId)
+	relayRequests.WithLabelValues(model, group, channel, status).Inc()
+	relayDuration.WithLabelValues(model, group, channel, status).Observe(duration.Seconds())
+}
+
+func ObserveRelayTTFT(model, group string, channelId int, ttft time.Duration) {
+	if ttft <= 0 {
+		return
+	}
+	relayTTFT.WithLabelValues(model, group, channelLabel(channelId)).Observe(ttft.Seconds())
+}
+
+func AddRelayTokens(model, group string, channelId int, promptTokens, completionTokens int) {
+	channel := channelLabel(channelId)
+	if promptTokens > 0 {
+		relayTokens.WithLabelValues(model, group, channel, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		relayTokens.WithLabelValues(model, group, channel, "completion").Add(float64(completionTokens))
+	}
+}
+
+func IncRelayRetry(model, group string) {
+	relayRetries.WithLabelValues(model, group).Inc()
+}
+
+func IncChannelAutoDisabled(channelId int) {
+	channelAutoDisabled.WithLabelValues(channelLabel(channelId)).Inc()
+}
+
+// SetTaskQueueDepth 使用本轮轮询的结果覆盖各平台的任务积压数量
+func SetTaskQueueDepth(depth map[string]int) {
+	taskQueueDepth.Reset()
+	for platform, count := range depth {
+		taskQueueDepth.WithLabelValues(platform).Set(float64(count))
+	}
+}
+
+func AddQuotaPreConsumed(quota int) {
+	if quota > 0 {
+		quotaPreConsumed.Add(float64(quota))
+	}
+}
+
+func AddQuotaRefunded(quota int) {
+	if quota > 0 {
+		quotaRefunded.Add(float64(quota))
+	}
+}
+
+// RegisterGaugeFunc 注册由回调函数提供数值的指标，例如当前活跃连接数
+func RegisterGaugeFunc(subsystem, name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
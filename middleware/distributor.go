@@ -15,9 +15,11 @@ import (
 	"yunshuAPI/model"
 	relayconstant "yunshuAPI/relay/constant"
 	"yunshuAPI/service"
+	"yunshuAPI/tracing"
 	"yunshuAPI/types"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -27,7 +29,10 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := tracing.StartGinSpan(c, "distribute")
+		defer endSpan()
 		var channel *model.Channel
+		var affinityKey, selectGroup string
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
@@ -78,7 +83,6 @@ func Distribute() func(c *gin.Context) {
 					return
 				}
 
-				var selectGroup string
 				usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 				// check path is /pg/chat/completions
 				if strings.HasPrefix(c.Request.URL.Path, "/pg/chat/completions") {
@@ -97,7 +101,23 @@ func Distribute() func(c *gin.Context) {
 						common.SetContextKey(c, constant.ContextKeyUsingGroup, usingGroup)
 					}
 				}
-				channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(c, usingGroup, modelRequest.Model, 0)
+				affinityKey = service.GetSessionAffinityKey(c, usingGroup, modelRequest.Model)
+				if affinityKey != "" {
+					channel, selectGroup = getSessionAffinityChannel(c, affinityKey, usingGroup, modelRequest.Model)
+					span.SetAttributes(attribute.Bool("session_affinity_hit", channel != nil))
+				}
+				if channel == nil {
+					channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(c, usingGroup, modelRequest.Model, 0)
+				}
+				if err != nil || channel == nil {
+					if fallbackChannel, fallbackModel, fallbackGroup := getFallbackModelChannel(c, usingGroup, modelRequest.Model); fallbackChannel != nil {
+						common.SetContextKey(c, constant.ContextKeyModelFallbackFrom, modelRequest.Model)
+						modelRequest.Model = fallbackModel
+						channel, selectGroup, err = fallbackChannel, fallbackGroup, nil
+						// 降级后的请求不再绑定会话
+						affinityKey = ""
+					}
+				}
 				if err != nil {
 					showGroup := usingGroup
 					if usingGroup == "auto" {
@@ -120,10 +140,57 @@ func Distribute() func(c *gin.Context) {
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		if channel != nil {
+			span.SetAttributes(attribute.String("model", modelRequest.Model), attribute.Int("channel_id", channel.Id))
+			if affinityKey != "" {
+				service.SetSessionAffinity(affinityKey, service.SessionAffinityBinding{
+					ChannelId: channel.Id,
+					KeyIndex:  common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex),
+					Group:     selectGroup,
+				})
+			}
+		}
+		endSpan()
 		c.Next()
 	}
 }
 
+// getFallbackModelChannel 请求的模型没有可用渠道时，按降级链查找第一个有可用渠道的备用模型
+func getFallbackModelChannel(c *gin.Context, usingGroup string, modelName string) (*model.Channel, string, string) {
+	for _, fallbackModel := range service.GetModelFallbackChain(c, usingGroup, modelName) {
+		channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, usingGroup, fallbackModel, 0)
+		if err == nil && channel != nil {
+			return channel, fallbackModel, selectGroup
+		}
+	}
+	return nil, "", usingGroup
+}
+
+// getSessionAffinityChannel 返回会话绑定且仍可用的渠道及其分组
+func getSessionAffinityChannel(c *gin.Context, affinityKey string, usingGroup string, modelName string) (*model.Channel, string) {
+	binding := service.GetSessionAffinity(affinityKey)
+	if binding == nil {
+		return nil, usingGroup
+	}
+	group := usingGroup
+	if usingGroup == "auto" {
+		userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		if binding.Group == "" || !slices.Contains(service.GetUserAutoGroup(userGroup), binding.Group) {
+			return nil, usingGroup
+		}
+		group = binding.Group
+	}
+	channel := model.GetSessionAffinityChannel(group, modelName, binding.ChannelId)
+	if channel == nil {
+		return nil, usingGroup
+	}
+	if usingGroup == "auto" {
+		c.Set("auto_group", group)
+	}
+	common.SetContextKey(c, constant.ContextKeySessionAffinityBinding, binding)
+	return channel, group
+}
+
 // getModelFromRequest 从请求中读取模型信息
 // 根据 Content-Type 自动处理
 // - application/json
@@ -314,9 +381,20 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
-	if newAPIError != nil {
-		return newAPIError
+	// 会话绑定的 key 仍可用时继续使用，否则按多 key 模式重新选择
+	var key string
+	var index int
+	keySelected := false
+	if binding, ok := common.GetContextKeyType[*service.SessionAffinityBinding](c, constant.ContextKeySessionAffinityBinding); ok && binding.ChannelId == channel.Id {
+		key, keySelected = channel.GetEnabledKeyByIndex(binding.KeyIndex)
+		index = binding.KeyIndex
+	}
+	if !keySelected {
+		var newAPIError *types.NewAPIError
+		key, index, newAPIError = channel.GetNextEnabledKey(strconv.Itoa(c.GetInt("id")))
+		if newAPIError != nil {
+			return newAPIError
+		}
 	}
 	if channel.ChannelInfo.IsMultiKey {
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, true)
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth 配置了 METRICS_TOKEN 时校验 /metrics 的 Bearer 令牌，未配置时仅管理员可以访问
+func MetricsAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if constant.MetricsToken == "" {
+			authHelper(c, common.RoleAdminUser)
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(constant.MetricsToken)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/common/limiter"
+	"yunshuAPI/constant"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 令牌级别的 RPM/TPM/并发限制按令牌计数；模型限制对所有令牌生效，按分组和模型计数
+
+const tokenRateLimitPeriod = time.Minute
+
+type tokenRateLimitRule struct {
+	key         string
+	scope       string
+	rpm         int
+	tpm         int
+	concurrency int
+}
+
+func getTokenRateLimitRules(c *gin.Context) []tokenRateLimitRule {
+	var rules []tokenRateLimitRule
+	if tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId); tokenId != 0 {
+		tokenRule := tokenRateLimitRule{
+			key:         fmt.Sprintf("tokenRateLimit:%d", tokenId),
+			scope:       "令牌",
+			rpm:         common.GetContextKeyInt(c, constant.ContextKeyTokenRpmLimit),
+			tpm:         common.GetContextKeyInt(c, constant.ContextKeyTokenTpmLimit),
+			concurrency: common.GetContextKeyInt(c, constant.ContextKeyTokenConcurrencyLimit),
+		}
+		if tokenRule.rpm > 0 || tokenRule.tpm > 0 || tokenRule.concurrency > 0 {
+			rules = append(rules, tokenRule)
+		}
+	}
+	modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	if modelName != "" {
+		if limit, ok := operation_setting.GetModelRateLimitSetting().GetModelRateLimit(modelName); ok {
+			group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+			rules = append(rules, tokenRateLimitRule{
+				key:         fmt.Sprintf("modelRateLimit:%s:%s", group, modelName),
+				scope:       "模型 " + modelName + " ",
+				rpm:         limit.RPM,
+				tpm:         limit.TPM,
+				concurrency: limit.Concurrency,
+			})
+		}
+	}
+	return rules
+}
+
+// moreRestrictive 返回剩余额度更少的结果，用于响应头
+func moreRestrictive(current *limiter.BucketResult, result *limiter.BucketResult) *limiter.BucketResult {
+	if current == nil || !result.Allowed || (current.Allowed && result.Remaining < current.Remaining) {
+		return result
+	}
+	return current
+}
+
+func formatRateLimitReset(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+func setRateLimitHeaders(c *gin.Context, requestResult *limiter.BucketResult, tokenResult *limiter.BucketResult) {
+	if requestResult != nil {
+		c.Header("x-ratelimit-limit-requests", strconv.FormatInt(requestResult.Limit, 10))
+		c.Header("x-ratelimit-remaining-requests", strconv.FormatInt(requestResult.Remaining, 10))
+		c.Header("x-ratelimit-reset-requests", formatRateLimitReset(requestResult.ResetAfter))
+	}
+	if tokenResult != nil {
+		c.Header("x-ratelimit-limit-tokens", strconv.FormatInt(tokenResult.Limit, 10))
+		c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(tokenResult.Remaining, 10))
+		c.Header("x-ratelimit-reset-tokens", formatRateLimitReset(tokenResult.ResetAfter))
+	}
+}
+
+func abortWithRateLimited(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	abortWithOpenAiMessage(c, http.StatusTooManyRequests, message, "rate_limit_exceeded")
+}
+
+// TokenRateLimit 令牌及模型的 RPM/TPM/并发限流中间件，需要在 Distribute 之后使用以获取模型名称
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		rules := getTokenRateLimitRules(c)
+		if len(rules) == 0 {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		bucket := limiter.GetTokenBucket()
+		var requestResult, tokenResult *limiter.BucketResult
+		for _, rule := range rules {
+			if rule.rpm > 0 {
+				result, err := bucket.Take(ctx, rule.key+":rpm", int64(rule.rpm), tokenRateLimitPeriod, 1, limiter.BucketTake)
+				if err != nil {
+					common.SysLog("检查令牌请求数限制失败: " + err.Error())
+					abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+					return
+				}
+				requestResult = moreRestrictive(requestResult, result)
+				if !result.Allowed {
+					setRateLimitHeaders(c, requestResult, tokenResult)
+					abortWithRateLimited(c, result.RetryAfter, fmt.Sprintf("%s已达到每分钟请求数限制：%d", rule.scope, rule.rpm))
+					return
+				}
+			}
+			if rule.tpm > 0 {
+				// 请求前无法得知实际用量，只要桶内还有剩余即放行，请求结束后按实际用量扣减
+				result, err := bucket.Take(ctx, rule.key+":tpm", int64(rule.tpm), tokenRateLimitPeriod, 1, limiter.BucketPeek)
+				if err != nil {
+					common.SysLog("检查令牌 token 数限制失败: " + err.Error())
+					abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+					return
+				}
+				tokenResult = moreRestrictive(tokenResult, result)
+				if !result.Allowed {
+					setRateLimitHeaders(c, requestResult, tokenResult)
+					abortWithRateLimited(c, result.RetryAfter, fmt.Sprintf("%s已达到每分钟 token 数限制：%d", rule.scope, rule.tpm))
+					return
+				}
+			}
+		}
+		setRateLimitHeaders(c, requestResult, tokenResult)
+
+		concurrencyLimiter := limiter.GetConcurrencyLimiter()
+		var acquired []string
+		defer func() {
+			for _, key := range acquired {
+				concurrencyLimiter.Release(context.Background(), key)
+			}
+		}()
+		for _, rule := range rules {
+			if rule.concurrency <= 0 {
+				continue
+			}
+			key := rule.key + ":concurrency"
+			ok, err := concurrencyLimiter.Acquire(ctx, key, int64(rule.concurrency))
+			if err != nil {
+				common.SysLog("检查令牌并发数限制失败: " + err.Error())
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+				return
+			}
+			if !ok {
+				abortWithRateLimited(c, time.Second, fmt.Sprintf("%s已达到最大并发请求数：%d", rule.scope, rule.concurrency))
+				return
+			}
+			acquired = append(acquired, key)
+		}
+
+		c.Next()
+
+		usage := common.GetContextKeyInt(c, constant.ContextKeyUsageTotalTokens)
+		if usage <= 0 {
+			return
+		}
+		for _, rule := range rules {
+			if rule.tpm <= 0 {
+				continue
+			}
+			if _, err := bucket.Take(context.Background(), rule.key+":tpm", int64(rule.tpm), tokenRateLimitPeriod, int64(usage), limiter.BucketForce); err != nil {
+				common.SysLog("扣减令牌 token 数限制失败: " + err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"yunshuAPI/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+type BatchMetadata map[string]string
+
+func (m *BatchMetadata) Scan(val interface{}) error {
+	bytesValue, _ := val.([]byte)
+	if len(bytesValue) == 0 {
+		if str, ok := val.(string); ok {
+			bytesValue = []byte(str)
+		}
+	}
+	if len(bytesValue) == 0 {
+		*m = nil
+		return nil
+	}
+	return json.Unmarshal(bytesValue, m)
+}
+
+func (m BatchMetadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Batch OpenAI 兼容的批处理任务，输入输出均为网关文件
+type Batch struct {
+	Id               int           `json:"-" gorm:"primaryKey"`
+	BatchId          string        `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int           `json:"user_id" gorm:"index"`
+	TokenId          int           `json:"token_id" gorm:"index"`
+	Endpoint         string        `json:"endpoint" gorm:"type:varchar(64)"`
+	CompletionWindow string        `json:"completion_window" gorm:"type:varchar(16)"`
+	InputFileId      string        `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string        `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string        `json:"error_file_id" gorm:"type:varchar(64)"`
+	Status           string        `json:"status" gorm:"type:varchar(16);index"`
+	ErrorMessage     string        `json:"error_message"`
+	Metadata         BatchMetadata `json:"metadata" gorm:"type:json"`
+	TotalCount       int           `json:"total_count"`
+	CompletedCount   int           `json:"completed_count"`
+	FailedCount      int           `json:"failed_count"`
+	// 已处理的输入行数及已写入的分片数，用于服务重启后断点续跑
+	ProcessedLines int   `json:"-"`
+	PartCount      int   `json:"-"`
+	CreatedAt      int64 `json:"created_at" gorm:"bigint;index"`
+	InProgressAt   int64 `json:"in_progress_at" gorm:"bigint"`
+	FinalizingAt   int64 `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt    int64 `json:"completed_at" gorm:"bigint"`
+	FailedAt       int64 `json:"failed_at" gorm:"bigint"`
+	ExpiresAt      int64 `json:"expires_at" gorm:"bigint"`
+	ExpiredAt      int64 `json:"expired_at" gorm:"bigint"`
+	CancellingAt   int64 `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt    int64 `json:"cancelled_at" gorm:"bigint"`
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
+
+// UpdateWithStatus 仅在状态仍为 preStatus 时保存指定字段，避免覆盖期间发生的取消，返回是否保存成功
+func (batch *Batch) UpdateWithStatus(preStatus string, columns ...string) (bool, error) {
+	result := DB.Model(batch).Where("status = ?", preStatus).Select(columns).Updates(batch)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusFailed, BatchStatusCompleted, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// GetBatchStatus 读取最新状态，供执行中的批处理检查是否被取消
+func GetBatchStatus(id int) (string, error) {
+	var batch Batch
+	err := DB.Select("status").Where("id = ?", id).First(&batch).Error
+	return batch.Status, err
+}
+
+// CancelBatch 仅在批处理尚未结束时将其置为 cancelling，由后台任务完成取消
+func CancelBatch(batch *Batch) error {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).
+		Where("id = ? and status in (?)", batch.Id, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]any{"status": BatchStatusCancelling, "cancelling_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("batch cannot be cancelled in its current status")
+	}
+	batch.Status = BatchStatusCancelling
+	batch.CancellingAt = now
+	return nil
+}
+
+func GetUserBatchById(userId int, batchId string) (*Batch, error) {
+	if userId == 0 || batchId == "" {
+		return nil, errors.New("userId 或 batchId 为空")
+	}
+	var batch Batch
+	err := DB.Where("batch_id = ? and user_id = ?", batchId, userId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatches 按 id 倒序游标分页，after 为上一页最后一个批处理的 id
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		afterBatch, err := GetUserBatchById(userId, after)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("id < ?", afterBatch.Id)
+	}
+	err := tx.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetPendingBatches 查询需要后台处理的批处理，包括重启前未完成合并的批处理
+func GetPendingBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status in (?)", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -55,6 +57,8 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+	// 当前节点统计的健康状态，仅用于管理接口展示
+	Health *ChannelHealthInfo `json:"health,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -102,7 +106,8 @@ func (channel *Channel) GetKeys() []string {
 	return keys
 }
 
-func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+// GetNextEnabledKey 按渠道的多 key 模式选择一个启用的 key，affinityKey 用于 sticky_user 模式（通常为用户 ID）
+func (channel *Channel) GetNextEnabledKey(affinityKey string) (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -115,6 +120,17 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no keys available"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 预算计数可能在 Redis 中，在加锁前读取，避免同一渠道的请求排队等待
+	otherSettings := channel.GetOtherSettings()
+	rpmLimit, tpmLimit := otherSettings.MultiKeyRPMLimit, otherSettings.MultiKeyTPMLimit
+	budgets := make([]float64, len(keys))
+	for i := range keys {
+		budgets[i] = 1
+		if rpmLimit > 0 || tpmLimit > 0 {
+			budgets[i] = channelKeyRemainingBudget(channel.Id, i, rpmLimit, tpmLimit)
+		}
+	}
+
 	lock := GetChannelPollingLock(channel.Id)
 	lock.Lock()
 	defer lock.Unlock()
@@ -145,11 +161,69 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 跳过已熔断的 key，全部熔断时仍使用所有启用的 key
+	healthyIdx := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		if channelHealthAllow(channel.Id, idx) {
+			healthyIdx = append(healthyIdx, idx)
+		}
+	}
+	candidateIdx := enabledIdx
+	if len(healthyIdx) > 0 {
+		candidateIdx = healthyIdx
+	}
+
+	// 跳过每分钟预算已用完的 key，直到预算恢复
+	if rpmLimit > 0 || tpmLimit > 0 {
+		candidateIdx = lo.Filter(candidateIdx, func(idx int, _ int) bool {
+			return budgets[idx] > 0
+		})
+		if len(candidateIdx) == 0 {
+			return "", 0, types.NewError(errors.New("all keys have exhausted their per-minute budget"), types.ErrorCodeChannelNoAvailableKey)
+		}
+	}
+	if len(candidateIdx) < len(enabledIdx) {
+		enabledIdx = candidateIdx
+		statusList = make(map[int]int, len(keys))
+		for i := range keys {
+			statusList[i] = common.ChannelStatusAutoDisabled
+		}
+		for _, idx := range candidateIdx {
+			statusList[idx] = common.ChannelStatusEnabled
+		}
+	}
+
+	selected := func(idx int) (string, int, *types.NewAPIError) {
+		markChannelKeySelected(channel.Id, idx, rpmLimit)
+		// 半开状态的 key 被选中即占用一个探测名额
+		markChannelHealthProbe(channel.Id, idx)
+		return keys[idx], idx, nil
+	}
+
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
-		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
-		return keys[selectedIdx], selectedIdx, nil
+		return selected(enabledIdx[rand.Intn(len(enabledIdx))])
+	case constant.MultiKeyModeLeastRecentlyUsed:
+		return selected(lo.MinBy(enabledIdx, func(a int, b int) bool {
+			return getChannelKeyLastUsedAt(channel.Id, a).Before(getChannelKeyLastUsedAt(channel.Id, b))
+		}))
+	case constant.MultiKeyModeLeastInFlight:
+		return selected(pickRandomBest(enabledIdx, func(idx int) float64 {
+			return float64(getChannelKeyInFlight(channel.Id, idx))
+		}))
+	case constant.MultiKeyModeMostRemainingQuota:
+		return selected(pickRandomBest(enabledIdx, func(idx int) float64 {
+			return -budgets[idx]
+		}))
+	case constant.MultiKeyModeStickyUser:
+		if affinityKey == "" {
+			return selected(enabledIdx[rand.Intn(len(enabledIdx))])
+		}
+		// 最高随机权重哈希，某个 key 不可用时只有落在该 key 上的用户会被重新分配
+		return selected(lo.MaxBy(enabledIdx, func(a int, b int) bool {
+			return stickyKeyScore(affinityKey, a) > stickyKeyScore(affinityKey, b)
+		}))
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
 
@@ -178,17 +252,70 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 			if getStatus(idx) == common.ChannelStatusEnabled {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
-				return keys[idx], idx, nil
+				return selected(idx)
 			}
 		}
 		// Fallback - should not happen, but return first enabled key
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		return selected(enabledIdx[0])
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		return selected(enabledIdx[0])
 	}
 }
 
+// GetEnabledKeyByIndex 返回指定的 key，该 key 已禁用、熔断或预算用完时 ok 为 false
+func (channel *Channel) GetEnabledKeyByIndex(keyIndex int) (key string, ok bool) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return "", false
+	}
+	keys := channel.GetKeys()
+	if keyIndex < 0 || keyIndex >= len(keys) {
+		return "", false
+	}
+	otherSettings := channel.GetOtherSettings()
+	if otherSettings.MultiKeyRPMLimit > 0 || otherSettings.MultiKeyTPMLimit > 0 {
+		if channelKeyRemainingBudget(channel.Id, keyIndex, otherSettings.MultiKeyRPMLimit, otherSettings.MultiKeyTPMLimit) <= 0 {
+			return "", false
+		}
+	}
+	lock := GetChannelPollingLock(channel.Id)
+	lock.Lock()
+	defer lock.Unlock()
+	if status, exists := channel.ChannelInfo.MultiKeyStatusList[keyIndex]; exists && status != common.ChannelStatusEnabled {
+		return "", false
+	}
+	if !channelHealthAllow(channel.Id, keyIndex) {
+		return "", false
+	}
+	markChannelKeySelected(channel.Id, keyIndex, otherSettings.MultiKeyRPMLimit)
+	markChannelHealthProbe(channel.Id, keyIndex)
+	return keys[keyIndex], true
+}
+
+// pickRandomBest 返回得分最低的 key，得分相同时随机选择
+func pickRandomBest(indexes []int, score func(idx int) float64) int {
+	var best []int
+	bestScore := 0.0
+	for _, idx := range indexes {
+		s := score(idx)
+		if len(best) == 0 || s < bestScore {
+			best = []int{idx}
+			bestScore = s
+		} else if s == bestScore {
+			best = append(best, idx)
+		}
+	}
+	return best[rand.Intn(len(best))]
+}
+
+func stickyKeyScore(affinityKey string, keyIndex int) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(affinityKey))
+	_, _ = h.Write([]byte{':'})
+	_, _ = h.Write([]byte(strconv.Itoa(keyIndex)))
+	return h.Sum64()
+}
+
 func (channel *Channel) SaveChannelInfo() error {
 	return DB.Model(channel).Update("channel_info", channel.ChannelInfo).Error
 }
@@ -580,6 +707,12 @@ func handlerMultiKeyUpdate(channel *Channel, usingKey string, status int, reason
 		}
 		if status == common.ChannelStatusEnabled {
 			delete(channel.ChannelInfo.MultiKeyStatusList, keyIndex)
+			delete(channel.ChannelInfo.MultiKeyDisabledReason, keyIndex)
+			delete(channel.ChannelInfo.MultiKeyDisabledTime, keyIndex)
+			// 所有 key 都被禁用导致渠道自动禁用时，恢复任一 key 即重新启用渠道
+			if channel.Status == common.ChannelStatusAutoDisabled {
+				channel.Status = common.ChannelStatusEnabled
+			}
 		} else {
 			channel.ChannelInfo.MultiKeyStatusList[keyIndex] = status
 			if channel.ChannelInfo.MultiKeyDisabledReason == nil {
@@ -641,7 +774,8 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 	if err != nil {
 		return false
 	} else {
-		if channel.Status == status {
+		// 多 key 渠道需要更新 key 的状态，渠道状态相同时也不能直接返回
+		if channel.Status == status && !channel.ChannelInfo.IsMultiKey {
 			return false
 		}
 
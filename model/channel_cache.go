@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -11,6 +12,7 @@ import (
 
 	"yunshuAPI/common"
 	"yunshuAPI/constant"
+	"yunshuAPI/setting/operation_setting"
 	"yunshuAPI/setting/ratio_setting"
 )
 
@@ -117,6 +119,7 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
+			markChannelHealthProbe(channel.Id, channelLevelKeyIndex)
 			return channel, nil
 		}
 		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
@@ -139,19 +142,22 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	if retry >= len(uniquePriorities) {
 		retry = len(uniquePriorities) - 1
 	}
-	targetPriority := int64(sortedUniquePriorities[retry])
 
-	// get the priority for the given retry number
-	var sumWeight = 0
+	// 按优先级查找未熔断的渠道，目标优先级的渠道全部熔断时依次降级到更低优先级
+	var targetPriority int64
 	var targetChannels []*Channel
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
-				targetChannels = append(targetChannels, channel)
-			}
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+	var err error
+	for i := retry; i < len(sortedUniquePriorities) && len(targetChannels) == 0; i++ {
+		targetPriority = int64(sortedUniquePriorities[i])
+		if targetChannels, err = filterChannelsByPriority(channels, targetPriority, true); err != nil {
+			return nil, err
+		}
+	}
+	if len(targetChannels) == 0 {
+		// 所有渠道都已熔断时不再过滤，避免请求直接失败
+		targetPriority = int64(sortedUniquePriorities[retry])
+		if targetChannels, err = filterChannelsByPriority(channels, targetPriority, false); err != nil {
+			return nil, err
 		}
 	}
 
@@ -159,6 +165,14 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
 
+	// 按分组/模型配置的路由策略保留得分靠前的渠道，再按权重随机
+	targetChannels = selectChannelsByStrategy(operation_setting.GetRoutingStrategy(group, model), targetChannels)
+
+	var sumWeight = 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetWeight()
+	}
+
 	// smoothing factor and adjustment
 	smoothingFactor := 1
 	smoothingAdjustment := 0
@@ -173,21 +187,47 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		smoothingFactor = 100
 	}
 
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := sumWeight * smoothingFactor
+	// effective weight is scaled down by the channel health score
+	weights := make([]float64, len(targetChannels))
+	totalWeight := 0.0
+	for i, channel := range targetChannels {
+		weights[i] = float64(channel.GetWeight()*smoothingFactor+smoothingAdjustment) * channelHealthWeightFactor(channel.Id)
+		totalWeight += weights[i]
+	}
 
 	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
+	randomWeight := rand.Float64() * totalWeight
 
 	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
+	selected := targetChannels[len(targetChannels)-1]
+	for i, channel := range targetChannels {
+		randomWeight -= weights[i]
 		if randomWeight < 0 {
-			return channel, nil
+			selected = channel
+			break
+		}
+	}
+	markChannelHealthProbe(selected.Id, channelLevelKeyIndex)
+	return selected, nil
+}
+
+// filterChannelsByPriority 返回指定优先级的渠道，onlyHealthy 为 true 时跳过已熔断的渠道，调用方需持有 channelSyncLock
+func filterChannelsByPriority(channelIds []int, priority int64, onlyHealthy bool) ([]*Channel, error) {
+	var result []*Channel
+	for _, channelId := range channelIds {
+		channel, ok := channelsIDM[channelId]
+		if !ok {
+			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+		}
+		if channel.GetPriority() != priority {
+			continue
 		}
+		if onlyHealthy && !channelHealthAllow(channel.Id, channelLevelKeyIndex) {
+			continue
+		}
+		result = append(result, channel)
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return result, nil
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
@@ -263,3 +303,35 @@ func CacheUpdateChannel(channel *Channel) {
 	channelsIDM[channel.Id] = channel
 	println("after :", channelsIDM[channel.Id].ChannelInfo.MultiKeyPollingIndex)
 }
+
+// GetSessionAffinityChannel 返回会话绑定的渠道，渠道已不提供该分组模型、被禁用或已熔断时返回 nil
+func GetSessionAffinityChannel(group string, model string, channelId int) *Channel {
+	if !common.MemoryCacheEnabled {
+		var count int64
+		err := DB.Model(&Ability{}).Where(commonGroupCol+" = ? and model = ? and channel_id = ? and enabled = ?", group, model, channelId, true).Count(&count).Error
+		if err != nil || count == 0 {
+			return nil
+		}
+		channel, err := GetChannelById(channelId, true)
+		if err != nil || channel.Status != common.ChannelStatusEnabled || !channelHealthAllow(channelId, channelLevelKeyIndex) {
+			return nil
+		}
+		return channel
+	}
+
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	channels := group2model2channels[group][model]
+	if len(channels) == 0 {
+		channels = group2model2channels[group][ratio_setting.FormatMatchingModelName(model)]
+	}
+	if !slices.Contains(channels, channelId) {
+		return nil
+	}
+	channel, ok := channelsIDM[channelId]
+	if !ok || channel.Status != common.ChannelStatusEnabled || !channelHealthAllow(channelId, channelLevelKeyIndex) {
+		return nil
+	}
+	markChannelHealthProbe(channelId, channelLevelKeyIndex)
+	return channel
+}
@@ -0,0 +1,317 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"yunshuAPI/setting/operation_setting"
+)
+
+// 渠道熔断与健康度统计，数据仅保存在当前节点内存中
+
+type CircuitState string
+
+const (
+	CircuitStateClosed   CircuitState = "closed"
+	CircuitStateOpen     CircuitState = "open"
+	CircuitStateHalfOpen CircuitState = "half_open"
+)
+
+const healthBucketCount = 10
+
+// channelLevelKeyIndex 表示渠道整体（非某个 key）的健康度
+const channelLevelKeyIndex = -1
+
+type healthKey struct {
+	channelId int
+	keyIndex  int
+}
+
+type healthBucket struct {
+	epoch   int64
+	success int
+	failure int
+}
+
+type channelHealth struct {
+	mu                sync.Mutex
+	buckets           [healthBucketCount]healthBucket
+	state             CircuitState
+	openedAt          time.Time
+	halfOpenInFlight  int
+	halfOpenProbeAt   time.Time
+	halfOpenSuccesses int
+	lastSuccessAt     time.Time
+	lastFailureAt     time.Time
+}
+
+// ChannelHealthInfo 渠道健康状态，供管理接口展示
+type ChannelHealthInfo struct {
+	State         CircuitState               `json:"state"`
+	Score         float64                    `json:"score"`
+	Requests      int                        `json:"requests"`
+	Failures      int                        `json:"failures"`
+	OpenedAt      int64                      `json:"opened_at,omitempty"`
+	LastSuccessAt int64                      `json:"last_success_at,omitempty"`
+	LastFailureAt int64                      `json:"last_failure_at,omitempty"`
+	Keys          map[int]*ChannelHealthInfo `json:"keys,omitempty"`
+}
+
+var channelHealthMap sync.Map // healthKey -> *channelHealth
+
+func getChannelHealth(key healthKey, create bool) *channelHealth {
+	if v, ok := channelHealthMap.Load(key); ok {
+		return v.(*channelHealth)
+	}
+	if !create {
+		return nil
+	}
+	v, _ := channelHealthMap.LoadOrStore(key, &channelHealth{state: CircuitStateClosed})
+	return v.(*channelHealth)
+}
+
+func healthBucketSeconds() int64 {
+	window := operation_setting.GetChannelHealthSetting().WindowSeconds
+	if window < healthBucketCount {
+		window = healthBucketCount
+	}
+	return int64(window / healthBucketCount)
+}
+
+// counts 返回统计窗口内的成功和失败次数，调用方需持有锁
+func (h *channelHealth) counts(now time.Time) (success int, failure int) {
+	current := now.Unix() / healthBucketSeconds()
+	for _, bucket := range h.buckets {
+		if current-bucket.epoch < healthBucketCount {
+			success += bucket.success
+			failure += bucket.failure
+		}
+	}
+	return
+}
+
+func (h *channelHealth) score(now time.Time) float64 {
+	success, failure := h.counts(now)
+	total := success + failure
+	if total == 0 || total < operation_setting.GetChannelHealthSetting().MinRequests {
+		return 1
+	}
+	return float64(success) / float64(total)
+}
+
+// refreshState 熔断到期后转为半开，调用方需持有锁
+func (h *channelHealth) refreshState(now time.Time) {
+	setting := operation_setting.GetChannelHealthSetting()
+	switch h.state {
+	case CircuitStateOpen:
+		if now.Sub(h.openedAt) >= time.Duration(setting.OpenSeconds)*time.Second {
+			h.state = CircuitStateHalfOpen
+			h.halfOpenInFlight = 0
+			h.halfOpenSuccesses = 0
+		}
+	case CircuitStateHalfOpen:
+		// 探测请求长时间没有结果时释放名额，避免一直卡在半开
+		if h.halfOpenInFlight > 0 && now.Sub(h.halfOpenProbeAt) >= time.Duration(setting.OpenSeconds)*time.Second {
+			h.halfOpenInFlight = 0
+		}
+	}
+}
+
+func (h *channelHealth) record(success bool, now time.Time) {
+	setting := operation_setting.GetChannelHealthSetting()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	epoch := now.Unix() / healthBucketSeconds()
+	bucket := &h.buckets[epoch%healthBucketCount]
+	if bucket.epoch != epoch {
+		*bucket = healthBucket{epoch: epoch}
+	}
+	if success {
+		bucket.success++
+		h.lastSuccessAt = now
+	} else {
+		bucket.failure++
+		h.lastFailureAt = now
+	}
+
+	h.refreshState(now)
+	switch h.state {
+	case CircuitStateHalfOpen:
+		if h.halfOpenInFlight > 0 {
+			h.halfOpenInFlight--
+		}
+		if !success {
+			h.state = CircuitStateOpen
+			h.openedAt = now
+			return
+		}
+		h.halfOpenSuccesses++
+		if h.halfOpenSuccesses >= setting.HalfOpenSuccessThreshold {
+			h.state = CircuitStateClosed
+			h.buckets = [healthBucketCount]healthBucket{}
+		}
+	case CircuitStateClosed:
+		if success {
+			return
+		}
+		successCount, failureCount := h.counts(now)
+		total := successCount + failureCount
+		if total >= setting.MinRequests && float64(failureCount)/float64(total) >= setting.ErrorRateThreshold {
+			h.state = CircuitStateOpen
+			h.openedAt = now
+		}
+	}
+}
+
+// allow 判断是否可以向该渠道（或 key）发送请求
+func (h *channelHealth) allow(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.refreshState(now)
+	switch h.state {
+	case CircuitStateOpen:
+		return false
+	case CircuitStateHalfOpen:
+		return h.halfOpenInFlight < operation_setting.GetChannelHealthSetting().HalfOpenMaxRequests
+	}
+	return true
+}
+
+// weightFactor 返回健康分对权重的折算比例
+func (h *channelHealth) weightFactor(now time.Time) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	minFactor := operation_setting.GetChannelHealthSetting().MinWeightFactor
+	if h.state == CircuitStateHalfOpen {
+		return minFactor
+	}
+	factor := h.score(now)
+	if factor < minFactor {
+		factor = minFactor
+	}
+	return factor
+}
+
+func (h *channelHealth) markProbe(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state == CircuitStateHalfOpen {
+		h.halfOpenInFlight++
+		h.halfOpenProbeAt = now
+	}
+}
+
+func (h *channelHealth) info(now time.Time) *ChannelHealthInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.refreshState(now)
+	success, failure := h.counts(now)
+	info := &ChannelHealthInfo{
+		State:    h.state,
+		Score:    h.score(now),
+		Requests: success + failure,
+		Failures: failure,
+	}
+	if h.state != CircuitStateClosed {
+		info.OpenedAt = h.openedAt.Unix()
+	}
+	if !h.lastSuccessAt.IsZero() {
+		info.LastSuccessAt = h.lastSuccessAt.Unix()
+	}
+	if !h.lastFailureAt.IsZero() {
+		info.LastFailureAt = h.lastFailureAt.Unix()
+	}
+	return info
+}
+
+// RecordChannelHealth 记录一次渠道请求结果，多 key 渠道同时记录 key 级别的结果
+func RecordChannelHealth(channelId int, isMultiKey bool, keyIndex int, success bool) {
+	if !operation_setting.GetChannelHealthSetting().Enabled || channelId == 0 {
+		return
+	}
+	now := time.Now()
+	getChannelHealth(healthKey{channelId, channelLevelKeyIndex}, true).record(success, now)
+	if isMultiKey {
+		getChannelHealth(healthKey{channelId, keyIndex}, true).record(success, now)
+	}
+}
+
+// ReleaseChannelHealthProbe 请求结束但结果不计入健康度时（例如用户请求错误），释放半开探测名额
+func ReleaseChannelHealthProbe(channelId int, isMultiKey bool, keyIndex int) {
+	release := func(key healthKey) {
+		if h := getChannelHealth(key, false); h != nil {
+			h.mu.Lock()
+			if h.state == CircuitStateHalfOpen && h.halfOpenInFlight > 0 {
+				h.halfOpenInFlight--
+			}
+			h.mu.Unlock()
+		}
+	}
+	release(healthKey{channelId, channelLevelKeyIndex})
+	if isMultiKey {
+		release(healthKey{channelId, keyIndex})
+	}
+}
+
+func channelHealthAllow(channelId int, keyIndex int) bool {
+	if !operation_setting.GetChannelHealthSetting().Enabled {
+		return true
+	}
+	h := getChannelHealth(healthKey{channelId, keyIndex}, false)
+	if h == nil {
+		return true
+	}
+	return h.allow(time.Now())
+}
+
+func channelHealthWeightFactor(channelId int) float64 {
+	if !operation_setting.GetChannelHealthSetting().Enabled {
+		return 1
+	}
+	h := getChannelHealth(healthKey{channelId, channelLevelKeyIndex}, false)
+	if h == nil {
+		return 1
+	}
+	return h.weightFactor(time.Now())
+}
+
+func markChannelHealthProbe(channelId int, keyIndex int) {
+	if h := getChannelHealth(healthKey{channelId, keyIndex}, false); h != nil {
+		h.markProbe(time.Now())
+	}
+}
+
+// GetChannelHealthInfo 返回渠道健康状态，没有统计数据时返回 nil
+func GetChannelHealthInfo(channelId int) *ChannelHealthInfo {
+	now := time.Now()
+	var info *ChannelHealthInfo
+	if h := getChannelHealth(healthKey{channelId, channelLevelKeyIndex}, false); h != nil {
+		info = h.info(now)
+	}
+	channelHealthMap.Range(func(k, v any) bool {
+		key := k.(healthKey)
+		if key.channelId != channelId || key.keyIndex == channelLevelKeyIndex {
+			return true
+		}
+		if info == nil {
+			info = &ChannelHealthInfo{State: CircuitStateClosed, Score: 1}
+		}
+		if info.Keys == nil {
+			info.Keys = make(map[int]*ChannelHealthInfo)
+		}
+		info.Keys[key.keyIndex] = v.(*channelHealth).info(now)
+		return true
+	})
+	return info
+}
+
+// ResetChannelHealth 清空渠道（及其所有 key）的健康统计并关闭熔断
+func ResetChannelHealth(channelId int) {
+	channelHealthMap.Range(func(k, _ any) bool {
+		if k.(healthKey).channelId == channelId {
+			channelHealthMap.Delete(k)
+		}
+		return true
+	})
+}
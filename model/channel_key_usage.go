@@ -0,0 +1,184 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/common/limiter"
+)
+
+// 多 key 渠道中每个 key 的使用计数，用于 key 选择策略和管理接口展示，数据仅保存在当前节点内存中。
+// 每分钟预算使用令牌桶计数，启用 Redis 时多节点共享
+
+const channelKeyUsageWindow = time.Minute
+
+type channelKeyUsage struct {
+	mu             sync.Mutex
+	inFlight       int64
+	lastUsedAt     time.Time
+	totalRequests  int64
+	totalTokens    int64
+	windowStart    time.Time
+	windowRequests int64
+	windowTokens   int64
+}
+
+// ChannelKeyUsageInfo key 的使用情况，供管理接口展示
+type ChannelKeyUsageInfo struct {
+	InFlight       int64 `json:"in_flight"`
+	LastUsedAt     int64 `json:"last_used_at,omitempty"`
+	TotalRequests  int64 `json:"total_requests"`
+	TotalTokens    int64 `json:"total_tokens"`
+	MinuteRequests int64 `json:"minute_requests"`
+	MinuteTokens   int64 `json:"minute_tokens"`
+	WindowResetAt  int64 `json:"window_reset_at,omitempty"`
+}
+
+var channelKeyUsageMap sync.Map // healthKey -> *channelKeyUsage
+
+func getChannelKeyUsage(channelId int, keyIndex int, create bool) *channelKeyUsage {
+	key := healthKey{channelId, keyIndex}
+	if v, ok := channelKeyUsageMap.Load(key); ok {
+		return v.(*channelKeyUsage)
+	}
+	if !create {
+		return nil
+	}
+	v, _ := channelKeyUsageMap.LoadOrStore(key, &channelKeyUsage{})
+	return v.(*channelKeyUsage)
+}
+
+// rollWindow 进入新的统计窗口时清空窗口计数，调用方需持有锁
+func (u *channelKeyUsage) rollWindow(now time.Time) {
+	if now.Sub(u.windowStart) >= channelKeyUsageWindow {
+		u.windowStart = now.Truncate(channelKeyUsageWindow)
+		u.windowRequests = 0
+		u.windowTokens = 0
+	}
+}
+
+func markChannelKeySelected(channelId int, keyIndex int, rpmLimit int) {
+	usage := getChannelKeyUsage(channelId, keyIndex, true)
+	now := time.Now()
+	usage.mu.Lock()
+	usage.rollWindow(now)
+	usage.lastUsedAt = now
+	usage.totalRequests++
+	usage.windowRequests++
+	usage.mu.Unlock()
+	consumeChannelKeyBudget(channelId, keyIndex, "rpm", rpmLimit, 1)
+}
+
+// ChannelKeyRequestStarted 记录 key 开始处理一个请求，返回的函数在请求结束时调用
+func ChannelKeyRequestStarted(channelId int, keyIndex int) func() {
+	usage := getChannelKeyUsage(channelId, keyIndex, true)
+	usage.mu.Lock()
+	usage.inFlight++
+	usage.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			usage.mu.Lock()
+			usage.inFlight--
+			usage.mu.Unlock()
+		})
+	}
+}
+
+// RecordChannelKeyTokens 记录 key 消耗的 token 数，tpmLimit 为渠道设置的每个 key 每分钟 token 预算
+func RecordChannelKeyTokens(channelId int, keyIndex int, tokens int, tpmLimit int) {
+	if tokens <= 0 {
+		return
+	}
+	usage := getChannelKeyUsage(channelId, keyIndex, true)
+	now := time.Now()
+	usage.mu.Lock()
+	usage.rollWindow(now)
+	usage.totalTokens += int64(tokens)
+	usage.windowTokens += int64(tokens)
+	usage.mu.Unlock()
+	consumeChannelKeyBudget(channelId, keyIndex, "tpm", tpmLimit, tokens)
+}
+
+func channelKeyBudgetKey(channelId int, keyIndex int, kind string) string {
+	return fmt.Sprintf("channelKeyBudget:%d:%d:%s", channelId, keyIndex, kind)
+}
+
+// consumeChannelKeyBudget 从 key 的预算中扣减，允许透支，未设置预算时忽略
+func consumeChannelKeyBudget(channelId int, keyIndex int, kind string, limit int, amount int) {
+	if limit <= 0 {
+		return
+	}
+	_, err := limiter.GetTokenBucket().Take(context.Background(), channelKeyBudgetKey(channelId, keyIndex, kind), int64(limit), channelKeyUsageWindow, int64(amount), limiter.BucketForce)
+	if err != nil {
+		common.SysLog("failed to consume channel key budget: " + err.Error())
+	}
+}
+
+// channelKeyRemainingBudget 返回 key 剩余预算的比例（0-1），未设置预算时为 1
+func channelKeyRemainingBudget(channelId int, keyIndex int, rpmLimit int, tpmLimit int) float64 {
+	bucket := limiter.GetTokenBucket()
+	remaining := 1.0
+	for _, budget := range []struct {
+		kind  string
+		limit int
+	}{{"rpm", rpmLimit}, {"tpm", tpmLimit}} {
+		if budget.limit <= 0 {
+			continue
+		}
+		result, err := bucket.Take(context.Background(), channelKeyBudgetKey(channelId, keyIndex, budget.kind), int64(budget.limit), channelKeyUsageWindow, 1, limiter.BucketPeek)
+		if err != nil {
+			// 计数不可用时不因预算跳过 key
+			common.SysLog("failed to check channel key budget: " + err.Error())
+			continue
+		}
+		remaining = min(remaining, float64(result.Remaining)/float64(budget.limit))
+	}
+	return max(remaining, 0)
+}
+
+func getChannelKeyInFlight(channelId int, keyIndex int) int64 {
+	usage := getChannelKeyUsage(channelId, keyIndex, false)
+	if usage == nil {
+		return 0
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	return usage.inFlight
+}
+
+func getChannelKeyLastUsedAt(channelId int, keyIndex int) time.Time {
+	usage := getChannelKeyUsage(channelId, keyIndex, false)
+	if usage == nil {
+		return time.Time{}
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	return usage.lastUsedAt
+}
+
+// GetChannelKeyUsageInfo 返回 key 的使用情况，没有数据时返回 nil
+func GetChannelKeyUsageInfo(channelId int, keyIndex int) *ChannelKeyUsageInfo {
+	usage := getChannelKeyUsage(channelId, keyIndex, false)
+	if usage == nil {
+		return nil
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	usage.rollWindow(time.Now())
+	info := &ChannelKeyUsageInfo{
+		InFlight:       usage.inFlight,
+		TotalRequests:  usage.totalRequests,
+		TotalTokens:    usage.totalTokens,
+		MinuteRequests: usage.windowRequests,
+		MinuteTokens:   usage.windowTokens,
+		WindowResetAt:  usage.windowStart.Add(channelKeyUsageWindow).Unix(),
+	}
+	if !usage.lastUsedAt.IsZero() {
+		info.LastUsedAt = usage.lastUsedAt.Unix()
+	}
+	return info
+}
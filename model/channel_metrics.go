@@ -0,0 +1,160 @@
+package model
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/samber/lo"
+)
+
+// 渠道实时指标（延迟、进行中的请求数），供路由策略使用，数据仅保存在当前节点内存中
+
+type channelMetrics struct {
+	inFlight atomic.Int64
+
+	mu sync.Mutex
+	// 流式请求的首字延迟与非流式请求的总耗时含义不同，分开统计
+	firstToken   latencyEWMA
+	totalLatency latencyEWMA
+}
+
+// latencyEWMA 平滑后的延迟（毫秒）
+type latencyEWMA struct {
+	value   float64
+	samples int64
+}
+
+func (e *latencyEWMA) add(ms float64, alpha float64) {
+	if e.samples == 0 {
+		e.value = ms
+	} else {
+		e.value = alpha*ms + (1-alpha)*e.value
+	}
+	e.samples++
+}
+
+var channelMetricsMap sync.Map // channel id -> *channelMetrics
+
+func getChannelMetrics(channelId int) *channelMetrics {
+	if v, ok := channelMetricsMap.Load(channelId); ok {
+		return v.(*channelMetrics)
+	}
+	v, _ := channelMetricsMap.LoadOrStore(channelId, &channelMetrics{})
+	return v.(*channelMetrics)
+}
+
+// ChannelRequestStarted 记录渠道开始处理一个请求，返回的函数在请求结束时调用
+func ChannelRequestStarted(channelId int) func() {
+	metrics := getChannelMetrics(channelId)
+	metrics.inFlight.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			metrics.inFlight.Add(-1)
+		})
+	}
+}
+
+// RecordChannelLatency 记录一次成功请求的延迟，流式请求为首字延迟，非流式请求为总耗时
+func RecordChannelLatency(channelId int, isStream bool, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	alpha := operation_setting.GetRoutingSetting().LatencyEWMAAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	metrics := getChannelMetrics(channelId)
+	ms := float64(latency.Milliseconds())
+	metrics.mu.Lock()
+	if isStream {
+		metrics.firstToken.add(ms, alpha)
+	} else {
+		metrics.totalLatency.add(ms, alpha)
+	}
+	metrics.mu.Unlock()
+}
+
+// GetChannelInFlight 返回渠道当前进行中的请求数
+func GetChannelInFlight(channelId int) int64 {
+	return getChannelMetrics(channelId).inFlight.Load()
+}
+
+// GetChannelLatency 返回渠道平滑后的首字延迟（isStream 为 true）或总耗时（毫秒），没有样本时 ok 为 false
+func GetChannelLatency(channelId int, isStream bool) (ms float64, ok bool) {
+	metrics := getChannelMetrics(channelId)
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	e := metrics.totalLatency
+	if isStream {
+		e = metrics.firstToken
+	}
+	return e.value, e.samples > 0
+}
+
+func channelUpstreamCost(channel *Channel) float64 {
+	cost := channel.GetOtherSettings().UpstreamCostRatio
+	if cost <= 0 {
+		return 1
+	}
+	return cost
+}
+
+// selectChannelsByStrategy 按路由策略保留得分最好的前 TopK 个渠道（与第 K 名同分的渠道一并保留），再由调用方按权重随机选择，
+// 避免流量全部集中到单个渠道
+func selectChannelsByStrategy(strategy string, channels []*Channel) []*Channel {
+	if len(channels) <= 1 {
+		return channels
+	}
+	var score func(channel *Channel) float64
+	switch strategy {
+	case operation_setting.RoutingStrategyLowestLatency:
+		// 有流式样本时按首字延迟比较，否则按非流式总耗时比较，同一次比较只使用一种指标；
+		// 没有样本的渠道优先，以便尽快获得延迟数据
+		isStream := lo.SomeBy(channels, func(channel *Channel) bool {
+			_, ok := GetChannelLatency(channel.Id, true)
+			return ok
+		})
+		score = func(channel *Channel) float64 {
+			ms, ok := GetChannelLatency(channel.Id, isStream)
+			if !ok {
+				return -1
+			}
+			return ms
+		}
+	case operation_setting.RoutingStrategyLeastInFlight:
+		score = func(channel *Channel) float64 {
+			return float64(GetChannelInFlight(channel.Id))
+		}
+	case operation_setting.RoutingStrategyLowestCost:
+		score = channelUpstreamCost
+	default:
+		return channels
+	}
+
+	topK := operation_setting.GetRoutingSetting().TopK
+	if topK <= 0 {
+		topK = 1
+	}
+	if topK >= len(channels) {
+		return channels
+	}
+	scores := make(map[int]float64, len(channels))
+	for _, channel := range channels {
+		scores[channel.Id] = score(channel)
+	}
+	sorted := slices.Clone(channels)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return scores[sorted[i].Id] < scores[sorted[j].Id]
+	})
+	n := topK
+	for n < len(sorted) && scores[sorted[n].Id] == scores[sorted[topK-1].Id] {
+		n++
+	}
+	return sorted[:n]
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"yunshuAPI/common"
+)
+
+// ChannelProbe 自动禁用渠道（或 key）的恢复探测记录
+type ChannelProbe struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	KeyIndex     int    `json:"key_index"` // 单 key 渠道为 -1
+	Attempt      int    `json:"attempt"`
+	Success      bool   `json:"success"`
+	Recovered    bool   `json:"recovered"`
+	Message      string `json:"message" gorm:"type:text"`
+	ResponseTime int64  `json:"response_time"` // 毫秒
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func RecordChannelProbe(probe *ChannelProbe) {
+	if probe.CreatedAt == 0 {
+		probe.CreatedAt = common.GetTimestamp()
+	}
+	if err := DB.Create(probe).Error; err != nil {
+		common.SysLog("failed to record channel probe: " + err.Error())
+	}
+}
+
+// GetChannelProbes 返回渠道最近的探测记录
+func GetChannelProbes(channelId int, limit int) ([]*ChannelProbe, error) {
+	var probes []*ChannelProbe
+	err := DB.Where("channel_id = ?", channelId).Order("id desc").Limit(limit).Find(&probes).Error
+	return probes, err
+}
+
+func DeleteChannelProbesBefore(t time.Time) (int64, error) {
+	result := DB.Where("created_at < ?", t.Unix()).Delete(&ChannelProbe{})
+	return result.RowsAffected, result.Error
+}
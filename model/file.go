@@ -0,0 +1,103 @@
+package model
+
+import (
+	"errors"
+
+	"yunshuAPI/common"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// File 用户通过 /v1/files 上传的文件元数据，文件内容保存在对象存储中
+type File struct {
+	Id          int    `json:"-" gorm:"primaryKey"`
+	FileId      string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"index"`
+	Filename    string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose     string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes       int64  `json:"bytes"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Storage     string `json:"storage" gorm:"type:varchar(16)"`
+	StorageKey  string `json:"-" gorm:"type:varchar(255)"`
+	Quota       int    `json:"quota"`
+	Status      string `json:"status" gorm:"type:varchar(16)"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
+
+func (file *File) IsExpired() bool {
+	return file.ExpiresAt > 0 && file.ExpiresAt < common.GetTimestamp()
+}
+
+// GetUserFileById 按 file id 查询文件，只返回属于该用户的文件
+func GetUserFileById(userId int, fileId string) (*File, error) {
+	if userId == 0 || fileId == "" {
+		return nil, errors.New("userId 或 fileId 为空")
+	}
+	var file File
+	err := DB.Where("file_id = ? and user_id = ?", fileId, userId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetFileByFileId 按 file id 查询文件，不校验所属用户，用于签名地址等已鉴权的访问
+func GetFileByFileId(fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("fileId 为空")
+	}
+	var file File
+	err := DB.Where("file_id = ?", fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFiles 按 id 游标分页查询用户文件，after 为上一页最后一个文件的 file id
+func GetUserFiles(userId int, purpose string, after string, limit int, ascending bool) ([]*File, error) {
+	var files []*File
+	tx := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		afterFile, err := GetUserFileById(userId, after)
+		if err != nil {
+			return nil, err
+		}
+		if ascending {
+			tx = tx.Where("id > ?", afterFile.Id)
+		} else {
+			tx = tx.Where("id < ?", afterFile.Id)
+		}
+	}
+	if ascending {
+		tx = tx.Order("id asc")
+	} else {
+		tx = tx.Order("id desc")
+	}
+	err := tx.Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// GetExpiredFiles 查询 id 大于 afterId 的已过期文件，用于后台分批清理
+func GetExpiredFiles(afterId int, limit int) ([]*File, error) {
+	var files []*File
+	err := DB.Where("id > ? and expires_at > 0 and expires_at < ?", afterId, common.GetTimestamp()).Order("id asc").Limit(limit).Find(&files).Error
+	return files, err
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+
+	"gorm.io/gorm/clause"
+)
+
+// 日志保留策略使用的查询：按类型和时间范围读取、删除日志，以及从归档重新导入
+
+// GetOldestLogTime 返回指定类型中早于 before 的最早一条日志的时间，没有时返回 0
+func GetOldestLogTime(logType int, before int64) (int64, error) {
+	var logs []*Log
+	err := LOG_DB.Select("created_at").Where("type = ? AND created_at < ?", logType, before).
+		Order("created_at asc").Limit(1).Find(&logs).Error
+	if err != nil || len(logs) == 0 {
+		return 0, err
+	}
+	return logs[0].CreatedAt, nil
+}
+
+// ScanLogsBetween 按 id 游标分批读取指定类型、时间范围 [start, end) 内的原始日志，返回读取到的最大 id
+func ScanLogsBetween(logType int, start int64, end int64, batchSize int, fn func(logs []*Log) error) (int, error) {
+	lastId := 0
+	for {
+		var logs []*Log
+		err := LOG_DB.Where("type = ? AND created_at >= ? AND created_at < ? AND id > ?", logType, start, end, lastId).
+			Order("id asc").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return lastId, err
+		}
+		if len(logs) == 0 {
+			return lastId, nil
+		}
+		if err = fn(logs); err != nil {
+			return lastId, err
+		}
+		lastId = logs[len(logs)-1].Id
+		if len(logs) < batchSize {
+			return lastId, nil
+		}
+	}
+}
+
+// DeleteLogsBetween 分批删除指定类型、时间范围 [start, end) 内 id 不超过 maxId 的日志，
+// maxId 用于保证只删除已经归档的日志
+func DeleteLogsBetween(ctx context.Context, logType int, start int64, end int64, maxId int, limit int) (int64, error) {
+	var total int64 = 0
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+		tx := LOG_DB.Where("type = ? AND created_at >= ? AND created_at < ?", logType, start, end)
+		if maxId > 0 {
+			tx = tx.Where("id <= ?", maxId)
+		}
+		result := tx.Limit(limit).Delete(&Log{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// ImportLogs 写入归档中的日志，保留原 id，已存在的 id 会被跳过，因此重复导入同一归档是安全的
+func ImportLogs(logs []*Log) (int64, error) {
+	if len(logs) == 0 {
+		return 0, nil
+	}
+	result := LOG_DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&logs)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// LogExportFilter 日志导出的筛选条件，与日志列表接口的参数一致
+type LogExportFilter struct {
+	UserId         int // 非 0 时只导出该用户的日志，并按用户日志的方式隐藏管理信息
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+	Group          string
+}
+
+func (f *LogExportFilter) apply(tx *gorm.DB) *gorm.DB {
+	if f.UserId != 0 {
+		tx = tx.Where("logs.user_id = ?", f.UserId)
+	}
+	if f.LogType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", f.LogType)
+	}
+	if f.ModelName != "" {
+		tx = tx.Where("logs.model_name like ?", f.ModelName)
+	}
+	if f.Username != "" {
+		tx = tx.Where("logs.username = ?", f.Username)
+	}
+	if f.TokenName != "" {
+		tx = tx.Where("logs.token_name = ?", f.TokenName)
+	}
+	if f.StartTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", f.StartTimestamp)
+	}
+	if f.EndTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", f.EndTimestamp)
+	}
+	if f.Channel != 0 {
+		tx = tx.Where("logs.channel_id = ?", f.Channel)
+	}
+	if f.Group != "" {
+		tx = tx.Where("logs."+logGroupCol+" = ?", f.Group)
+	}
+	return tx
+}
+
+// ExportLogs 按 id 游标分批读取匹配的日志并交给 fn 处理，每批处理完才读取下一批，内存占用与总行数无关
+func ExportLogs(filter LogExportFilter, batchSize int, fn func(logs []*Log) error) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	lastId := 0
+	for {
+		var logs []*Log
+		tx := filter.apply(LOG_DB.Model(&Log{}))
+		if lastId > 0 {
+			tx = tx.Where("logs.id > ?", lastId)
+		}
+		if err := tx.Order("logs.id asc").Limit(batchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+		if filter.UserId != 0 {
+			formatUserLogs(logs)
+		} else if err := fillLogChannelNames(logs); err != nil {
+			return err
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+	}
+}
@@ -267,6 +267,13 @@ func migrateDB() error {
 		&Setup{},
 		&TwoFA{},
 		&TwoFABackupCode{},
+		&File{},
+		&Batch{},
+		&QuotaSpend{},
+		&ChannelProbe{},
+		&UserQuotaSnapshot{},
+		&PayloadCapture{},
+		&TaskCallbackDelivery{},
 	)
 	if err != nil {
 		return err
@@ -300,6 +307,13 @@ func migrateDBFast() error {
 		{&Setup{}, "Setup"},
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&QuotaSpend{}, "QuotaSpend"},
+		{&ChannelProbe{}, "ChannelProbe"},
+		{&UserQuotaSnapshot{}, "UserQuotaSnapshot"},
+		{&PayloadCapture{}, "PayloadCapture"},
+		{&TaskCallbackDelivery{}, "TaskCallbackDelivery"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -330,7 +344,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &PayloadCapture{}); err != nil {
 		return err
 	}
 	return nil
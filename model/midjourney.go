@@ -4,6 +4,7 @@ type Midjourney struct {
 	Id          int    `json:"id"`
 	Code        int    `json:"code"`
 	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"index"`
 	Action      string `json:"action" gorm:"type:varchar(40);index"`
 	MjId        string `json:"mj_id" gorm:"index"`
 	Prompt      string `json:"prompt"`
@@ -23,6 +24,7 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	CallbackUrl string `json:"callback_url,omitempty" gorm:"type:varchar(512);default:''"` // 任务完成时回调的地址
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -157,6 +159,11 @@ func (midjourney *Midjourney) Update() error {
 	return err
 }
 
+// UpdateImageUrl 只保存转存后的图片地址，避免覆盖转存期间轮询写入的其他字段
+func (midjourney *Midjourney) UpdateImageUrl() error {
+	return DB.Model(midjourney).Select("image_url").Updates(midjourney).Error
+}
+
 func MjBulkUpdate(mjIds []string, params map[string]any) error {
 	return DB.Model(&Midjourney{}).
 		Where("mj_id in (?)", mjIds).
@@ -0,0 +1,42 @@
+package model
+
+import "yunshuAPI/common"
+
+// PayloadCapture 调试抓取的请求和响应内容，与日志一起存放在日志库，按 RequestId 关联日志
+type PayloadCapture struct {
+	Id           int    `json:"id"`
+	RequestId    string `json:"request_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	TokenId      int    `json:"token_id"`
+	ChannelId    int    `json:"channel_id"`
+	ModelName    string `json:"model_name"`
+	RequestPath  string `json:"request_path"`
+	StatusCode   int    `json:"status_code"`
+	IsStream     bool   `json:"is_stream"`
+	Truncated    bool   `json:"truncated"`
+	RequestBody  string `json:"request_body" gorm:"type:text"`
+	UpstreamBody string `json:"upstream_body" gorm:"type:text"`
+	ResponseBody string `json:"response_body" gorm:"type:text"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt    int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (capture *PayloadCapture) Insert() error {
+	return LOG_DB.Create(capture).Error
+}
+
+// GetPayloadCaptureByRequestId 返回未过期的抓取内容，不存在时返回 nil
+func GetPayloadCaptureByRequestId(requestId string) (*PayloadCapture, error) {
+	var captures []PayloadCapture
+	err := LOG_DB.Where("request_id = ? AND expires_at > ?", requestId, common.GetTimestamp()).Limit(1).Find(&captures).Error
+	if err != nil || len(captures) == 0 {
+		return nil, err
+	}
+	return &captures[0], nil
+}
+
+// DeleteExpiredPayloadCaptures 删除过期的抓取内容
+func DeleteExpiredPayloadCaptures() (int64, error) {
+	result := LOG_DB.Where("expires_at <= ?", common.GetTimestamp()).Delete(&PayloadCapture{})
+	return result.RowsAffected, result.Error
+}
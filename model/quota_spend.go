@@ -0,0 +1,193 @@
+package model
+
+import (
+	"strconv"
+	"time"
+
+	"yunshuAPI/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 令牌和用户按日记录的消费额度，用于日/周/月消费上限，周和月的用量由日记录汇总
+
+const (
+	SpendSubjectToken = "token"
+	SpendSubjectUser  = "user"
+
+	SpendWindowDay   = "day"
+	SpendWindowWeek  = "week"
+	SpendWindowMonth = "month"
+)
+
+type QuotaSpend struct {
+	Id          int    `json:"id"`
+	SubjectType string `json:"subject_type" gorm:"type:varchar(16);uniqueIndex:idx_quota_spend_subject_day"`
+	SubjectId   int    `json:"subject_id" gorm:"uniqueIndex:idx_quota_spend_subject_day"`
+	Day         int    `json:"day" gorm:"uniqueIndex:idx_quota_spend_subject_day;index"` // 例如 20260101
+	Used        int64  `json:"used" gorm:"bigint;default:0"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// SpendLimits 日/周/月消费上限，0 表示不限制
+type SpendLimits struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+func (l SpendLimits) Enabled() bool {
+	return l.Daily > 0 || l.Weekly > 0 || l.Monthly > 0
+}
+
+// SpendLimitStatus 某个窗口的消费上限及剩余额度
+type SpendLimitStatus struct {
+	Window    string `json:"window"`
+	Limit     int    `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+	ResetAt   int64  `json:"reset_at"`
+}
+
+func spendDay(t time.Time) int {
+	day, _ := strconv.Atoi(t.Format("20060102"))
+	return day
+}
+
+// spendWindowStart 返回窗口的开始时间，周从周一开始
+func spendWindowStart(window string, now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch window {
+	case SpendWindowWeek:
+		offset := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -offset)
+	case SpendWindowMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	default:
+		return today
+	}
+}
+
+func spendWindowReset(window string, start time.Time) time.Time {
+	switch window {
+	case SpendWindowWeek:
+		return start.AddDate(0, 0, 7)
+	case SpendWindowMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// SpendWindowResetAt 返回窗口当前周期的重置时间，用于标识消费计数器所属的周期
+func SpendWindowResetAt(window string, now time.Time) int64 {
+	return spendWindowReset(window, spendWindowStart(window, now)).Unix()
+}
+
+// AddQuotaSpend 累加当天的消费额度，quota 为负数时表示退款
+func AddQuotaSpend(subjectType string, subjectId int, quota int) error {
+	if subjectId == 0 || quota == 0 {
+		return nil
+	}
+	now := time.Now()
+	spend := &QuotaSpend{
+		SubjectType: subjectType,
+		SubjectId:   subjectId,
+		Day:         spendDay(now),
+		Used:        int64(quota),
+		UpdatedAt:   now.Unix(),
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject_type"}, {Name: "subject_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"used":       gorm.Expr("quota_spends.used + ?", quota),
+			"updated_at": now.Unix(),
+		}),
+	}).Create(spend).Error
+}
+
+// GetSpendLimitStatus 返回已设置上限的各窗口用量
+func GetSpendLimitStatus(subjectType string, subjectId int, limits SpendLimits) ([]SpendLimitStatus, error) {
+	if !limits.Enabled() {
+		return nil, nil
+	}
+	now := time.Now()
+	windows := []struct {
+		name  string
+		limit int
+	}{
+		{SpendWindowDay, limits.Daily},
+		{SpendWindowWeek, limits.Weekly},
+		{SpendWindowMonth, limits.Monthly},
+	}
+	// 周和月的开始时间取较早者，一次查询取回所需的日记录
+	earliest := spendWindowStart(SpendWindowMonth, now)
+	if weekStart := spendWindowStart(SpendWindowWeek, now); weekStart.Before(earliest) {
+		earliest = weekStart
+	}
+	var spends []QuotaSpend
+	err := DB.Select("day", "used").
+		Where("subject_type = ? AND subject_id = ? AND day >= ?", subjectType, subjectId, spendDay(earliest)).
+		Find(&spends).Error
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]SpendLimitStatus, 0, len(windows))
+	for _, window := range windows {
+		if window.limit <= 0 {
+			continue
+		}
+		start := spendWindowStart(window.name, now)
+		startDay := spendDay(start)
+		var used int64
+		for _, spend := range spends {
+			if spend.Day >= startDay {
+				used += spend.Used
+			}
+		}
+		remaining := int64(window.limit) - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		statuses = append(statuses, SpendLimitStatus{
+			Window:    window.name,
+			Limit:     window.limit,
+			Used:      used,
+			Remaining: remaining,
+			ResetAt:   spendWindowReset(window.name, start).Unix(),
+		})
+	}
+	return statuses, nil
+}
+
+// GetMonthQuotaSpend 返回本月的消费额度及本月的起止时间
+func GetMonthQuotaSpend(subjectType string, subjectId int) (int64, time.Time, time.Time, error) {
+	start := spendWindowStart(SpendWindowMonth, time.Now())
+	end := spendWindowReset(SpendWindowMonth, start)
+	var used int64
+	err := DB.Model(&QuotaSpend{}).Select("COALESCE(SUM(used), 0)").
+		Where("subject_type = ? AND subject_id = ? AND day >= ?", subjectType, subjectId, spendDay(start)).
+		Scan(&used).Error
+	return used, start, end, err
+}
+
+// DeleteQuotaSpendBefore 清理早于指定日期的记录
+func DeleteQuotaSpendBefore(t time.Time) (int64, error) {
+	result := DB.Where("day < ?", spendDay(t)).Delete(&QuotaSpend{})
+	return result.RowsAffected, result.Error
+}
+
+// CleanupQuotaSpend 定期清理两个月前的消费记录
+func CleanupQuotaSpend() {
+	for {
+		rows, err := DeleteQuotaSpendBefore(time.Now().AddDate(0, -2, 0))
+		if err != nil {
+			common.SysLog("failed to cleanup quota spend: " + err.Error())
+		} else if rows > 0 {
+			common.SysLog("cleaned up " + strconv.FormatInt(rows, 10) + " quota spend records")
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"strconv"
+	"time"
+
+	"yunshuAPI/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 月度对账单所需的数据：每月初的余额快照，以及当月的充值、兑换、退款和消费汇总
+
+// UserQuotaSnapshot 每月第一天记录的用户余额，作为当月的期初余额和上月的期末余额
+type UserQuotaSnapshot struct {
+	Id        int   `json:"id"`
+	UserId    int   `json:"user_id" gorm:"uniqueIndex:idx_user_quota_snapshot_month"`
+	Month     int   `json:"month" gorm:"uniqueIndex:idx_user_quota_snapshot_month;index"` // 例如 202601
+	Quota     int   `json:"quota"`
+	CreatedAt int64 `json:"created_at" gorm:"bigint"`
+}
+
+// StatementMonth 将时间转换为 202601 形式的月份
+func StatementMonth(t time.Time) int {
+	month, _ := strconv.Atoi(t.Format("200601"))
+	return month
+}
+
+// SnapshotUserQuotas 为所有还没有该月快照的用户记录当前余额
+func SnapshotUserQuotas(month int) (int64, error) {
+	now := common.GetTimestamp()
+	var total int64
+	var users []User
+	err := DB.Model(&User{}).Select("id", "quota").FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+		snapshots := make([]UserQuotaSnapshot, 0, len(users))
+		for _, user := range users {
+			snapshots = append(snapshots, UserQuotaSnapshot{
+				UserId:    user.Id,
+				Month:     month,
+				Quota:     user.Quota,
+				CreatedAt: now,
+			})
+		}
+		result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&snapshots)
+		total += result.RowsAffected
+		return result.Error
+	}).Error
+	return total, err
+}
+
+// GetUserQuotaSnapshot 返回用户某月的余额快照，不存在时返回 nil
+func GetUserQuotaSnapshot(userId int, month int) (*UserQuotaSnapshot, error) {
+	var snapshots []UserQuotaSnapshot
+	err := DB.Where("user_id = ? AND month = ?", userId, month).Limit(1).Find(&snapshots).Error
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return &snapshots[0], nil
+}
+
+// CreditedQuota 返回充值订单实际增加的额度，计算方式与各支付方式的回调一致
+func (topUp *TopUp) CreditedQuota() int {
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return int(topUp.Money * common.QuotaPerUnit)
+	case "creem":
+		return int(topUp.Amount)
+	default:
+		return int(float64(topUp.Amount) * common.QuotaPerUnit)
+	}
+}
+
+// GetUserTopUpsBetween 返回时间范围内完成的充值订单
+func GetUserTopUpsBetween(userId int, start int64, end int64) (topUps []*TopUp, err error) {
+	err = DB.Where("user_id = ? AND status = ? AND complete_time >= ? AND complete_time < ?",
+		userId, common.TopUpStatusSuccess, start, end).Order("complete_time asc").Find(&topUps).Error
+	return topUps, err
+}
+
+// GetUserRedemptionsBetween 返回用户在时间范围内使用的兑换码，包含已删除的兑换码
+func GetUserRedemptionsBetween(userId int, start int64, end int64) (redemptions []*Redemption, err error) {
+	err = DB.Unscoped().Where("used_user_id = ? AND status = ? AND redeemed_time >= ? AND redeemed_time < ?",
+		userId, common.RedemptionCodeStatusUsed, start, end).Order("redeemed_time asc").Find(&redemptions).Error
+	return redemptions, err
+}
+
+// GetUserLogsBetween 返回时间范围内指定类型的日志
+func GetUserLogsBetween(userId int, logType int, start int64, end int64) (logs []*Log, err error) {
+	err = LOG_DB.Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?",
+		userId, logType, start, end).Order("id asc").Find(&logs).Error
+	return logs, err
+}
+
+// ConsumptionSummary 按模型和令牌汇总的消费
+type ConsumptionSummary struct {
+	ModelName        string `json:"model_name"`
+	TokenName        string `json:"token_name"`
+	Count            int64  `json:"count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// GetUserConsumptionSummary 汇总时间范围内的消费日志
+func GetUserConsumptionSummary(userId int, start int64, end int64) (summaries []ConsumptionSummary, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("model_name, token_name, count(*) as count, sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeConsume, start, end).
+		Group("model_name, token_name").
+		Order("model_name asc, token_name asc").
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+// RecordRefundLog 记录退款日志，quota 为退还的额度
+func RecordRefundLog(userId int, quota int, content string) {
+	username, _ := GetUsernameById(userId, false)
+	log := &Log{
+		UserId:    userId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeRefund,
+		Content:   content,
+		Quota:     quota,
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.SysLog("failed to record refund log: " + err.Error())
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"yunshuAPI/constant"
 	"yunshuAPI/dto"
 	commonRelay "yunshuAPI/relay/common"
+
+	"gorm.io/gorm"
 )
 
 type TaskStatus string
@@ -21,7 +23,7 @@ func (t TaskStatus) ToVideoStatus() string {
 		status = dto.VideoStatusInProgress
 	case TaskStatusSuccess:
 		status = dto.VideoStatusCompleted
-	case TaskStatusFailure:
+	case TaskStatusFailure, TaskStatusCancelled:
 		status = dto.VideoStatusFailed
 	default:
 		status = dto.VideoStatusUnknown // Default fallback
@@ -37,6 +39,7 @@ const (
 	TaskStatusFailure               = "FAILURE"
 	TaskStatusSuccess               = "SUCCESS"
 	TaskStatusUnknown               = "UNKNOWN"
+	TaskStatusCancelled             = "CANCELLED"
 )
 
 // Task 是数据库模型，包含所有字段
@@ -47,6 +50,7 @@ type Task struct {
 	TaskID     string                `json:"task_id" gorm:"type:varchar(191);index"` // 第三方id，不一定有/ song id\ Task id
 	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
 	UserId     int                   `json:"user_id" gorm:"index"`
+	TokenId    int                   `json:"token_id" gorm:"index"`         // 提交任务的令牌，退款时冲减令牌消费
 	Group      string                `json:"group" gorm:"type:varchar(50)"` // 修正计费组
 	ChannelId  int                   `json:"channel_id" gorm:"index"`
 	Quota      int                   `json:"quota"`
@@ -58,6 +62,10 @@ type Task struct {
 	FinishTime int64                 `json:"finish_time" gorm:"index"`
 	Progress   string                `json:"progress" gorm:"type:varchar(20);index"`
 	Properties Properties            `json:"properties" gorm:"type:json"`
+	// 任务完成（成功或失败）时回调的地址
+	CallbackUrl string `json:"callback_url,omitempty" gorm:"type:varchar(512);default:''"`
+	// 下次轮询上游的时间，由任务轮询调度按任务运行时间设置
+	NextPollAt int64 `json:"-" gorm:"index;default:0"`
 	// 禁止返回给用户，内部可能包含key等隐私信息
 	PrivateData TaskPrivateData `json:"-" gorm:"column:private_data;type:json"`
 	Data        json.RawMessage `json:"data" gorm:"type:json"`
@@ -170,6 +178,8 @@ func (m Properties) Value() (driver.Value, error) {
 
 type TaskPrivateData struct {
 	Key string `json:"key,omitempty"`
+	// 结果转存到网关存储后的文件 id
+	ArtifactId string `json:"artifact_id,omitempty"`
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -228,6 +238,9 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 		Properties:  properties,
 		PrivateData: privateData,
 	}
+	if !relayInfo.IsPlayground {
+		t.TokenId = relayInfo.TokenId
+	}
 	return t
 }
 
@@ -331,6 +344,44 @@ func GetAllUnFinishSyncTasks(limit int) []*Task {
 	return tasks
 }
 
+// unfinishedTaskQuery 尚未成功或失败的任务
+// IsFinished 任务是否已结束，与 unfinishedTaskQuery 的条件相反
+func (t *Task) IsFinished() bool {
+	switch t.Status {
+	case TaskStatusSuccess, TaskStatusFailure, TaskStatusCancelled:
+		return true
+	}
+	return t.Progress == "100%"
+}
+
+func unfinishedTaskQuery() *gorm.DB {
+	return DB.Model(&Task{}).Where("progress != ?", "100%").Where("status not in (?)", []TaskStatus{TaskStatusFailure, TaskStatusSuccess, TaskStatusCancelled})
+}
+
+type TaskPlatformCount struct {
+	Platform constant.TaskPlatform `json:"platform"`
+	Count    int                   `json:"count"`
+}
+
+// CountUnfinishedTasksByPlatform 按平台统计未完成的任务数
+func CountUnfinishedTasksByPlatform() ([]TaskPlatformCount, error) {
+	var counts []TaskPlatformCount
+	err := unfinishedTaskQuery().Select("platform, count(*) as count").Group("platform").Scan(&counts).Error
+	return counts, err
+}
+
+// GetDueUnfinishedTasks 取出平台中到了轮询时间的未完成任务，最久未轮询的优先
+func GetDueUnfinishedTasks(platform constant.TaskPlatform, now int64, limit int) ([]*Task, error) {
+	var tasks []*Task
+	err := unfinishedTaskQuery().Where("platform = ? and next_poll_at <= ?", platform, now).
+		Order("next_poll_at, id").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
+func TaskUpdateNextPollAt(id int64, nextPollAt int64) error {
+	return DB.Model(&Task{}).Where("id = ?", id).Update("next_poll_at", nextPollAt).Error
+}
+
 func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -378,6 +429,25 @@ func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
 
+func GetTaskById(id int64) (*Task, error) {
+	var task Task
+	err := DB.Where("id = ?", id).First(&task).Error
+	return &task, err
+}
+
+// TaskSetQuotaIfUnfinished 任务尚未成功或失败时更新扣费额度，返回是否更新成功
+func TaskSetQuotaIfUnfinished(id int64, quota int) (bool, error) {
+	result := DB.Model(&Task{}).Where("id = ? and status not in (?)", id, []TaskStatus{TaskStatusSuccess, TaskStatusFailure, TaskStatusCancelled}).
+		Update("quota", quota)
+	return result.RowsAffected > 0, result.Error
+}
+
+// TaskSetQuotaUnlessFailed 记录任务的实际扣费，已失败或已取消的任务保持退款时的额度
+func TaskSetQuotaUnlessFailed(id int64, quota int) error {
+	return DB.Model(&Task{}).Where("id = ? and status not in (?)", id, []TaskStatus{TaskStatusFailure, TaskStatusCancelled}).
+		Update("quota", quota).Error
+}
+
 func (Task *Task) Insert() error {
 	var err error
 	err = DB.Create(Task).Error
@@ -390,6 +460,38 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// UpdateWithStatus 仅在任务状态仍为 preStatus 时保存，避免多个轮询、超时处理或取消重复完成同一任务，返回是否保存成功
+func (t *Task) UpdateWithStatus(preStatus TaskStatus) (bool, error) {
+	result := DB.Model(t).Where("status = ?", preStatus).Select("*").Updates(t)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateArtifact 只保存转存结果所在的字段，避免覆盖转存期间轮询写入的其他字段
+func (t *Task) UpdateArtifact() error {
+	return DB.Model(t).Select("fail_reason", "private_data").Updates(t).Error
+}
+
+// Cancel 将未结束的任务标记为已取消，返回是否取消成功
+func (t *Task) Cancel(reason string) (bool, error) {
+	finishTime := time.Now().Unix()
+	result := DB.Model(&Task{}).Where("id = ? and status not in (?)", t.ID,
+		[]TaskStatus{TaskStatusSuccess, TaskStatusFailure, TaskStatusCancelled}).
+		Updates(map[string]any{
+			"status":      TaskStatusCancelled,
+			"progress":    "100%",
+			"finish_time": finishTime,
+			"fail_reason": reason,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	t.Status = TaskStatusCancelled
+	t.Progress = "100%"
+	t.FinishTime = finishTime
+	t.FailReason = reason
+	return true, nil
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -0,0 +1,80 @@
+package model
+
+import "yunshuAPI/common"
+
+const (
+	TaskCallbackStatusPending = "pending"
+	TaskCallbackStatusSuccess = "success"
+	TaskCallbackStatusFailed  = "failed"
+)
+
+const (
+	TaskCallbackTypeTask       = "task"
+	TaskCallbackTypeMidjourney = "midjourney"
+)
+
+// TaskCallbackDelivery 异步任务完成回调的投递记录，同时作为待重试的投递队列
+type TaskCallbackDelivery struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TaskType       string `json:"task_type" gorm:"type:varchar(20)"`
+	TaskId         string `json:"task_id" gorm:"type:varchar(191);index"`
+	Url            string `json:"url" gorm:"type:varchar(512)"`
+	Event          string `json:"event" gorm:"type:varchar(40)"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(20);index:idx_task_callback_due,priority:1"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index:idx_task_callback_due,priority:2"`
+	LastStatusCode int    `json:"last_status_code"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (delivery *TaskCallbackDelivery) Insert() error {
+	now := common.GetTimestamp()
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	return DB.Create(delivery).Error
+}
+
+func (delivery *TaskCallbackDelivery) Update() error {
+	delivery.UpdatedAt = common.GetTimestamp()
+	return DB.Save(delivery).Error
+}
+
+// GetDueTaskCallbackDeliveries 返回到达重试时间的待投递记录
+func GetDueTaskCallbackDeliveries(limit int) (deliveries []*TaskCallbackDelivery, err error) {
+	err = DB.Where("status = ? AND next_attempt_at <= ?", TaskCallbackStatusPending, common.GetTimestamp()).
+		Order("next_attempt_at asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func GetTaskCallbackDeliveryById(id int, userId int) (*TaskCallbackDelivery, error) {
+	delivery := &TaskCallbackDelivery{}
+	tx := DB.Where("id = ?", id)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err := tx.First(delivery).Error
+	return delivery, err
+}
+
+// GetTaskCallbackDeliveries 分页查询投递记录，userId 为 0 时查询全部用户
+func GetTaskCallbackDeliveries(userId int, taskId string, status string, startIdx int, num int) (deliveries []*TaskCallbackDelivery, total int64, err error) {
+	tx := DB.Model(&TaskCallbackDelivery{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if taskId != "" {
+		tx = tx.Where("task_id = ?", taskId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, total, err
+}
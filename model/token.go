@@ -27,9 +27,24 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	DailyQuotaLimit    int            `json:"daily_quota_limit" gorm:"default:0"`               // 每日消费上限，0 表示不限制
+	WeeklyQuotaLimit   int            `json:"weekly_quota_limit" gorm:"default:0"`              // 每周消费上限
+	MonthlyQuotaLimit  int            `json:"monthly_quota_limit" gorm:"default:0"`             // 每月消费上限
+	RpmLimit           int            `json:"rpm_limit" gorm:"default:0"`                       // 每分钟请求数限制，0 表示不限制
+	TpmLimit           int            `json:"tpm_limit" gorm:"default:0"`                       // 每分钟 token 数限制
+	ConcurrencyLimit   int            `json:"concurrency_limit" gorm:"default:0"`               // 最大并发请求数
+	CallbackUrl        string         `json:"callback_url" gorm:"type:varchar(512);default:''"` // 异步任务默认的完成回调地址
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
+func (token *Token) GetSpendLimits() SpendLimits {
+	return SpendLimits{
+		Daily:   token.DailyQuotaLimit,
+		Weekly:  token.WeeklyQuotaLimit,
+		Monthly: token.MonthlyQuotaLimit,
+	}
+}
+
 func (token *Token) Clean() {
 	token.Key = ""
 }
@@ -185,7 +200,9 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group",
+		"daily_quota_limit", "weekly_quota_limit", "monthly_quota_limit",
+		"rpm_limit", "tpm_limit", "concurrency_limit", "callback_url").Updates(token).Error
 	return err
 }
 
@@ -46,6 +46,10 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	// 日/周/月消费上限，0 表示不限制
+	DailyQuotaLimit   int `json:"daily_quota_limit" gorm:"type:int;default:0"`
+	WeeklyQuotaLimit  int `json:"weekly_quota_limit" gorm:"type:int;default:0"`
+	MonthlyQuotaLimit int `json:"monthly_quota_limit" gorm:"type:int;default:0"`
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -57,6 +61,10 @@ func (user *User) ToBaseUser() *UserBase {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+
+		DailyQuotaLimit:   user.DailyQuotaLimit,
+		WeeklyQuotaLimit:  user.WeeklyQuotaLimit,
+		MonthlyQuotaLimit: user.MonthlyQuotaLimit,
 	}
 	return cache
 }
@@ -484,6 +492,10 @@ func (user *User) Edit(updatePassword bool) error {
 		"group":        newUser.Group,
 		"quota":        newUser.Quota,
 		"remark":       newUser.Remark,
+
+		"daily_quota_limit":   newUser.DailyQuotaLimit,
+		"weekly_quota_limit":  newUser.WeeklyQuotaLimit,
+		"monthly_quota_limit": newUser.MonthlyQuotaLimit,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
@@ -22,6 +22,18 @@ type UserBase struct {
 	Status   int    `json:"status"`
 	Username string `json:"username"`
 	Setting  string `json:"setting"`
+
+	DailyQuotaLimit   int `json:"daily_quota_limit"`
+	WeeklyQuotaLimit  int `json:"weekly_quota_limit"`
+	MonthlyQuotaLimit int `json:"monthly_quota_limit"`
+}
+
+func (user *UserBase) GetSpendLimits() SpendLimits {
+	return SpendLimits{
+		Daily:   user.DailyQuotaLimit,
+		Weekly:  user.WeeklyQuotaLimit,
+		Monthly: user.MonthlyQuotaLimit,
+	}
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -107,6 +119,10 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+
+		DailyQuotaLimit:   user.DailyQuotaLimit,
+		WeeklyQuotaLimit:  user.WeeklyQuotaLimit,
+		MonthlyQuotaLimit: user.MonthlyQuotaLimit,
 	}
 
 	return userCache, nil
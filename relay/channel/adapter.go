@@ -55,3 +55,8 @@ type TaskAdaptor interface {
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
+
+// TaskCanceler 支持取消上游任务的 TaskAdaptor 实现，未实现的平台不允许取消任务
+type TaskCanceler interface {
+	Cancel(baseUrl, key string, task *model.Task) error
+}
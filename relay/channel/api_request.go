@@ -18,6 +18,7 @@ import (
 	"yunshuAPI/relay/helper"
 	"yunshuAPI/service"
 	"yunshuAPI/setting/operation_setting"
+	"yunshuAPI/tracing"
 	"yunshuAPI/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -260,6 +261,13 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		println("doRequest - req.URL.Host:", req.URL.Host)
 		println("doRequest - req.URL.Path:", req.URL.Path)
 	}
+	if info.HedgeGate != nil {
+		// 对冲请求失败方会被取消，需要随请求上下文中止上游调用
+		req = req.WithContext(c.Request.Context())
+	}
+	if !info.ChannelOtherSettings.DisableTracePropagation {
+		tracing.InjectHeaders(c.Request.Context(), req.Header)
+	}
 	var client *http.Client
 	var err error
 	if info.ChannelSetting.Proxy != "" {
@@ -308,6 +316,7 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
+	info.WrapUpstreamResponse(resp)
 	return resp, nil
 }
 
@@ -372,3 +381,22 @@ func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.RelayInfo, req
 	}
 	return resp, nil
 }
+
+// DoTaskCancelRequest 调用上游的取消任务接口，非 2xx 响应视为取消失败
+func DoTaskCancelRequest(method, url string, header http.Header) error {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return fmt.Errorf("new request failed: %w", err)
+	}
+	req.Header = header
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("do request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -9,9 +9,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"yunshuAPI/common"
+	"yunshuAPI/constant"
 	"yunshuAPI/dto"
 	"yunshuAPI/logger"
 	"yunshuAPI/model"
@@ -21,6 +21,7 @@ import (
 	"yunshuAPI/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 // ChannelName 渠道名称
@@ -476,17 +477,39 @@ func (k *KieaiAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *rel
 
 		logger.LogDebug(ctx, "[KIEAI] Sora-2 video task created with ID: %s", kieaiResp.Data.TaskId)
 
-		// 立即轮询获取结果
-		pollResult, pollErr := k.pollVideoResult(c, info, kieaiResp.Data.TaskId)
-		if pollErr != nil {
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Polling video result failed: %v", pollErr))
-			// 轮询失败时返回错误信�?
-			return nil, types.NewErrorWithStatusCode(pollErr, types.ErrorCodeInvalidRequest, 400)
+		// 记录为异步任务交给后台轮询，请求最多等待设置的时间，未完成时返回排队中的视频对象
+		task, taskErr := service.CreateAsyncTask(c, info, constant.TaskActionGenerate, kieaiResp.Data.TaskId, body)
+		if taskErr == nil {
+			task, taskErr = service.WaitAsyncTask(c, info, task)
+		}
+		if taskErr != nil {
+			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Waiting for video task failed: %v", taskErr))
+			return nil, types.NewErrorWithStatusCode(taskErr, types.ErrorCodeBadResponse, 500)
+		}
+		if task.Status == model.TaskStatusFailure || task.Status == model.TaskStatusCancelled {
+			failReason := task.FailReason
+			if failReason == "" {
+				failReason = "Video generation failed"
+			}
+			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Video generation failed: %s", failReason))
+			return nil, types.NewErrorWithStatusCode(errors.New(failReason), types.ErrorCodeInvalidRequest, 400)
 		}
 
-		// 将轮询结果转换为OpenAI格式响应
+		videoResponse := &dto.OpenAIVideo{
+			ID:        task.TaskID,
+			Status:    task.Status.ToVideoStatus(),
+			CreatedAt: task.SubmitTime,
+			Model:     "sora-2",
+			Object:    "video",
+			Seconds:   videoSeconds(task.Data),
+		}
+		videoResponse.SetProgressStr(task.Progress)
+		if task.Status == model.TaskStatusSuccess {
+			videoResponse.CompletedAt = task.FinishTime
+			videoResponse.SetMetadata("url", task.FailReason)
+		}
 		if httpResp != nil {
-			openAIRespBody, _ := json.Marshal(pollResult)
+			openAIRespBody, _ := json.Marshal(videoResponse)
 			httpResp.Body = io.NopCloser(bytes.NewBuffer(openAIRespBody))
 		}
 
@@ -499,166 +522,14 @@ func (k *KieaiAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *rel
 	}
 }
 
-// pollVideoResult 轮询视频生成结果
-func (k *KieaiAdaptor) pollVideoResult(c *gin.Context, info *relaycommon.RelayInfo, taskId string) (*dto.OpenAIVideo, error) {
-	ctx := c.Request.Context()
-	logger.LogDebug(ctx, "[KIEAI] Polling video result for task ID: %s", taskId)
-
-	// 轮询参数
-	maxAttempts := 30
-	attempts := 0
-	interval := time.Second * 5
-
-	// 轮询循环
-	for attempts < maxAttempts {
-		attempts++
-		logger.LogDebug(ctx, "[KIEAI] Poll attempt %d/%d for task ID: %s", attempts, maxAttempts, taskId)
-
-		// 构建轮询URL
-		pollURL := "https://api.kie.ai/api/v1/jobs/recordInfo?taskId=" + taskId
-
-		// 创建请求
-		req, err := http.NewRequest("GET", pollURL, nil)
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Creating poll request failed: %v", err))
-			return nil, err
-		}
-
-		// 设置请求�?
-		req.Header.Set("Authorization", "Bearer "+k.apiKey)
-
-		// 发送请�?
-		client := service.GetHttpClient()
-		resp, err := client.Do(req)
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Poll request failed: %v", err))
-			// 轮询失败，继续下一次尝�?
-			time.Sleep(interval)
-			continue
-		}
-
-		// 读取响应�?
-		respBody, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Reading poll response failed: %v", err))
-			// 轮询失败，继续下一次尝�?
-			time.Sleep(interval)
-			continue
-		}
-
-		logger.LogDebug(ctx, "[KIEAI] Poll response: %s", string(respBody))
-
-		// 解析响应
-		var pollResp struct {
-			Code int    `json:"code"`
-			Msg  string `json:"msg"`
-			Data struct {
-				TaskId       string  `json:"taskId"`
-				Model        string  `json:"model"`
-				State        string  `json:"state"`
-				Param        string  `json:"param"`
-				ResultJson   string  `json:"resultJson"`
-				FailCode     *string `json:"failCode"`
-				FailMsg      *string `json:"failMsg"`
-				CostTime     int64   `json:"costTime"`
-				CompleteTime int64   `json:"completeTime"`
-				CreateTime   int64   `json:"createTime"`
-			} `json:"data"`
-		}
-
-		if err := json.Unmarshal(respBody, &pollResp); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Parsing poll response failed: %v", err))
-			// 轮询失败，继续下一次尝�?
-			time.Sleep(interval)
-			continue
-		}
-
-		if pollResp.Code != 200 {
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Poll request returned error: %s", pollResp.Msg))
-			// 轮询失败，继续下一次尝�?
-			time.Sleep(interval)
-			continue
-		}
-
-		// 检查任务状�?
-		switch pollResp.Data.State {
-		case "success":
-			// 任务完成，解析结�?
-			logger.LogDebug(ctx, "[KIEAI] Video generation completed successfully")
-
-			// 解析resultJson获取视频URL
-			var resultJson struct {
-				ResultUrls []string `json:"resultUrls"`
-			}
-			videoUrl := ""
-			if err := json.Unmarshal([]byte(pollResp.Data.ResultJson), &resultJson); err == nil && len(resultJson.ResultUrls) > 0 {
-				videoUrl = resultJson.ResultUrls[0]
-				// 清理URL中的反引号和空格
-				videoUrl = strings.Trim(videoUrl, " `")
-			}
-
-			// 解析param获取n_frames作为seconds
-			seconds := "15" // 默认�?
-			if pollResp.Data.Param != "" {
-				// 先解析param的外层结�?
-				var paramOuter struct {
-					Input string `json:"input"`
-				}
-				if err := json.Unmarshal([]byte(pollResp.Data.Param), &paramOuter); err == nil {
-					// 解析input字段
-					var paramInput struct {
-						NFrames string `json:"n_frames"`
-					}
-					if err := json.Unmarshal([]byte(paramOuter.Input), &paramInput); err == nil && paramInput.NFrames != "" {
-						seconds = paramInput.NFrames
-					}
-				}
-			}
-
-			logger.LogDebug(ctx, "[KIEAI] Extracted video URL: %s, seconds: %s", videoUrl, seconds)
-
-			// 构造OpenAI格式的视频响�?
-			videoResponse := &dto.OpenAIVideo{
-				ID:        taskId,
-				Status:    dto.VideoStatusCompleted,
-				CreatedAt: pollResp.Data.CreateTime,
-				Model:     "sora-2",
-				Object:    "video",
-				Seconds:   seconds,
-				Progress:  100,
-			}
-			videoResponse.SetMetadata("url", videoUrl)
-
-			return videoResponse, nil
-		case "fail":
-			// 任务失败，返回错误信�?
-			errorMsg := "Video generation failed"
-			if pollResp.Data.FailMsg != nil && *pollResp.Data.FailMsg != "" {
-				errorMsg = *pollResp.Data.FailMsg
-			}
-			if pollResp.Data.FailCode != nil && *pollResp.Data.FailCode != "" {
-				errorMsg = fmt.Sprintf("%s (Code: %s)", errorMsg, *pollResp.Data.FailCode)
-			}
-			logger.LogError(ctx, fmt.Sprintf("[KIEAI] Video generation failed: %s", errorMsg))
-			return nil, errors.New(errorMsg)
-		case "waiting", "queuing", "generating":
-			// 任务未完成，继续轮询
-			logger.LogDebug(ctx, "[KIEAI] Video generation state: %s, continuing to poll", pollResp.Data.State)
-			time.Sleep(interval)
-			continue
-		default:
-			// 未知状态，继续轮询
-			logger.LogDebug(ctx, "[KIEAI] Video generation state: %s, continuing to poll", pollResp.Data.State)
-			time.Sleep(interval)
-			continue
-		}
+// videoSeconds 从任务详情的 param.input.n_frames 中取视频时长，取不到时为 15 秒
+func videoSeconds(data []byte) string {
+	param := gjson.GetBytes(data, "data.param").String()
+	input := gjson.Get(param, "input").String()
+	if seconds := gjson.Get(input, "n_frames").String(); seconds != "" {
+		return seconds
 	}
-
-	// 轮询超时
-	errorMsg := "Video generation polling timed out"
-	logger.LogError(ctx, "[KIEAI] Video generation polling timed out")
-	return nil, errors.New(errorMsg)
+	return "15"
 }
 
 // GetModelList 获取支持的模型列�?
@@ -899,14 +770,12 @@ func (t *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 		} else {
 			taskInfo.Reason = "Video generation failed"
 		}
-	case "waiting", "queuing", "generating":
-		// 任务正在处理�?
-		taskInfo.Status = "PENDING"
-		taskInfo.Reason = "Task is still processing"
+	case "waiting", "queuing":
+		// 任务排队中
+		taskInfo.Status = model.TaskStatusQueued
 	default:
-		// 未知状�?
-		taskInfo.Status = "PENDING"
-		taskInfo.Reason = "Task is still processing"
+		// generating 及未知状态按处理中继续轮询
+		taskInfo.Status = model.TaskStatusInProgress
 	}
 
 	return taskInfo, nil
@@ -938,7 +807,7 @@ func (t *TaskAdaptor) ConvertToOpenAIVideo(originTask *model.Task) ([]byte, erro
 	switch originTask.Status {
 	case model.TaskStatusSuccess:
 		videoResponse.Status = "completed"
-	case model.TaskStatusFailure:
+	case model.TaskStatusFailure, model.TaskStatusCancelled:
 		videoResponse.Status = "failed"
 	case model.TaskStatusInProgress:
 		videoResponse.Status = "processing"
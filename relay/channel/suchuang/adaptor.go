@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"yunshuAPI/common"
+	"yunshuAPI/constant"
 	"yunshuAPI/dto"
 	"yunshuAPI/logger"
 	"yunshuAPI/model"
@@ -22,6 +23,7 @@ import (
 	"yunshuAPI/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 // removeThinkContent 移除内容中的<think>标签部分
@@ -846,18 +848,35 @@ func (s *SuchuangAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *
 
 		logger.LogDebug(ctx, "[SUCHUANG] Image task created with ID: %d", createTaskResp.Data.ID)
 
-		// 立即轮询获取结果
-		pollResult, pollErr := s.pollImageResult(c, info, createTaskResp.Data.ID)
-		if pollErr != nil {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Polling image result failed: %v", pollErr))
-			// 轮询失败时返回错误信息，而不是空URL
-			return nil, types.NewErrorWithStatusCode(pollErr, types.ErrorCodeInvalidRequest, 400)
+		// 记录为异步任务交给后台轮询，请求最多等待设置的时间，未完成时返回任务对象
+		task, taskErr := service.CreateAsyncTask(c, info, constant.TaskActionImageGenerate, strconv.Itoa(createTaskResp.Data.ID), body)
+		if taskErr == nil {
+			task, taskErr = service.WaitAsyncTask(c, info, task)
+		}
+		if taskErr != nil {
+			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Waiting for image task failed: %v", taskErr))
+			return nil, types.NewErrorWithStatusCode(taskErr, types.ErrorCodeBadResponse, 500)
 		}
 
-		// 将轮询结果转换为OpenAI格式响应
+		var respBody []byte
+		switch task.Status {
+		case model.TaskStatusFailure, model.TaskStatusCancelled:
+			failReason := task.FailReason
+			if failReason == "" {
+				failReason = "Image generation failed"
+			}
+			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Image generation failed: %s", failReason))
+			return nil, types.NewErrorWithStatusCode(errors.New(failReason), types.ErrorCodeInvalidRequest, 400)
+		case model.TaskStatusSuccess:
+			respBody, _ = json.Marshal(dto.ImageResponse{
+				Data:    []dto.ImageData{{Url: task.FailReason}},
+				Created: time.Now().Unix(),
+			})
+		default:
+			respBody, _ = json.Marshal(service.ImageTaskResponse(task))
+		}
 		if httpResp != nil {
-			openAIRespBody, _ := json.Marshal(pollResult)
-			httpResp.Body = io.NopCloser(bytes.NewBuffer(openAIRespBody))
+			httpResp.Body = io.NopCloser(bytes.NewBuffer(respBody))
 		}
 
 		return &dto.Usage{}, nil
@@ -1466,8 +1485,11 @@ func (t *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 		return nil, fmt.Errorf("invalid task_id")
 	}
 
-	// 构建轮询URL
+	// 构建轮询URL，图片任务由同步图片接口创建
 	url := fmt.Sprintf("https://api.wuyinkeji.com/api/sora2/detail?id=%s", taskID)
+	if action, _ := body["action"].(string); action == constant.TaskActionImageGenerate {
+		url = fmt.Sprintf("%s/api/img/drawDetail?id=%s", strings.TrimRight(baseUrl, "/"), taskID)
+	}
 
 	// 创建GET请求
 	req, err := http.NewRequest(http.MethodGet, url, nil)
@@ -1485,6 +1507,10 @@ func (t *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 // ParseTaskResult 解析任务结果
 // 实现channel.TaskAdaptor接口的ParseTaskResult方法
 func (t *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	if gjson.GetBytes(respBody, "data.image_url").Exists() {
+		return parseImageTaskResult(respBody)
+	}
+
 	// 解析响应
 	var suchuangResp struct {
 		Code int    `json:"code"`
@@ -1552,6 +1578,48 @@ func (t *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	return taskResult, nil
 }
 
+// parseImageTaskResult 解析图片任务详情，status 2 表示完成，3 表示失败
+func parseImageTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var detailResp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			ID         int    `json:"id"`
+			Status     int    `json:"status"`
+			ImageURL   string `json:"image_url"`
+			FailReason string `json:"fail_reason"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &detailResp); err != nil {
+		return nil, err
+	}
+	if detailResp.Code != 200 {
+		return nil, errors.New(detailResp.Msg)
+	}
+
+	taskResult := &relaycommon.TaskInfo{
+		Code:   0,
+		TaskID: strconv.Itoa(detailResp.Data.ID),
+	}
+	switch detailResp.Data.Status {
+	case 2:
+		taskResult.Status = model.TaskStatusSuccess
+		taskResult.Progress = "100%"
+		taskResult.Url = detailResp.Data.ImageURL
+	case 3:
+		taskResult.Status = model.TaskStatusFailure
+		taskResult.Progress = "100%"
+		taskResult.Reason = detailResp.Data.FailReason
+		if taskResult.Reason == "" {
+			taskResult.Reason = "Image generation failed"
+		}
+	default:
+		taskResult.Status = model.TaskStatusInProgress
+		taskResult.Progress = "50%"
+	}
+	return taskResult, nil
+}
+
 // GetModelList 获取支持的模型列�?
 // 实现channel.TaskAdaptor接口的GetModelList方法
 func (t *TaskAdaptor) GetModelList() []string {
@@ -1620,179 +1688,3 @@ func (t *TaskAdaptor) ConvertToOpenAIVideo(task *model.Task) ([]byte, error) {
 	// 序列化响应为JSON
 	return json.Marshal(response)
 }
-
-// createImageTask 创建图片生成任务
-// 接收gin.Context、relaycommon.RelayInfo和io.Reader参数
-// 调用速创API创建图片生成任务
-// 返回任务ID和错误信�?
-func (s *SuchuangAdaptor) createImageTask(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (int, error) {
-	ctx := c.Request.Context()
-
-	// 获取请求URL
-	fullURL, err := s.GetRequestURL(info)
-	if err != nil {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] GetRequestURL failed: %v", err))
-		return 0, err
-	}
-
-	// 创建请求
-	req, err := http.NewRequest("POST", fullURL, requestBody)
-	if err != nil {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] New request failed: %v", err))
-		return 0, err
-	}
-
-	// 设置请求�?
-	if err := s.SetupRequestHeader(c, &req.Header, info); err != nil {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] SetupRequestHeader failed: %v", err))
-		return 0, err
-	}
-
-	// 发送请�?
-	client := service.GetHttpClient()
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Client Do failed: %v", err))
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	// 读取响应�?
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Read response body failed: %v", err))
-		return 0, err
-	}
-
-	// 解析响应
-	var result struct {
-		Msg  string `json:"msg"`
-		Data struct {
-			ID int `json:"id"`
-		} `json:"data"`
-		Code     int     `json:"code"`
-		ExecTime float64 `json:"exec_time,omitempty"`
-		IP       string  `json:"ip,omitempty"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Unmarshal response failed: %v, body: %s", err, string(body)))
-		return 0, err
-	}
-
-	if result.Code != 200 {
-		logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] API returned error: %s, code: %d", result.Msg, result.Code))
-		return 0, errors.New(result.Msg)
-	}
-
-	logger.LogDebug(ctx, "[SUCHUANG] Created image task with ID: %d", result.Data.ID)
-	return result.Data.ID, nil
-}
-
-// pollImageResult 轮询图片生成结果
-// 接收gin.Context、relaycommon.RelayInfo和任务ID参数
-// 轮询速创API获取图片生成结果
-// 返回OpenAI格式的响应数据和错误信息
-func (s *SuchuangAdaptor) pollImageResult(c *gin.Context, info *relaycommon.RelayInfo, taskID int) (any, error) {
-	ctx := c.Request.Context()
-
-	// 构造轮询URL（使用GET方法，参数通过查询字符串传递）
-	pollURL := fmt.Sprintf("%s/api/img/drawDetail?id=%d", s.baseURL, taskID)
-
-	// 设置轮询间隔（不设置超时，与视频生成保持一致）
-	pollInterval := 2 * time.Second
-
-	// 轮询获取结果
-	for {
-		// 创建GET请求
-		req, err := http.NewRequest("GET", pollURL, nil)
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] New poll request failed: %v", err))
-			return nil, err
-		}
-
-		// 设置请求�?
-		if err := s.SetupRequestHeader(c, &req.Header, info); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Setup poll request header failed: %v", err))
-			return nil, err
-		}
-
-		// 发送请�?
-		client := service.GetHttpClient()
-		resp, err := client.Do(req)
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Client Do failed: %v", err))
-			return nil, err
-		}
-
-		// 读取响应�?
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Read poll response body failed: %v", err))
-			return nil, err
-		}
-
-		// 解析响应
-		var pollResult struct {
-			Code int    `json:"code"`
-			Msg  string `json:"msg"`
-			Data struct {
-				ID         int    `json:"id"`
-				TaskID     string `json:"task_id"`
-				Status     int    `json:"status"` // 2表示完成
-				Size       string `json:"size"`
-				Prompt     string `json:"prompt"`
-				ImageURL   string `json:"image_url"`
-				FailReason string `json:"fail_reason"`
-				CreatedAt  string `json:"created_at"`
-				UpdatedAt  string `json:"updated_at"`
-			} `json:"data"`
-			ExecTime float64 `json:"exec_time"`
-			IP       string  `json:"ip"`
-		}
-
-		if err := json.Unmarshal(body, &pollResult); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Unmarshal poll response failed: %v, body: %s", err, string(body)))
-			return nil, err
-		}
-
-		if pollResult.Code != 200 {
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Poll API returned error: %s, code: %d", pollResult.Msg, pollResult.Code))
-			return nil, errors.New(pollResult.Msg)
-		}
-
-		// 检查任务状�?
-		if pollResult.Data.Status == 2 {
-			// 任务完成，转换为OpenAI格式响应
-			openAIResp := struct {
-				Data []struct {
-					URL string `json:"url"`
-				} `json:"data"`
-				Created int64 `json:"created"`
-			}{
-				Data: []struct {
-					URL string `json:"url"`
-				}{{pollResult.Data.ImageURL}},
-				Created: time.Now().Unix(),
-			}
-
-			logger.LogDebug(ctx, "[SUCHUANG] Image generation completed successfully")
-			return openAIResp, nil
-		}
-
-		// 检查任务是否失败（status=3�?
-		if pollResult.Data.Status == 3 {
-			// 任务失败，返回失败原�?
-			failReason := pollResult.Data.FailReason
-			if failReason == "" {
-				failReason = "Image generation failed"
-			}
-			logger.LogError(ctx, fmt.Sprintf("[SUCHUANG] Image generation failed: %s", failReason))
-			return nil, errors.New(failReason)
-		}
-
-		// 等待一段时间后继续轮询（不检查超时，与视频生成保持一致）
-		time.Sleep(pollInterval)
-	}
-}
@@ -428,6 +428,13 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// Cancel 取消排队中的任务，DashScope 只允许取消尚未开始执行的任务
+func (a *TaskAdaptor) Cancel(baseUrl, key string, task *model.Task) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+key)
+	return channel.DoTaskCancelRequest(http.MethodPost, fmt.Sprintf("%s/api/v1/tasks/%s/cancel", baseUrl, task.TaskID), header)
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
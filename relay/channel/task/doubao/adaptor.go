@@ -166,6 +166,14 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// Cancel 取消排队中的任务
+func (a *TaskAdaptor) Cancel(baseUrl, key string, task *model.Task) error {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	header.Set("Authorization", "Bearer "+key)
+	return channel.DoTaskCancelRequest(http.MethodDelete, fmt.Sprintf("%s/api/v3/contents/generations/tasks/%s", baseUrl, task.TaskID), header)
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
@@ -427,6 +427,13 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// Cancel 删除上游视频任务
+func (a *TaskAdaptor) Cancel(baseUrl, key string, task *model.Task) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+key)
+	return channel.DoTaskCancelRequest(http.MethodDelete, fmt.Sprintf("%s/v1/videos/%s", baseUrl, task.TaskID), header)
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
@@ -128,6 +128,7 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 				return types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
 			}
 		}
+		info.CaptureUpstreamBody(jsonData)
 
 		if common.DebugEnabled {
 			println("requestBody: ", string(jsonData))
@@ -0,0 +1,31 @@
+package common
+
+import "sync"
+
+// HedgeGate 对冲请求的计费闸门，同一请求的多个并行尝试中只有第一个成功的尝试可以计费
+type HedgeGate struct {
+	mu     sync.Mutex
+	winner int
+}
+
+func NewHedgeGate() *HedgeGate {
+	return &HedgeGate{winner: -1}
+}
+
+// Claim 尝试成为获胜者，同一尝试重复调用返回相同结果
+func (g *HedgeGate) Claim(attempt int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.winner == -1 {
+		g.winner = attempt
+	}
+	return g.winner == attempt
+}
+
+// ClaimBilling 非对冲请求始终返回 true；对冲请求只有获胜的尝试返回 true
+func (info *RelayInfo) ClaimBilling() bool {
+	if info.HedgeGate == nil {
+		return true
+	}
+	return info.HedgeGate.Claim(info.HedgeAttempt)
+}
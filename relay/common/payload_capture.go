@@ -0,0 +1,160 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// sse 单行的最大长度，超出的行不参与拼接，避免异常响应占用过多内存
+const payloadCaptureMaxLine = 1 << 20
+
+// PayloadCaptureMaxResponseSize 响应最多缓存的字节数，超出时不保存响应内容，避免保存无法按 JSON 脱敏的片段
+const PayloadCaptureMaxResponseSize = 16 << 20
+
+// PayloadCapture 调试抓取一次请求的入站请求体、转换后的上游请求体和上游响应。
+// 内容完整保存，脱敏后再按大小截断；流式响应只保存从 SSE 事件中拼接出的文本
+type PayloadCapture struct {
+	mu           sync.Mutex
+	requestBody  []byte
+	upstreamBody []byte
+	response     *payloadCaptureBuffer
+}
+
+func NewPayloadCapture(requestBody []byte) *PayloadCapture {
+	return &PayloadCapture{requestBody: bytes.Clone(requestBody)}
+}
+
+// Snapshot 返回抓取到的内容，stream 表示响应内容是从流式事件中拼接的文本，overflow 表示响应超出缓存上限未保存
+func (p *PayloadCapture) Snapshot() (requestBody, upstreamBody, response []byte, stream bool, overflow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.response != nil {
+		p.response.mu.Lock()
+		response = bytes.Clone(p.response.buf.Bytes())
+		stream = p.response.stream
+		overflow = p.response.overflow
+		p.response.mu.Unlock()
+	}
+	return p.requestBody, p.upstreamBody, response, stream, overflow
+}
+
+// CaptureUpstreamBody 记录发往上游的请求体，重试时保留最后一次
+func (info *RelayInfo) CaptureUpstreamBody(body []byte) {
+	p := info.PayloadCapture
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.upstreamBody = bytes.Clone(body)
+}
+
+// WrapUpstreamResponse 包装上游响应体，在读取的同时记录内容，重试时保留最后一次
+func (info *RelayInfo) WrapUpstreamResponse(resp *http.Response) {
+	p := info.PayloadCapture
+	if p == nil || resp == nil || resp.Body == nil {
+		return
+	}
+	buf := &payloadCaptureBuffer{
+		stream: info.IsStream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"),
+	}
+	p.mu.Lock()
+	p.response = buf
+	p.mu.Unlock()
+	resp.Body = &payloadCaptureReader{ReadCloser: resp.Body, buf: buf}
+}
+
+type payloadCaptureReader struct {
+	io.ReadCloser
+	buf *payloadCaptureBuffer
+}
+
+func (r *payloadCaptureReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.buf.write(b[:n])
+	}
+	return n, err
+}
+
+type payloadCaptureBuffer struct {
+	mu       sync.Mutex
+	stream   bool
+	buf      bytes.Buffer
+	line     []byte
+	overflow bool
+}
+
+func (b *payloadCaptureBuffer) write(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.stream {
+		b.append(data)
+		return
+	}
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			if len(b.line)+len(data) <= payloadCaptureMaxLine {
+				b.line = append(b.line, data...)
+			}
+			return
+		}
+		if len(b.line)+i <= payloadCaptureMaxLine {
+			b.line = append(b.line, data[:i]...)
+			b.appendEvent(b.line)
+		}
+		b.line = b.line[:0]
+		data = data[i+1:]
+	}
+}
+
+func (b *payloadCaptureBuffer) append(data []byte) {
+	if b.overflow {
+		return
+	}
+	if b.buf.Len()+len(data) > PayloadCaptureMaxResponseSize {
+		b.overflow = true
+		b.buf.Reset()
+		return
+	}
+	b.buf.Write(data)
+}
+
+func (b *payloadCaptureBuffer) appendEvent(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if text := sseDeltaText(data); text != "" {
+		b.append([]byte(text))
+	}
+}
+
+// sseDeltaText 从 OpenAI、Claude、Gemini 和 Responses 格式的流式事件中提取增量文本
+func sseDeltaText(data []byte) string {
+	if !gjson.ValidBytes(data) {
+		return ""
+	}
+	event := gjson.ParseBytes(data)
+	var text strings.Builder
+	for _, choice := range event.Get("choices").Array() {
+		text.WriteString(choice.Get("delta.content").String())
+		text.WriteString(choice.Get("text").String())
+	}
+	if event.Get("type").String() == "response.output_text.delta" {
+		text.WriteString(event.Get("delta").String())
+	} else {
+		text.WriteString(event.Get("delta.text").String())
+	}
+	for _, part := range event.Get("candidates.0.content.parts").Array() {
+		text.WriteString(part.Get("text").String())
+	}
+	return text.String()
+}
@@ -73,6 +73,13 @@ type ChannelMeta struct {
 	SupportStreamOptions bool // 是否支持流式选项
 }
 
+// VolumeTierInfo 阶梯计价的计算依据
+type VolumeTierInfo struct {
+	PeriodUsed    int64 // 计费前本月已消费的额度
+	Tier          int   // 计费后所在的档位
+	OriginalQuota int   // 阶梯折扣前的额度
+}
+
 type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
@@ -109,6 +116,15 @@ type RelayInfo struct {
 	SendResponseCount      int
 	FinalPreConsumedQuota  int  // 最终预消耗的配额
 	IsClaudeBetaQuery      bool // /v1/messages?beta=true
+	BatchId                string // 非空表示来自批处理，按批处理折扣计费
+	HedgeGate              *HedgeGate
+	HedgeAttempt           int
+	ResponseCacheHit       bool // 命中响应缓存，未请求上游
+	ModelFallbackPath      []string // 发生模型降级时依次尝试的模型，首个为请求的模型
+	VolumeTier             *VolumeTierInfo // 阶梯计价结果，未启用时为 nil
+	PayloadCapture         *PayloadCapture // 调试抓取的请求和响应内容，未开启抓取时为 nil
+	AsyncTaskId            int64 // 同步接口背后的异步任务 ID，结算后把实际扣费记录到任务
+	SpendReservation       *SpendReservation // 消费上限检查时预留的额度，请求结束后释放
 
 	PriceData types.PriceData
 
@@ -396,6 +412,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		BatchId:        common.GetContextKeyString(c, constant.ContextKeyBatchId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -617,3 +634,9 @@ func RemoveDisabledFields(jsonData []byte, channelOtherSettings dto.ChannelOther
 	}
 	return jsonDataAfter, nil
 }
+
+// SpendReservation 消费上限计数器中为本次请求预留的额度
+type SpendReservation struct {
+	Keys  []string
+	Quota int
+}
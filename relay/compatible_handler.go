@@ -18,6 +18,7 @@ import (
 	"yunshuAPI/service"
 	"yunshuAPI/setting/model_setting"
 	"yunshuAPI/setting/operation_setting"
+	"yunshuAPI/tracing"
 	"yunshuAPI/types"
 
 	"github.com/shopspring/decimal"
@@ -149,6 +150,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 				return types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
 			}
 		}
+		info.CaptureUpstreamBody(jsonData)
 
 		logger.LogDebug(c, fmt.Sprintf("text request body: %s", string(jsonData)))
 
@@ -189,7 +191,17 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	return nil
 }
 
+// PostConsumeCachedResponse 命中响应缓存时按缓存中的用量结算
+func PostConsumeCachedResponse(c *gin.Context, info *relaycommon.RelayInfo, usage *dto.Usage) {
+	postConsumeQuota(c, info, usage, "响应缓存命中")
+}
+
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	if !relayInfo.ClaimBilling() {
+		return
+	}
+	_, endSpan := tracing.StartGinSpan(ctx, "post_consume_quota")
+	defer endSpan()
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -367,6 +379,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		if !ratio.IsZero() && quota == 0 {
 			quota = 1
 		}
+		quota = service.ApplyVolumeTier(relayInfo, quota)
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
@@ -396,6 +409,13 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 	}
 
+	// 同步接口背后的异步任务记录实际扣费，任务之后失败时按此额度退款
+	if relayInfo.AsyncTaskId > 0 {
+		if err := model.TaskSetQuotaUnlessFailed(relayInfo.AsyncTaskId, quota); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to record quota of task %d: %s", relayInfo.AsyncTaskId, err.Error()))
+		}
+	}
+
 	logModel := modelName
 	if strings.HasPrefix(logModel, "gpt-4-gizmo") {
 		logModel = "gpt-4-gizmo-*"
@@ -161,6 +161,7 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 				return types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
 			}
 		}
+		info.CaptureUpstreamBody(jsonData)
 
 		logger.LogDebug(c, "Gemini request body: "+string(jsonData))
 
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"yunshuAPI/common"
 	"yunshuAPI/logger"
@@ -42,9 +43,30 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// 时段倍率在请求开始时确定，结算时沿用，避免跨越时段边界的请求前后计费不一致
+	if schedule := ratio_setting.GetActiveRatioSchedule(relayInfo.UsingGroup, relayInfo.OriginModelName, time.Now()); schedule != nil {
+		groupRatioInfo.RatioSchedules = schedule.Names
+		groupRatioInfo.ScheduleGroupRatio = schedule.GroupMultiplier
+		groupRatioInfo.ScheduleModelRatio = schedule.ModelMultiplier
+		groupRatioInfo.GroupRatio *= schedule.GroupMultiplier
+	}
+
+	// batch requests are billed with a discount on top of the group ratio
+	if relayInfo.BatchId != "" {
+		groupRatioInfo.BatchDiscount = ratio_setting.GetBatchDiscount()
+		groupRatioInfo.GroupRatio *= groupRatioInfo.BatchDiscount
+	}
+
 	return groupRatioInfo
 }
 
+// ApplyResponseCacheRatio 命中响应缓存时按缓存倍率调整分组倍率
+func ApplyResponseCacheRatio(info *relaycommon.RelayInfo) {
+	ratio := ratio_setting.GetResponseCacheRatio()
+	info.PriceData.GroupRatioInfo.ResponseCacheRatio = ratio
+	info.PriceData.GroupRatioInfo.GroupRatio *= ratio
+}
+
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
 
@@ -87,12 +109,18 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
+		if groupRatioInfo.ScheduleModelRatio > 0 {
+			modelRatio *= groupRatioInfo.ScheduleModelRatio
+		}
 		ratio := modelRatio * groupRatioInfo.GroupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
 		if meta.ImagePriceRatio != 0 {
 			modelPrice = modelPrice * meta.ImagePriceRatio
 		}
+		if groupRatioInfo.ScheduleModelRatio > 0 {
+			modelPrice *= groupRatioInfo.ScheduleModelRatio
+		}
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	}
 
@@ -150,6 +178,9 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 			modelPrice = defaultPrice
 		}
 	}
+	if groupRatioInfo.ScheduleModelRatio > 0 {
+		modelPrice *= groupRatioInfo.ScheduleModelRatio
+	}
 	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	priceData := types.PerCallPriceData{
 		ModelPrice:     modelPrice,
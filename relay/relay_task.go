@@ -62,6 +62,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	} else {
 		adaptor.Init(info)
 	}
+	callbackUrl, cbErr := service.GetTaskCallbackUrl(c)
+	if cbErr != nil {
+		return service.TaskErrorWrapperLocal(cbErr, "invalid_callback_url", http.StatusBadRequest)
+	}
 	modelName := info.OriginModelName
 	if modelName == "" {
 		modelName = service.CoverTaskActionToModelName(platform, info.Action)
@@ -181,6 +185,12 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	ratio = modelPrice * finalGroupRatio
 	println(fmt.Sprintf("DEBUG: After group ratio - modelPrice: %.4f, finalGroupRatio: %.4f, ratio: %.4f", modelPrice, finalGroupRatio, ratio))
 
+	// 时段倍率（夜间折扣、限时促销等）
+	ratioSchedule := ratio_setting.GetActiveRatioSchedule(info.UsingGroup, modelName, time.Now())
+	if ratioSchedule != nil {
+		ratio *= ratioSchedule.GroupMultiplier * ratioSchedule.ModelMultiplier
+	}
+
 	// FIXME: 临时修补，支持任务仅按次计费
 	if !common.StringsContains(constant.TaskPricePatches, modelName) {
 		if len(info.PriceData.OtherRatios) > 0 {
@@ -231,6 +241,12 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if err := service.CheckSpendLimits(info, quota); err != nil {
+		taskErr = service.TaskErrorWrapperLocal(err, "spend_limit_exceeded", http.StatusForbidden)
+		return
+	}
+	// 在扣费的 defer 之后执行，释放剩余的预留额度
+	defer service.ReleaseSpendReservation(info)
 
 	if info.OriginTaskID != "" {
 		originTask, exist, err := model.GetByTaskId(info.UserId, info.OriginTaskID)
@@ -498,6 +514,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				if hasUserGroupRatio {
 					other["user_group_ratio"] = userGroupRatio
 				}
+				if ratioSchedule != nil {
+					other["ratio_schedules"] = ratioSchedule.Names
+					other["schedule_group_ratio"] = ratioSchedule.GroupMultiplier
+					other["schedule_model_ratio"] = ratioSchedule.ModelMultiplier
+				}
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
 					ChannelId: info.ChannelId,
 					ModelName: modelName,
@@ -541,6 +562,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	task.Quota = quota
 	task.Data = taskData
 	task.Action = info.Action
+	task.CallbackUrl = callbackUrl
 	err = task.Insert()
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "insert_task_failed", http.StatusInternalServerError)
@@ -711,6 +733,10 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 	}
 
 	func() {
+		// 已取消的任务不再向上游查询
+		if originTask.Status == model.TaskStatusCancelled {
+			return
+		}
 		channelModel, err2 := model.GetChannelById(originTask.ChannelId, true)
 		if err2 != nil {
 			return
@@ -740,6 +766,7 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		}
 		ti, err2 := adaptor.ParseTaskResult(body)
 		if err2 == nil && ti != nil {
+			preStatus := originTask.Status
 			if ti.Status != "" {
 				originTask.Status = model.TaskStatus(ti.Status)
 			}
@@ -760,7 +787,9 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 				}
 			}
 
-			_ = originTask.Update()
+			if updated, err2 := originTask.UpdateWithStatus(preStatus); err2 == nil && updated {
+				service.FinishTask(originTask, preStatus)
+			}
 			var raw map[string]any
 			_ = json.Unmarshal(body, &raw)
 			format := "mp4"
@@ -71,6 +71,7 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 				return types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
 			}
 		}
+		info.CaptureUpstreamBody(jsonData)
 
 		if common.DebugEnabled {
 			println("requestBody: ", string(jsonData))
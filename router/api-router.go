@@ -2,6 +2,7 @@ package router
 
 import (
 	"yunshuAPI/controller"
+	"yunshuAPI/metrics"
 	"yunshuAPI/middleware"
 
 	"github.com/gin-contrib/gzip"
@@ -13,6 +14,8 @@ func SetApiRouter(router *gin.Engine) {
 	router.GET("/image/:filename", controller.GetImage)
 	// 注册文件访问路由，不需要认证
 	router.GET("/file/:filename", controller.GetFile)
+	// Prometheus 指标
+	router.GET("/metrics", middleware.MetricsAuth(), gin.WrapH(metrics.Handler()))
 
 	apiRouter := router.Group("/api")
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
@@ -87,6 +90,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.GET("/topup/info", controller.GetTopUpInfo)
 				selfRoute.GET("/topup/self", controller.GetUserTopUps)
+				selfRoute.GET("/self/statements", controller.GetSelfStatements)
 				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
 				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestEpay)
 				selfRoute.POST("/amount", controller.RequestAmount)
@@ -112,6 +116,7 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/statements", controller.GetUserStatements)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
@@ -165,6 +170,8 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/tag/models", controller.GetTagModels)
 			channelRoute.POST("/copy/:id", controller.CopyChannel)
 			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
+			channelRoute.POST("/:id/health/reset", controller.ResetChannelHealth)
+			channelRoute.GET("/:id/probes", controller.GetChannelProbes)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -202,11 +209,18 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
+		logRoute.POST("/retention/run", middleware.RootAuth(), controller.RunLogRetention)
+		logRoute.GET("/archives", middleware.RootAuth(), controller.GetLogArchives)
+		logRoute.GET("/archives/:name", middleware.RootAuth(), controller.DownloadLogArchive)
+		logRoute.POST("/archives/import", middleware.RootAuth(), controller.ImportLogArchive)
+		logRoute.GET("/payload/:request_id", middleware.AdminAuth(), controller.GetPayloadCapture)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/export", middleware.AdminAuth(), controller.ExportAllLogs)
+		logRoute.GET("/self/export", middleware.UserAuth(), controller.ExportUserLogs)
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
@@ -239,6 +253,9 @@ func SetApiRouter(router *gin.Engine) {
 	{
 		taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
 		taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+		taskRoute.GET("/callbacks/self", middleware.UserAuth(), controller.GetUserTaskCallbacks)
+		taskRoute.GET("/callbacks", middleware.AdminAuth(), controller.GetAllTaskCallbacks)
+		taskRoute.POST("/callbacks/:id/retry", middleware.UserAuth(), controller.RetryTaskCallback)
 	}
 
 		vendorRoute := apiRouter.Group("/vendors")
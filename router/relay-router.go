@@ -5,6 +5,7 @@ import (
 	"yunshuAPI/controller"
 	"yunshuAPI/middleware"
 	"yunshuAPI/relay"
+	"yunshuAPI/tracing"
 	"yunshuAPI/types"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +15,7 @@ func SetRelayRouter(router *gin.Engine) {
 	router.Use(middleware.CORS())
 	router.Use(middleware.DecompressRequestMiddleware())
 	router.Use(middleware.StatsMiddleware())
+	router.Use(tracing.Middleware())
 	// https://platform.openai.com/docs/api-reference/introduction
 	modelsRouter := router.Group("/v1/models")
 	modelsRouter.Use(middleware.TokenAuth())
@@ -67,14 +69,35 @@ func SetRelayRouter(router *gin.Engine) {
 		// WebSocket 路由（统一为Relay）
 		wsRouter := relayV1Router.Group("")
 		wsRouter.Use(middleware.Distribute())
+		wsRouter.Use(middleware.TokenRateLimit())
 		wsRouter.GET("/realtime", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// 文件由网关自行存储，不需要分发渠道
+		fileRouter := relayV1Router.Group("/files")
+		fileRouter.GET("", controller.ListOpenAIFiles)
+		fileRouter.POST("", controller.UploadOpenAIFile)
+		fileRouter.GET("/:id", controller.RetrieveOpenAIFile)
+		fileRouter.DELETE("/:id", controller.DeleteOpenAIFile)
+		fileRouter.GET("/:id/content", controller.GetOpenAIFileContent)
+	}
+	{
+		batchRouter := relayV1Router.Group("/batches")
+		batchRouter.GET("", controller.ListBatches)
+		batchRouter.POST("", controller.CreateBatch)
+		batchRouter.GET("/:id", controller.RetrieveBatch)
+		batchRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
+	// 图片任务结果由后台轮询更新，查询时不需要分发渠道
+	relayV1Router.GET("/images/generations/:task_id", controller.RetrieveImageTask)
+	relayV1Router.POST("/tasks/:id/cancel", controller.CancelTask)
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
 		httpRouter.Use(middleware.Distribute())
+		httpRouter.Use(middleware.TokenRateLimit())
 
 		// claude related routes
 		httpRouter.POST("/messages", func(c *gin.Context) {
@@ -141,11 +164,6 @@ func SetRelayRouter(router *gin.Engine) {
 
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -162,6 +180,7 @@ func SetRelayRouter(router *gin.Engine) {
 		// http router
 		openaiHttpRouter := openaiV1Router.Group("")
 		openaiHttpRouter.Use(middleware.Distribute())
+		openaiHttpRouter.Use(middleware.TokenRateLimit())
 
 		// audio related routes
 		openaiHttpRouter.POST("/audio/speech", func(c *gin.Context) {
@@ -177,6 +196,7 @@ func SetRelayRouter(router *gin.Engine) {
 		// http router for plus
 		plusHttpRouter := relayPlusV1Router.Group("")
 		plusHttpRouter.Use(middleware.Distribute())
+		plusHttpRouter.Use(middleware.TokenRateLimit())
 		plusHttpRouter.POST("/chat/completions", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAI)
 		})
@@ -190,7 +210,7 @@ func SetRelayRouter(router *gin.Engine) {
 	//relayMjRouter.Use()
 
 	relaySunoRouter := router.Group("/suno")
-	relaySunoRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	relaySunoRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.TokenRateLimit())
 	{
 		relaySunoRouter.POST("/submit/:action", controller.RelayTask)
 		relaySunoRouter.POST("/fetch", controller.RelayTask)
@@ -201,6 +221,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter.Use(middleware.TokenAuth())
 	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
 	relayGeminiRouter.Use(middleware.Distribute())
+	relayGeminiRouter.Use(middleware.TokenRateLimit())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
 		relayGeminiRouter.POST("/models/*path", func(c *gin.Context) {
@@ -211,7 +232,7 @@ func SetRelayRouter(router *gin.Engine) {
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
 	relayMjRouter.GET("/image/:id", relay.RelayMidjourneyImage)
-	relayMjRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	relayMjRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.TokenRateLimit())
 	{
 		relayMjRouter.POST("/submit/action", controller.RelayMidjourney)
 		relayMjRouter.POST("/submit/shorten", controller.RelayMidjourney)
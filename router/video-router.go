@@ -10,7 +10,11 @@ import (
 func SetVideoRouter(router *gin.Engine) {
 	videoV1Router := router.Group("/v1")
 	videoV1Router.GET("/videos/:task_id/content", controller.VideoProxy)
-	videoV1Router.Use(middleware.TokenAuth(), middleware.Distribute())
+	// 任务转存文件的签名地址，不需要认证
+	videoV1Router.GET("/artifacts/:id", controller.GetArtifact)
+	// 取消任务只访问任务所在渠道，不需要分发
+	videoV1Router.DELETE("/videos/:task_id", middleware.TokenAuth(), controller.CancelVideoTask)
+	videoV1Router.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.TokenRateLimit())
 	{
 		videoV1Router.POST("/video/generations", controller.RelayTask)
 		videoV1Router.GET("/video/generations/:task_id", controller.RelayTask)
@@ -23,7 +27,7 @@ func SetVideoRouter(router *gin.Engine) {
 	}
 
 	klingV1Router := router.Group("/kling/v1")
-	klingV1Router.Use(middleware.KlingRequestConvert(), middleware.TokenAuth(), middleware.Distribute())
+	klingV1Router.Use(middleware.KlingRequestConvert(), middleware.TokenAuth(), middleware.Distribute(), middleware.TokenRateLimit())
 	{
 		klingV1Router.POST("/videos/text2video", controller.RelayTask)
 		klingV1Router.POST("/videos/image2video", controller.RelayTask)
@@ -33,7 +37,7 @@ func SetVideoRouter(router *gin.Engine) {
 
 	// Jimeng official API routes - direct mapping to official API format
 	jimengOfficialGroup := router.Group("jimeng")
-	jimengOfficialGroup.Use(middleware.JimengRequestConvert(), middleware.TokenAuth(), middleware.Distribute())
+	jimengOfficialGroup.Use(middleware.JimengRequestConvert(), middleware.TokenAuth(), middleware.Distribute(), middleware.TokenRateLimit())
 	{
 		// Maps to: /?Action=CVSync2AsyncSubmitTask&Version=2022-08-31 and /?Action=CVSync2AsyncGetResult&Version=2022-08-31
 		jimengOfficialGroup.POST("/", controller.RelayTask)
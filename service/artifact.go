@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+	"yunshuAPI/setting/operation_setting"
+	"yunshuAPI/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 任务产物转存：任务成功后把上游的视频、图片下载到网关存储，保存为 purpose 为 task_output 的文件，
+// 结果地址改写为 /v1/artifacts/:id 的签名地址，文件到期后由 CleanupExpiredStoredFiles 统一清理
+
+const (
+	FilePurposeTaskOutput = "task_output"
+	FilePurposeUpload     = "upload"
+
+	// 改版前 /api/file/upload 直接写入的本地目录，只读兼容并按保留时间清理
+	legacyUploadDir = "./files"
+)
+
+// TaskContentOpener 打开任务结果的上游内容。不同渠道取结果的方式不同，由 controller 注册
+type TaskContentOpener func(ctx context.Context, task *model.Task) (*http.Response, error)
+
+var taskContentOpener TaskContentOpener
+
+func SetTaskContentOpener(opener TaskContentOpener) {
+	taskContentOpener = opener
+}
+
+// ArtifactExpiresAt 新转存文件的过期时间，-1 表示永久保留
+func ArtifactExpiresAt() int64 {
+	days := operation_setting.GetArtifactSetting().RetentionDays
+	if days <= 0 {
+		return -1
+	}
+	return time.Now().Add(time.Duration(days) * 24 * time.Hour).Unix()
+}
+
+// UploadExpiresAt /api/file/upload 上传文件的过期时间
+func UploadExpiresAt() int64 {
+	hours := operation_setting.GetArtifactSetting().UploadRetentionHours
+	if hours <= 0 {
+		return -1
+	}
+	return time.Now().Add(time.Duration(hours) * time.Hour).Unix()
+}
+
+func artifactSignature(fileId string, expires int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("artifact:%s:%d", fileId, expires))
+}
+
+// ArtifactURL 生成转存文件的签名地址，有效期与文件过期时间一致
+func ArtifactURL(file *model.File) string {
+	return fmt.Sprintf("%s/v1/artifacts/%s?expires=%d&signature=%s",
+		strings.TrimRight(system_setting.ServerAddress, "/"), file.FileId, file.ExpiresAt, artifactSignature(file.FileId, file.ExpiresAt))
+}
+
+// VerifyArtifactSignature 校验签名地址，expires 为 0 表示永不过期
+func VerifyArtifactSignature(fileId string, expires int64, signature string) bool {
+	if fileId == "" || signature == "" {
+		return false
+	}
+	if expires > 0 && expires < common.GetTimestamp() {
+		return false
+	}
+	return hmac.Equal([]byte(artifactSignature(fileId, expires)), []byte(signature))
+}
+
+// StoreArtifact 将上游响应内容写入网关存储，响应体由本函数关闭
+func StoreArtifact(ctx context.Context, userId int, name string, resp *http.Response) (*model.File, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	maxSize := int64(operation_setting.GetArtifactSetting().MaxSizeMB) << 20
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("artifact is too large (%d bytes)", resp.ContentLength)
+	}
+
+	// 先落到临时文件，得到准确的大小，也让对象存储可以按已知长度上传
+	tmpFile, err := os.CreateTemp("", "artifact-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+	var reader io.Reader = resp.Body
+	if maxSize > 0 {
+		reader = io.LimitReader(resp.Body, maxSize+1)
+	}
+	size, err := io.Copy(tmpFile, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact: %w", err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, fmt.Errorf("artifact is too large (more than %d bytes)", maxSize)
+	}
+	if _, err = tmpFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if filepath.Ext(name) == "" {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return StoreFile(ctx, StoreFileParams{
+		UserId:      userId,
+		Filename:    name,
+		Purpose:     FilePurposeTaskOutput,
+		ContentType: contentType,
+		Size:        size,
+		Reader:      tmpFile,
+		ExpiresAt:   ArtifactExpiresAt(),
+	})
+}
+
+func artifactContext() (context.Context, context.CancelFunc) {
+	timeout := time.Duration(operation_setting.GetArtifactSetting().DownloadTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// RehostTaskOutput 转存任务结果，并把任务的结果地址改写为网关签名地址
+func RehostTaskOutput(task *model.Task) error {
+	if taskContentOpener == nil {
+		return errors.New("task content opener is not registered")
+	}
+	ctx, cancel := artifactContext()
+	defer cancel()
+	resp, err := taskContentOpener(ctx, task)
+	if err != nil {
+		return err
+	}
+	file, err := StoreArtifact(ctx, task.UserId, task.TaskID, resp)
+	if err != nil {
+		return err
+	}
+	task.PrivateData.ArtifactId = file.FileId
+	task.FailReason = ArtifactURL(file)
+	if err = task.UpdateArtifact(); err != nil {
+		_ = DeleteStoredFile(context.Background(), file)
+		return err
+	}
+	return nil
+}
+
+// FinishTask 任务状态更新后调用：任务刚成功且开启转存时，后台转存结果后再投递完成回调，
+// 回调中的结果地址即为网关地址；其余情况直接投递回调
+func FinishTask(task *model.Task, preStatus model.TaskStatus) {
+	if !operation_setting.GetArtifactSetting().Enabled || task.Status != model.TaskStatusSuccess ||
+		preStatus == model.TaskStatusSuccess || task.PrivateData.ArtifactId != "" {
+		NotifyTaskFinished(task, preStatus)
+		return
+	}
+	// 转存在后台进行，使用副本避免与调用方继续读取任务产生竞争
+	rehostTask := *task
+	gopool.Go(func() {
+		if err := RehostTaskOutput(&rehostTask); err != nil {
+			common.SysLog(fmt.Sprintf("failed to rehost output of task %s: %s", rehostTask.TaskID, err.Error()))
+		}
+		NotifyTaskFinished(&rehostTask, preStatus)
+	})
+}
+
+// RehostMidjourneyImage 转存 Midjourney 任务的图片，并把 ImageUrl 改写为网关签名地址
+func RehostMidjourneyImage(task *model.Midjourney) error {
+	if !strings.HasPrefix(task.ImageUrl, "http") {
+		return errors.New("image url is empty")
+	}
+	httpClient := GetHttpClient()
+	if channel, err := model.CacheGetChannel(task.ChannelId); err == nil {
+		if proxy := channel.GetSetting().Proxy; proxy != "" {
+			if httpClient, err = NewProxyHttpClient(proxy); err != nil {
+				return err
+			}
+		}
+	}
+	ctx, cancel := artifactContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, task.ImageUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	file, err := StoreArtifact(ctx, task.UserId, task.MjId, resp)
+	if err != nil {
+		return err
+	}
+	task.ImageUrl = ArtifactURL(file)
+	if err = task.UpdateImageUrl(); err != nil {
+		_ = DeleteStoredFile(context.Background(), file)
+		return err
+	}
+	return nil
+}
+
+// FinishMidjourneyTask 与 FinishTask 相同，用于 Midjourney 任务
+func FinishMidjourneyTask(task *model.Midjourney, preStatus string) {
+	if !operation_setting.GetArtifactSetting().Enabled || task.Status != "SUCCESS" || preStatus == "SUCCESS" ||
+		task.ImageUrl == "" || strings.Contains(task.ImageUrl, "/v1/artifacts/") {
+		NotifyMidjourneyFinished(task, preStatus)
+		return
+	}
+	rehostTask := *task
+	gopool.Go(func() {
+		if err := RehostMidjourneyImage(&rehostTask); err != nil {
+			common.SysLog(fmt.Sprintf("failed to rehost image of midjourney task %s: %s", rehostTask.MjId, err.Error()))
+		}
+		NotifyMidjourneyFinished(&rehostTask, preStatus)
+	})
+}
+
+// cleanupLegacyUploads 清理改版前 /api/file/upload 写入本地目录的过期文件
+func cleanupLegacyUploads() {
+	hours := operation_setting.GetArtifactSetting().UploadRetentionHours
+	if hours <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(legacyUploadDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) < time.Duration(hours)*time.Hour {
+			continue
+		}
+		if err = os.Remove(filepath.Join(legacyUploadDir, entry.Name())); err != nil {
+			common.SysLog(fmt.Sprintf("failed to delete legacy upload %s: %s", entry.Name(), err.Error()))
+		}
+	}
+}
+
+// OpenLegacyUpload 打开改版前写入本地目录的上传文件
+func OpenLegacyUpload(filename string) (*os.File, error) {
+	return os.Open(filepath.Join(legacyUploadDir, filepath.Base(filename)))
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/dto"
+	"yunshuAPI/model"
+	relaycommon "yunshuAPI/relay/common"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 同步接口背后的异步任务：上游只提供异步任务的渠道在提交后写入任务表，由后台任务轮询（UpdateTaskBulk）更新状态，
+// 请求在设置的时间内等待任务完成；超时、客户端断开或请求体带 "async": true 时返回任务对象，之后通过查询接口获取结果
+
+// IsAsyncRequested 客户端是否要求提交后直接返回任务对象
+func IsAsyncRequested(c *gin.Context) bool {
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		async, _ := strconv.ParseBool(c.PostForm("async"))
+		return async
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return false
+	}
+	return gjson.GetBytes(body, "async").Bool()
+}
+
+// CreateAsyncTask 记录上游已创建的任务，交给后台轮询
+func CreateAsyncTask(c *gin.Context, info *relaycommon.RelayInfo, action string, upstreamTaskId string, data []byte) (*model.Task, error) {
+	task := model.InitTask(constant.TaskPlatform(strconv.Itoa(info.ChannelType)), info)
+	task.TaskID = upstreamTaskId
+	task.Action = action
+	task.Status = model.TaskStatusSubmitted
+	task.Data = data
+	// 回调地址无效时仍然记录任务，只是不投递回调
+	if callbackUrl, err := GetTaskCallbackUrl(c); err == nil {
+		task.CallbackUrl = callbackUrl
+	}
+	if err := task.Insert(); err != nil {
+		return nil, fmt.Errorf("failed to save task %s: %w", upstreamTaskId, err)
+	}
+	return task, nil
+}
+
+// TaskPollingEnabled 部署中是否有节点轮询异步任务：未启用 Redis 时由主节点轮询，启用时各节点通过租约分担，
+// 两种方式都只取决于 UpdateTask 开关，与当前节点是否轮询无关
+func TaskPollingEnabled() bool {
+	return constant.UpdateTask
+}
+
+// WaitAsyncTask 等待任务成功或失败，最多等待设置的时间。
+// 返回的任务未完成时表示转为异步返回：任务先记录预扣费额度，之后失败时由后台轮询退还。
+// 任务成功或转为异步返回时设置 info.AsyncTaskId，结算后 postConsumeQuota 把实际扣费记录到任务
+func WaitAsyncTask(c *gin.Context, info *relaycommon.RelayInfo, task *model.Task) (*model.Task, error) {
+	setting := operation_setting.GetAsyncTaskSetting()
+	// 没有轮询时任务状态不会更新，不必等待
+	if setting.MaxWaitSeconds > 0 && TaskPollingEnabled() && !IsAsyncRequested(c) {
+		interval := time.Duration(setting.CheckIntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		deadline := time.Now().Add(time.Duration(setting.MaxWaitSeconds) * time.Second)
+		ctx := c.Request.Context()
+	wait:
+		for time.Now().Before(deadline) {
+			select {
+			case <-ctx.Done():
+				break wait
+			case <-time.After(interval):
+			}
+			current, err := model.GetTaskById(task.ID)
+			if err != nil {
+				return nil, err
+			}
+			if current.Status == model.TaskStatusSuccess {
+				info.AsyncTaskId = current.ID
+			}
+			if current.IsFinished() {
+				return current, nil
+			}
+			task = current
+		}
+	}
+
+	// 任务仍未完成才转为异步返回，否则说明刚好完成，按最新结果返回
+	detached, err := model.TaskSetQuotaIfUnfinished(task.ID, info.FinalPreConsumedQuota)
+	if err != nil {
+		return nil, err
+	}
+	if detached {
+		task.Quota = info.FinalPreConsumedQuota
+		info.AsyncTaskId = task.ID
+		return task, nil
+	}
+	task, err = model.GetTaskById(task.ID)
+	if err == nil && task.Status == model.TaskStatusSuccess {
+		info.AsyncTaskId = task.ID
+	}
+	return task, err
+}
+
+// ImageTaskResponse 图片任务的查询结果，status 与视频任务一致
+func ImageTaskResponse(task *model.Task) *dto.ImageTaskResponse {
+	resp := &dto.ImageTaskResponse{
+		ID:      task.TaskID,
+		Object:  "image.generation.task",
+		Status:  task.Status.ToVideoStatus(),
+		Created: task.SubmitTime,
+		Data:    []dto.ImageData{},
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		// 结果地址保存在 FailReason 中
+		resp.Data = append(resp.Data, dto.ImageData{Url: task.FailReason})
+	case model.TaskStatusFailure, model.TaskStatusCancelled:
+		resp.Error = &dto.OpenAIError{
+			Message: task.FailReason,
+			Type:    "image_generation_failed",
+		}
+	}
+	return resp
+}
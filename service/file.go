@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/dto"
+	"yunshuAPI/logger"
+	"yunshuAPI/model"
+	"yunshuAPI/service/storage"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const fileIdPrefix = "file-"
+
+// StoreFileParams 写入网关文件存储所需的参数
+type StoreFileParams struct {
+	UserId         int
+	TokenId        int
+	TokenKey       string
+	TokenUnlimited bool
+	Filename       string
+	Purpose        string
+	ContentType    string
+	Size           int64
+	Reader         io.Reader
+	// 是否按存储单价扣费，批处理等内部生成的文件不扣费
+	ChargeQuota bool
+	// 过期时间，大于 0 时覆盖 file_setting 中的保留天数，小于 0 表示永久保留
+	ExpiresAt int64
+}
+
+func GenerateFileId() string {
+	return fileIdPrefix + common.GetRandomString(24)
+}
+
+// CalculateFileStorageQuota 按文件大小和存储单价计算一次性扣除的额度
+func CalculateFileStorageQuota(size int64) int {
+	price := operation_setting.GetFileSetting().StoragePricePerGB
+	if price <= 0 || size <= 0 {
+		return 0
+	}
+	quota := int(float64(size) / (1 << 30) * price * common.QuotaPerUnit)
+	if quota <= 0 {
+		quota = 1
+	}
+	return quota
+}
+
+// StoreFile 将文件写入对象存储并记录元数据，需要时扣除存储费用
+func StoreFile(ctx context.Context, params StoreFileParams) (*model.File, error) {
+	store, err := storage.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	quota := 0
+	if params.ChargeQuota {
+		quota = CalculateFileStorageQuota(params.Size)
+	}
+	if quota > 0 {
+		if err := consumeFileQuota(params, quota); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	file := &model.File{
+		FileId:      GenerateFileId(),
+		UserId:      params.UserId,
+		TokenId:     params.TokenId,
+		Filename:    params.Filename,
+		Purpose:     params.Purpose,
+		Bytes:       params.Size,
+		ContentType: params.ContentType,
+		Storage:     store.Name(),
+		Quota:       quota,
+		Status:      model.FileStatusProcessed,
+		CreatedAt:   now.Unix(),
+	}
+	if params.ExpiresAt != 0 {
+		file.ExpiresAt = max(params.ExpiresAt, 0)
+	} else if expireDays := operation_setting.GetFileSetting().ExpireDays; expireDays > 0 {
+		file.ExpiresAt = now.Add(time.Duration(expireDays) * 24 * time.Hour).Unix()
+	}
+	file.StorageKey = fmt.Sprintf("files/%d/%s", params.UserId, file.FileId)
+
+	if err := store.Put(ctx, file.StorageKey, params.Reader, params.Size, params.ContentType); err != nil {
+		refundFileQuota(params, quota)
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+	if err := file.Insert(); err != nil {
+		_ = store.Delete(ctx, file.StorageKey)
+		refundFileQuota(params, quota)
+		return nil, err
+	}
+	if quota > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(params.UserId, quota)
+		model.RecordLog(params.UserId, model.LogTypeConsume, fmt.Sprintf("文件存储扣费 %s，文件 %s（%d 字节）", logger.FormatQuota(quota), file.FileId, file.Bytes))
+	}
+	return file, nil
+}
+
+func consumeFileQuota(params StoreFileParams, quota int) error {
+	userQuota, err := model.GetUserQuota(params.UserId, false)
+	if err != nil {
+		return err
+	}
+	if userQuota < quota {
+		return fmt.Errorf("用户额度不足, 剩余额度: %s, 需要额度: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
+	}
+	if params.TokenKey != "" {
+		token, err := model.GetTokenByKey(params.TokenKey, false)
+		if err != nil {
+			return err
+		}
+		if !params.TokenUnlimited && token.RemainQuota < quota {
+			return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
+		}
+		if err := model.DecreaseTokenQuota(params.TokenId, params.TokenKey, quota); err != nil {
+			return err
+		}
+	}
+	if err := model.DecreaseUserQuota(params.UserId, quota); err != nil {
+		// 用户扣费失败时退还已扣的令牌额度
+		if params.TokenKey != "" {
+			if refundErr := model.IncreaseTokenQuota(params.TokenId, params.TokenKey, quota); refundErr != nil {
+				common.SysLog("error refund file token quota: " + refundErr.Error())
+			}
+		}
+		return err
+	}
+	RecordQuotaSpend(params.UserId, params.TokenId, quota)
+	return nil
+}
+
+func refundFileQuota(params StoreFileParams, quota int) {
+	if quota <= 0 {
+		return
+	}
+	if params.TokenKey != "" {
+		if err := model.IncreaseTokenQuota(params.TokenId, params.TokenKey, quota); err != nil {
+			common.SysLog("error refund file token quota: " + err.Error())
+		}
+	}
+	if err := model.IncreaseUserQuota(params.UserId, quota, false); err != nil {
+		common.SysLog("error refund file user quota: " + err.Error())
+		return
+	}
+	RecordQuotaSpend(params.UserId, params.TokenId, -quota)
+}
+
+// OpenFileContent 读取文件内容，调用方负责关闭
+func OpenFileContent(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	store, err := storage.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, file.StorageKey)
+}
+
+// ReadFileContent 读取整个文件内容
+func ReadFileContent(ctx context.Context, file *model.File) ([]byte, error) {
+	reader, err := OpenFileContent(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// DeleteStoredFile 删除文件内容及元数据
+func DeleteStoredFile(ctx context.Context, file *model.File) error {
+	store, err := storage.GetStorage()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, file.StorageKey); err != nil {
+		return err
+	}
+	return file.Delete()
+}
+
+// GetUsableUserFile 查询用户可用（存在且未过期）的文件
+func GetUsableUserFile(userId int, fileId string) (*model.File, error) {
+	file, err := model.GetUserFileById(userId, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsExpired() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return file, nil
+}
+
+func FileToOpenAIFile(file *model.File) dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		ExpiresAt: file.ExpiresAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+}
+
+// CleanupExpiredStoredFiles 定期清理过期的用户文件、上传文件和任务转存文件
+func CleanupExpiredStoredFiles() {
+	for {
+		cleanupLegacyUploads()
+		cleanupExpiredFiles()
+		time.Sleep(time.Hour)
+	}
+}
+
+// cleanupExpiredFiles 按 id 分批删除过期文件，删除失败的文件留到下一轮重试，不会被反复查询
+func cleanupExpiredFiles() {
+	const batchSize = 100
+	afterId := 0
+	for {
+		files, err := model.GetExpiredFiles(afterId, batchSize)
+		if err != nil {
+			common.SysLog("failed to query expired files: " + err.Error())
+			return
+		}
+		for _, file := range files {
+			afterId = file.Id
+			if err := DeleteStoredFile(context.Background(), file); err != nil {
+				common.SysLog(fmt.Sprintf("failed to delete expired file %s: %s", file.FileId, err.Error()))
+			}
+		}
+		if len(files) < batchSize {
+			return
+		}
+	}
+}
+
+// fileDataURL 将网关文件读取为 data URL，供上游以内联方式接收
+func fileDataURL(ctx context.Context, userId int, fileId string) (string, *model.File, error) {
+	file, err := GetUsableUserFile(userId, fileId)
+	if err != nil {
+		return "", nil, err
+	}
+	maxInline := int64(operation_setting.GetFileSetting().InlineMaxSizeMB) << 20
+	if maxInline > 0 && file.Bytes > maxInline {
+		return "", nil, fmt.Errorf("file %s is too large to be referenced inline (%d bytes)", fileId, file.Bytes)
+	}
+	content, err := ReadFileContent(ctx, file)
+	if err != nil {
+		return "", nil, err
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(content)), file, nil
+}
+
+// ResolveFileReferences 将请求中引用网关文件的 file_id 替换为内联文件内容。
+// 不属于网关的 file_id（例如上游自有的文件）保持原样透传。
+func ResolveFileReferences(c *gin.Context, request dto.Request) error {
+	userId := c.GetInt("id")
+	if userId == 0 {
+		return nil
+	}
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		for i := range req.Messages {
+			if err := resolveMessageFiles(c, userId, &req.Messages[i]); err != nil {
+				return err
+			}
+		}
+	case *dto.OpenAIResponsesRequest:
+		if len(req.Input) == 0 || req.Input[0] != '[' {
+			return nil
+		}
+		var input []any
+		if err := common.Unmarshal(req.Input, &input); err != nil {
+			return nil
+		}
+		changed, err := resolveResponsesInputFiles(c, userId, input)
+		if err != nil {
+			return err
+		}
+		if changed {
+			data, err := common.Marshal(input)
+			if err != nil {
+				return err
+			}
+			req.Input = data
+		}
+	}
+	return nil
+}
+
+func resolveMessageFiles(c *gin.Context, userId int, message *dto.Message) error {
+	parts, ok := message.Content.([]any)
+	if !ok {
+		return nil
+	}
+	changed := false
+	for _, part := range parts {
+		partMap, ok := part.(map[string]any)
+		if !ok || partMap["type"] != dto.ContentTypeFile {
+			continue
+		}
+		fileMap, ok := partMap["file"].(map[string]any)
+		if !ok {
+			continue
+		}
+		fileId, ok := fileMap["file_id"].(string)
+		if !ok || fileId == "" {
+			continue
+		}
+		dataURL, file, err := fileDataURL(c.Request.Context(), userId, fileId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		partMap["file"] = map[string]any{
+			"filename":  file.Filename,
+			"file_data": dataURL,
+		}
+		changed = true
+	}
+	if changed {
+		// 重置内容以清除已解析的缓存
+		message.SetNullContent()
+		message.Content = parts
+	}
+	return nil
+}
+
+func resolveResponsesInputFiles(c *gin.Context, userId int, items []any) (bool, error) {
+	changed := false
+	for _, item := range items {
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if content, ok := itemMap["content"].([]any); ok {
+			subChanged, err := resolveResponsesInputFiles(c, userId, content)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || subChanged
+			continue
+		}
+		if itemMap["type"] != "input_file" {
+			continue
+		}
+		fileId, ok := itemMap["file_id"].(string)
+		if !ok || fileId == "" {
+			continue
+		}
+		dataURL, file, err := fileDataURL(c.Request.Context(), userId, fileId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return false, err
+		}
+		delete(itemMap, "file_id")
+		itemMap["filename"] = file.Filename
+		itemMap["file_data"] = dataURL
+		changed = true
+	}
+	return changed, nil
+}
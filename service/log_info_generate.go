@@ -31,6 +31,16 @@ func appendRequestPath(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other
 	}
 }
 
+// appendRatioSchedule 记录请求时生效的时段倍率，便于解释账单
+func appendRatioSchedule(groupRatioInfo types.GroupRatioInfo, other map[string]interface{}) {
+	if len(groupRatioInfo.RatioSchedules) == 0 {
+		return
+	}
+	other["ratio_schedules"] = groupRatioInfo.RatioSchedules
+	other["schedule_group_ratio"] = groupRatioInfo.ScheduleGroupRatio
+	other["schedule_model_ratio"] = groupRatioInfo.ScheduleModelRatio
+}
+
 func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelRatio, groupRatio, completionRatio float64,
 	cacheTokens int, cacheRatio float64, modelPrice float64, userGroupRatio float64) map[string]interface{} {
 	other := make(map[string]interface{})
@@ -62,6 +72,25 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["is_multi_key"] = true
 		adminInfo["multi_key_index"] = common.GetContextKeyInt(ctx, constant.ContextKeyChannelMultiKeyIndex)
 	}
+	if relayInfo.BatchId != "" {
+		other["batch_id"] = relayInfo.BatchId
+		other["batch_discount"] = relayInfo.PriceData.GroupRatioInfo.BatchDiscount
+	}
+	if len(relayInfo.ModelFallbackPath) > 0 {
+		other["requested_model"] = relayInfo.ModelFallbackPath[0]
+		other["model_fallback"] = relayInfo.ModelFallbackPath
+	}
+	appendRatioSchedule(relayInfo.PriceData.GroupRatioInfo, other)
+	if relayInfo.VolumeTier != nil {
+		other["volume_tier"] = relayInfo.VolumeTier.Tier
+		other["volume_period_used"] = relayInfo.VolumeTier.PeriodUsed
+		other["volume_original_quota"] = relayInfo.VolumeTier.OriginalQuota
+	}
+	if relayInfo.ResponseCacheHit {
+		other["response_cache_hit"] = true
+		other["response_cache_ratio"] = relayInfo.PriceData.GroupRatioInfo.ResponseCacheRatio
+	}
+	AppendPayloadCaptureInfo(ctx, adminInfo)
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
 	return other
@@ -119,6 +148,7 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.PerCa
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	appendRatioSchedule(priceData.GroupRatioInfo, other)
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
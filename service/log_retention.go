@@ -0,0 +1,291 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+	"yunshuAPI/setting/operation_setting"
+)
+
+// 日志保留策略：按类型定期删除过期日志，删除前按天归档为 gzip 压缩的 JSONL 文件，
+// 归档文件可以重新导入日志表用于审计
+
+const (
+	logArchiveSuffix  = ".jsonl.gz"
+	logRetentionBatch = 1000
+)
+
+type logRetentionRule struct {
+	logType int
+	name    string
+	days    int
+}
+
+func getLogRetentionRules(s *operation_setting.LogRetentionSetting) []logRetentionRule {
+	return []logRetentionRule{
+		{logType: model.LogTypeConsume, name: "consume", days: s.ConsumeDays},
+		{logType: model.LogTypeError, name: "error", days: s.ErrorDays},
+		{logType: model.LogTypeSystem, name: "system", days: s.SystemDays},
+		{logType: model.LogTypeTopup, name: "topup", days: s.TopupDays},
+		{logType: model.LogTypeManage, name: "manage", days: s.ManageDays},
+		{logType: model.LogTypeRefund, name: "refund", days: s.RefundDays},
+	}
+}
+
+// LogRetentionResult 一种日志类型的清理结果
+type LogRetentionResult struct {
+	Type     string   `json:"type"`
+	Archived int64    `json:"archived"`
+	Deleted  int64    `json:"deleted"`
+	Files    []string `json:"files"`
+}
+
+var logRetentionLock = sync.Mutex{}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// RunLogRetention 按当前配置执行一次清理，不检查是否启用，供定时任务和管理员手动触发使用
+func RunLogRetention(ctx context.Context) ([]LogRetentionResult, error) {
+	if !logRetentionLock.TryLock() {
+		return nil, errors.New("已经有一个日志清理任务在运行中，请稍后再试")
+	}
+	defer logRetentionLock.Unlock()
+
+	setting := *operation_setting.GetLogRetentionSetting()
+	results := make([]LogRetentionResult, 0)
+	for _, rule := range getLogRetentionRules(&setting) {
+		if rule.days <= 0 {
+			continue
+		}
+		// 截止时间对齐到零点，使每个归档文件都是完整的一天
+		cutoff := startOfDay(time.Now().AddDate(0, 0, -rule.days)).Unix()
+		result := LogRetentionResult{Type: rule.name, Files: []string{}}
+		err := purgeLogsBefore(ctx, &setting, rule, cutoff, &result)
+		if result.Deleted > 0 {
+			results = append(results, result)
+			common.SysLog(fmt.Sprintf("log retention: deleted %d %s logs, archived %d", result.Deleted, rule.name, result.Archived))
+		}
+		if err != nil {
+			return results, fmt.Errorf("purge %s logs: %w", rule.name, err)
+		}
+	}
+	return results, nil
+}
+
+func purgeLogsBefore(ctx context.Context, setting *operation_setting.LogRetentionSetting, rule logRetentionRule, cutoff int64, result *LogRetentionResult) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		oldest, err := model.GetOldestLogTime(rule.logType, cutoff)
+		if err != nil {
+			return err
+		}
+		if oldest == 0 {
+			return nil
+		}
+		start := startOfDay(time.Unix(oldest, 0)).Unix()
+		end := startOfDay(time.Unix(oldest, 0)).AddDate(0, 0, 1).Unix()
+		if end > cutoff {
+			end = cutoff
+		}
+		maxId := 0
+		if setting.ArchiveEnabled {
+			file, count, lastId, err := archiveLogPartition(setting.ArchiveDir, rule, start, end)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return nil
+			}
+			result.Archived += count
+			result.Files = append(result.Files, file)
+			maxId = lastId
+		}
+		deleted, err := model.DeleteLogsBetween(ctx, rule.logType, start, end, maxId, logRetentionBatch)
+		result.Deleted += deleted
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveLogPartition 将一天内的日志写入归档文件，先写临时文件，完整写入后再改名，返回文件名、条数和最大 id
+func archiveLogPartition(dir string, rule logRetentionRule, start int64, end int64) (string, int64, int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, 0, err
+	}
+	name := fmt.Sprintf("%s-%s-%d%s", rule.name, time.Unix(start, 0).Format("20060102"), time.Now().Unix(), logArchiveSuffix)
+	path := filepath.Join(dir, name)
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	var count int64
+	gz := gzip.NewWriter(f)
+	w := bufio.NewWriter(gz)
+	maxId, err := model.ScanLogsBetween(rule.logType, start, end, logRetentionBatch, func(logs []*model.Log) error {
+		for _, log := range logs {
+			data, err := common.Marshal(log)
+			if err != nil {
+				return err
+			}
+			if _, err = w.Write(append(data, '\n')); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && count > 0 {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil || count == 0 {
+		_ = os.Remove(tmpPath)
+		return "", 0, 0, err
+	}
+	return name, count, maxId, nil
+}
+
+// RunLogRetentionTask 每天在配置的时刻执行一次日志清理
+func RunLogRetentionTask() {
+	lastRunDay := ""
+	for {
+		setting := operation_setting.GetLogRetentionSetting()
+		now := time.Now()
+		today := now.Format("2006-01-02")
+		if setting.Enabled && now.Hour() == setting.RunHour && lastRunDay != today {
+			lastRunDay = today
+			if _, err := RunLogRetention(context.Background()); err != nil {
+				common.SysLog("log retention failed: " + err.Error())
+			}
+		}
+		time.Sleep(10 * time.Minute)
+	}
+}
+
+// LogArchiveFile 归档目录中的一个归档文件
+type LogArchiveFile struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ModifiedAt int64  `json:"modified_at"`
+}
+
+// ListLogArchives 列出归档目录中的归档文件，按文件名排序
+func ListLogArchives() ([]LogArchiveFile, error) {
+	files := make([]LogArchiveFile, 0)
+	entries, err := os.ReadDir(operation_setting.GetLogRetentionSetting().ArchiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), logArchiveSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, LogArchiveFile{
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().Unix(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// OpenLogArchive 打开归档目录中的文件，name 只能是文件名，不能包含路径
+func OpenLogArchive(name string) (*os.File, error) {
+	if name == "" || filepath.Base(name) != name || !strings.HasSuffix(name, logArchiveSuffix) {
+		return nil, errors.New("无效的归档文件名")
+	}
+	return os.Open(filepath.Join(operation_setting.GetLogRetentionSetting().ArchiveDir, name))
+}
+
+// ImportLogArchive 将归档文件重新导入日志表，已存在的日志会被跳过。
+// 注意导入的日志同样受保留策略约束，审计完成前应暂停对应类型的清理
+func ImportLogArchive(name string) (int64, error) {
+	f, err := OpenLogArchive(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	var imported int64
+	batch := make([]*model.Log, 0, logRetentionBatch)
+	flush := func() error {
+		n, err := model.ImportLogs(batch)
+		imported += n
+		batch = batch[:0]
+		return err
+	}
+	reader := bufio.NewReaderSize(gz, 1<<20)
+	line := 0
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return imported, err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			line++
+			log := &model.Log{}
+			if jsonErr := common.Unmarshal(data, log); jsonErr != nil {
+				return imported, fmt.Errorf("line %d: %w", line, jsonErr)
+			}
+			batch = append(batch, log)
+			if len(batch) >= logRetentionBatch {
+				if flushErr := flush(); flushErr != nil {
+					return imported, flushErr
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := flush(); err != nil {
+		return imported, err
+	}
+	return imported, nil
+}
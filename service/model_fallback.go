@@ -0,0 +1,58 @@
+package service
+
+import (
+	"strings"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	relayconstant "yunshuAPI/relay/constant"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 模型降级：请求模型的所有渠道都失败时，按管理员配置的降级链依次改用备用模型
+
+// IsModelFallbackDisabled 判断本次请求是否不允许模型降级
+func IsModelFallbackDisabled(c *gin.Context) bool {
+	// 指定渠道的请求不降级
+	if common.GetContextKeyString(c, constant.ContextKeyTokenSpecificChannelId) != "" {
+		return true
+	}
+	// 仅对通用转发接口降级，任务类接口和实时接口不降级
+	if c.Request == nil || c.Request.URL == nil {
+		return true
+	}
+	path := c.Request.URL.Path
+	relayMode := relayconstant.Path2RelayMode(path)
+	if relayMode == relayconstant.RelayModeUnknown || relayMode == relayconstant.RelayModeRealtime || strings.Contains(path, "/mj/") {
+		return true
+	}
+	header := operation_setting.GetModelFallbackSetting().DisableHeader
+	if header != "" {
+		value := strings.ToLower(strings.TrimSpace(c.GetHeader(header)))
+		if value == "true" || value == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetModelFallbackChain 返回请求模型的降级链，不包含模型本身及重复项
+func GetModelFallbackChain(c *gin.Context, group string, modelName string) []string {
+	chain := operation_setting.GetModelFallbackSetting().GetFallbackChain(group, modelName)
+	if len(chain) == 0 || IsModelFallbackDisabled(c) {
+		return nil
+	}
+	seen := map[string]bool{modelName: true}
+	result := make([]string, 0, len(chain))
+	for _, m := range chain {
+		m = strings.TrimSpace(m)
+		if m == "" || seen[m] {
+			continue
+		}
+		seen[m] = true
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/model"
+	relaycommon "yunshuAPI/relay/common"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 调试抓取：对配置的令牌、用户或渠道保存入站请求体、转换后的上游请求体和上游响应，
+// 保存前对密钥类字段、密钥形式的字符串以及配置的 JSON 路径脱敏
+
+const payloadRedacted = "[REDACTED]"
+
+// 内置脱敏的字段名，比较时不区分大小写
+var defaultPayloadRedactKeys = []string{
+	"api_key", "apikey", "api-key", "x-api-key", "x-goog-api-key", "authorization",
+	"password", "secret", "client_secret", "access_token", "refresh_token", "id_token", "private_key",
+}
+
+// 密钥形式的字符串，出现在任何位置都会被替换
+var payloadSecretPattern = regexp.MustCompile(`(?i)\bsk-[a-z0-9_\-]{16,}|\bbearer\s+[a-z0-9._\-]{16,}|\bAIza[0-9a-z_\-]{35}`)
+
+// StartPayloadCapture 请求可能需要抓取时开始记录，渠道是否命中要到选择渠道后才能确定
+func StartPayloadCapture(c *gin.Context, info *relaycommon.RelayInfo) {
+	setting := operation_setting.GetPayloadCaptureSetting()
+	if !setting.Enabled {
+		return
+	}
+	if !setting.Matches(c.GetInt("token_id"), c.GetInt("id"), 0) && len(setting.ChannelIds) == 0 {
+		return
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return
+	}
+	info.PayloadCapture = relaycommon.NewPayloadCapture(body)
+	common.SetContextKey(c, constant.ContextKeyPayloadCapture, true)
+}
+
+// PayloadCaptureMatches 当前请求是否会保存抓取内容
+func PayloadCaptureMatches(c *gin.Context) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyPayloadCapture) {
+		return false
+	}
+	return operation_setting.GetPayloadCaptureSetting().Matches(c.GetInt("token_id"), c.GetInt("id"), c.GetInt("channel_id"))
+}
+
+// AppendPayloadCaptureInfo 在日志的 admin_info 中记录抓取内容的请求 ID，供管理员查看
+func AppendPayloadCaptureInfo(c *gin.Context, adminInfo map[string]interface{}) {
+	if PayloadCaptureMatches(c) {
+		adminInfo["payload_capture_id"] = c.GetString(common.RequestIdKey)
+	}
+}
+
+// SavePayloadCapture 请求结束后脱敏并保存抓取内容
+func SavePayloadCapture(c *gin.Context, info *relaycommon.RelayInfo, statusCode int) {
+	if info == nil || info.PayloadCapture == nil || !PayloadCaptureMatches(c) {
+		return
+	}
+	setting := operation_setting.GetPayloadCaptureSetting()
+	now := time.Now()
+	requestBody, upstreamBody, responseBody, stream, overflow := info.PayloadCapture.Snapshot()
+	capture := &model.PayloadCapture{
+		RequestId:   c.GetString(common.RequestIdKey),
+		UserId:      c.GetInt("id"),
+		TokenId:     c.GetInt("token_id"),
+		ChannelId:   c.GetInt("channel_id"),
+		ModelName:   info.OriginModelName,
+		RequestPath: info.RequestURLPath,
+		StatusCode:  statusCode,
+		IsStream:    stream,
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   now.Add(time.Duration(setting.TTLHours) * time.Hour).Unix(),
+	}
+	redactor := newPayloadRedactor(setting.RedactKeys, setting.RedactPaths)
+	limit := setting.MaxBodySize()
+	gopool.Go(func() {
+		// 先对完整内容脱敏再截断，截断后的内容不是完整 JSON，无法按路径脱敏
+		var truncated [3]bool
+		capture.RequestBody, truncated[0] = truncatePayload(redactor.redact(requestBody), limit)
+		capture.UpstreamBody, truncated[1] = truncatePayload(redactor.redact(upstreamBody), limit)
+		switch {
+		case overflow:
+			capture.ResponseBody = fmt.Sprintf("[response larger than %d bytes, not captured]", relaycommon.PayloadCaptureMaxResponseSize)
+			truncated[2] = true
+		case stream:
+			capture.ResponseBody, truncated[2] = truncatePayload(redactor.redactText(string(responseBody)), limit)
+		default:
+			capture.ResponseBody, truncated[2] = truncatePayload(redactor.redact(responseBody), limit)
+		}
+		capture.Truncated = truncated[0] || truncated[1] || truncated[2]
+		if err := capture.Insert(); err != nil {
+			common.SysLog(fmt.Sprintf("failed to save payload capture %s: %s", capture.RequestId, err.Error()))
+		}
+	})
+}
+
+// truncatePayload 截断到最多 limit 字节，不拆分 UTF-8 字符
+func truncatePayload(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut], true
+}
+
+type payloadRedactor struct {
+	keys       map[string]bool
+	paths      [][]string
+	keyPattern *regexp.Regexp
+}
+
+func newPayloadRedactor(extraKeys []string, paths []string) *payloadRedactor {
+	r := &payloadRedactor{keys: make(map[string]bool)}
+	quoted := make([]string, 0, len(defaultPayloadRedactKeys)+len(extraKeys))
+	for _, key := range append(append([]string{}, defaultPayloadRedactKeys...), extraKeys...) {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || r.keys[key] {
+			continue
+		}
+		r.keys[key] = true
+		quoted = append(quoted, regexp.QuoteMeta(key))
+	}
+	// 无法解析为 JSON 时按文本匹配 "key": "value"
+	r.keyPattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			r.paths = append(r.paths, strings.Split(path, "."))
+		}
+	}
+	return r
+}
+
+// redact 对 JSON 内容按字段名和路径脱敏，不是完整 JSON 时按文本脱敏
+func (r *payloadRedactor) redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		value = r.redactValue(value)
+		for _, path := range r.paths {
+			value = redactPayloadPath(value, path)
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err = encoder.Encode(value); err == nil {
+			return strings.TrimSuffix(buf.String(), "\n")
+		}
+	}
+	text := r.keyPattern.ReplaceAllString(string(body), `${1}"`+payloadRedacted+`"`)
+	return r.redactText(text)
+}
+
+func (r *payloadRedactor) redactText(text string) string {
+	return payloadSecretPattern.ReplaceAllString(text, payloadRedacted)
+}
+
+func (r *payloadRedactor) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if r.keys[strings.ToLower(key)] {
+				v[key] = payloadRedacted
+			} else {
+				v[key] = r.redactValue(item)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+	case string:
+		return r.redactText(v)
+	}
+	return value
+}
+
+// redactPayloadPath 将路径指向的值替换为脱敏标记，* 匹配任意字段或数组下标
+func redactPayloadPath(value any, path []string) any {
+	if len(path) == 0 {
+		return payloadRedacted
+	}
+	segment, rest := path[0], path[1:]
+	switch v := value.(type) {
+	case map[string]any:
+		if segment == "*" {
+			for key, item := range v {
+				v[key] = redactPayloadPath(item, rest)
+			}
+		} else if item, ok := v[segment]; ok {
+			v[segment] = redactPayloadPath(item, rest)
+		}
+	case []any:
+		if segment == "*" {
+			for i, item := range v {
+				v[i] = redactPayloadPath(item, rest)
+			}
+		} else if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(v) {
+			v[i] = redactPayloadPath(v[i], rest)
+		}
+	}
+	return value
+}
+
+// CleanupExpiredPayloadCaptures 定期删除过期的抓取内容
+func CleanupExpiredPayloadCaptures() {
+	for {
+		rows, err := model.DeleteExpiredPayloadCaptures()
+		if err != nil {
+			common.SysLog("failed to delete expired payload captures: " + err.Error())
+		} else if rows > 0 {
+			common.SysLog(fmt.Sprintf("deleted %d expired payload captures", rows))
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"yunshuAPI/common"
 	"yunshuAPI/logger"
+	"yunshuAPI/metrics"
 	"yunshuAPI/model"
 	relaycommon "yunshuAPI/relay/common"
 	"yunshuAPI/types"
@@ -23,7 +24,9 @@ func ReturnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
 			err := PostConsumeQuota(&relayInfoCopy, -relayInfoCopy.FinalPreConsumedQuota, 0, false)
 			if err != nil {
 				common.SysLog("error return pre-consumed quota: " + err.Error())
+				return
 			}
+			metrics.AddQuotaRefunded(relayInfoCopy.FinalPreConsumedQuota)
 		})
 	}
 }
@@ -42,6 +45,10 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		return types.NewErrorWithStatusCode(fmt.Errorf("预扣费额度失败 用户剩余额度: %s, 需要预扣费额度: %s", logger.FormatQuota(userQuota), logger.FormatQuota(preConsumedQuota)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 	}
 
+	if err := CheckSpendLimits(relayInfo, preConsumedQuota); err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeSpendLimitExceeded, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+
 	trustQuota := common.GetTrustQuota()
 
 	relayInfo.UserQuota = userQuota
@@ -66,14 +73,20 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	if preConsumedQuota > 0 {
 		err := PreConsumeTokenQuota(relayInfo, preConsumedQuota)
 		if err != nil {
+			ReleaseSpendReservation(relayInfo)
 			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 		}
 		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
 		if err != nil {
+			ReleaseSpendReservation(relayInfo)
 			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 		}
+		// 预扣费已计入消费，对应的预留转为实际消费
+		RecordQuotaSpend(relayInfo.UserId, SpendTokenId(relayInfo), preConsumedQuota)
+		releaseSpendReservation(relayInfo, preConsumedQuota)
 		logger.LogInfo(c, fmt.Sprintf("用户 %d 预扣�?%s, 预扣费后剩余额度: %s", relayInfo.UserId, logger.FormatQuota(preConsumedQuota), logger.FormatQuota(userQuota-preConsumedQuota)))
 	}
 	relayInfo.FinalPreConsumedQuota = preConsumedQuota
+	metrics.AddQuotaPreConsumed(preConsumedQuota)
 	return nil
 }
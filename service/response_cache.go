@@ -0,0 +1,476 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/dto"
+	"yunshuAPI/logger"
+	relaycommon "yunshuAPI/relay/common"
+	relayconstant "yunshuAPI/relay/constant"
+	"yunshuAPI/relay/helper"
+	"yunshuAPI/setting/operation_setting"
+	"yunshuAPI/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 聊天补全响应缓存：按规范化后的请求精确匹配，semantic 模式下再按消息向量相似度匹配。
+// 缓存统一保存为非流式响应，流式请求命中时通过 SSE 重放
+
+type ResponseCacheEntry struct {
+	Response  dto.OpenAITextResponse `json:"response"`
+	CreatedAt int64                  `json:"created_at"`
+}
+
+// ResponseCacheLookup 一次请求的缓存查询结果，未命中时用于写入缓存
+type ResponseCacheLookup struct {
+	Key        string
+	Scope      string
+	Vector     []float32
+	Similarity float64
+}
+
+// responseCacheScope 除消息外影响输出的请求参数，参数一致的请求才可能互相命中
+type responseCacheScope struct {
+	UserId              int                   `json:"user_id,omitempty"`
+	Model               string                `json:"model"`
+	Tools               []dto.ToolCallRequest `json:"tools,omitempty"`
+	ToolChoice          any                   `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool                 `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat      *dto.ResponseFormat   `json:"response_format,omitempty"`
+	Temperature         *float64              `json:"temperature,omitempty"`
+	TopP                float64               `json:"top_p,omitempty"`
+	MaxTokens           uint                  `json:"max_tokens,omitempty"`
+	MaxCompletionTokens uint                  `json:"max_completion_tokens,omitempty"`
+	Stop                any                   `json:"stop,omitempty"`
+	Seed                float64               `json:"seed,omitempty"`
+	ReasoningEffort     string                `json:"reasoning_effort,omitempty"`
+	FrequencyPenalty    float64               `json:"frequency_penalty,omitempty"`
+	PresencePenalty     float64               `json:"presence_penalty,omitempty"`
+	LogitBias           json.RawMessage       `json:"logit_bias,omitempty"`
+	Modalities          json.RawMessage       `json:"modalities,omitempty"`
+	Audio               json.RawMessage       `json:"audio,omitempty"`
+}
+
+func hashResponseCacheKey(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func getResponseCacheMaxMemoryEntries() int {
+	maxEntries := operation_setting.GetResponseCacheSetting().MaxMemoryEntries
+	if maxEntries <= 0 {
+		return 10000
+	}
+	return maxEntries
+}
+
+func getResponseCacheTTL() time.Duration {
+	ttl := operation_setting.GetResponseCacheSetting().TTLSeconds
+	if ttl <= 0 {
+		ttl = 3600
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// getCacheableChatRequest 判断请求是否可以使用响应缓存
+func getCacheableChatRequest(c *gin.Context, info *relaycommon.RelayInfo) *dto.GeneralOpenAIRequest {
+	cacheSetting := operation_setting.GetResponseCacheSetting()
+	if !cacheSetting.IsModelEnabled(info.OriginModelName) {
+		return nil
+	}
+	if info.RelayFormat != types.RelayFormatOpenAI || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return nil
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return nil
+	}
+	request, ok := info.Request.(*dto.GeneralOpenAIRequest)
+	if !ok || request.N > 1 || len(request.Messages) == 0 {
+		return nil
+	}
+	if cacheSetting.OnlyZeroTemperature && (request.Temperature == nil || *request.Temperature != 0) {
+		return nil
+	}
+	return request
+}
+
+// semanticCacheText 拼接消息文本用于计算向量，包含非文本内容时不使用 semantic 匹配
+func semanticCacheText(messages []dto.Message) (string, bool) {
+	var sb strings.Builder
+	for i := range messages {
+		message := &messages[i]
+		if !message.IsStringContent() {
+			for _, content := range message.ParseContent() {
+				if content.Type != dto.ContentTypeText {
+					return "", false
+				}
+			}
+		}
+		if len(message.ToolCalls) > 0 || message.ToolCallId != "" {
+			return "", false
+		}
+		sb.WriteString(message.Role)
+		sb.WriteString(": ")
+		sb.WriteString(message.StringContent())
+		sb.WriteString("\n")
+	}
+	return sb.String(), true
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func loadResponseCacheEntry(store responseCacheStore, key string) *ResponseCacheEntry {
+	data, ok, err := store.Get(key)
+	if err != nil {
+		common.SysLog("failed to read response cache: " + err.Error())
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	var entry ResponseCacheEntry
+	if err := common.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// ResponseCacheEmbedder 计算语义缓存使用的文本向量
+type ResponseCacheEmbedder func(c *gin.Context, group string, text string) ([]float32, error)
+
+// LookupResponseCache 查询响应缓存。请求不可缓存时 lookup 为 nil；命中时 entry 不为 nil
+func LookupResponseCache(c *gin.Context, info *relaycommon.RelayInfo, embed ResponseCacheEmbedder) (lookup *ResponseCacheLookup, entry *ResponseCacheEntry) {
+	request := getCacheableChatRequest(c, info)
+	if request == nil {
+		return nil, nil
+	}
+	cacheSetting := operation_setting.GetResponseCacheSetting()
+	scope := responseCacheScope{
+		Model:               info.OriginModelName,
+		Tools:               request.Tools,
+		ToolChoice:          request.ToolChoice,
+		ParallelToolCalls:   request.ParallelTooCalls,
+		ResponseFormat:      request.ResponseFormat,
+		Temperature:         request.Temperature,
+		TopP:                request.TopP,
+		MaxTokens:           request.MaxTokens,
+		MaxCompletionTokens: request.MaxCompletionTokens,
+		Stop:                request.Stop,
+		Seed:                request.Seed,
+		ReasoningEffort:     request.ReasoningEffort,
+		FrequencyPenalty:    request.FrequencyPenalty,
+		PresencePenalty:     request.PresencePenalty,
+		LogitBias:           request.LogitBias,
+		Modalities:          request.Modalities,
+		Audio:               request.Audio,
+	}
+	if !cacheSetting.ShareAcrossUsers {
+		scope.UserId = info.UserId
+	}
+	scopeData, err := common.Marshal(scope)
+	if err != nil {
+		return nil, nil
+	}
+	messagesData, err := common.Marshal(request.Messages)
+	if err != nil {
+		return nil, nil
+	}
+	lookup = &ResponseCacheLookup{
+		Scope: hashResponseCacheKey(scopeData),
+	}
+	lookup.Key = hashResponseCacheKey([]byte(lookup.Scope), messagesData)
+
+	store := getResponseCacheStore()
+	if entry = loadResponseCacheEntry(store, lookup.Key); entry != nil {
+		lookup.Similarity = 1
+		return lookup, entry
+	}
+	if cacheSetting.Mode != operation_setting.ResponseCacheModeSemantic {
+		return lookup, nil
+	}
+
+	text, ok := semanticCacheText(request.Messages)
+	if !ok {
+		return lookup, nil
+	}
+	vector, err := embed(c, info.UsingGroup, text)
+	if err != nil {
+		logger.LogWarn(c, "response cache embedding failed: "+err.Error())
+		return lookup, nil
+	}
+	lookup.Vector = vector
+	candidates, err := store.Vectors(lookup.Scope)
+	if err != nil {
+		common.SysLog("failed to read response cache vectors: " + err.Error())
+		return lookup, nil
+	}
+	type candidate struct {
+		key        string
+		similarity float64
+	}
+	matched := make([]candidate, 0)
+	for key, candidateVector := range candidates {
+		similarity := cosineSimilarity(vector, candidateVector)
+		if similarity >= cacheSetting.SimilarityThreshold {
+			matched = append(matched, candidate{key: key, similarity: similarity})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].similarity > matched[j].similarity
+	})
+	for _, m := range matched {
+		if entry = loadResponseCacheEntry(store, m.key); entry != nil {
+			lookup.Similarity = m.similarity
+			return lookup, entry
+		}
+	}
+	return lookup, nil
+}
+
+// StoreResponseCache 将客户端收到的响应写入缓存，流式响应会先合并为非流式响应
+func StoreResponseCache(lookup *ResponseCacheLookup, info *relaycommon.RelayInfo, body []byte) {
+	if lookup == nil || len(body) == 0 {
+		return
+	}
+	var response *dto.OpenAITextResponse
+	var err error
+	if info.IsStream {
+		response, err = mergeChatCompletionStream(body)
+	} else {
+		response = &dto.OpenAITextResponse{}
+		err = common.Unmarshal(body, response)
+	}
+	if err != nil || response == nil || len(response.Choices) == 0 || response.Error != nil {
+		return
+	}
+	if response.Usage.TotalTokens == 0 {
+		// 客户端未要求返回 usage 时按文本估算，仅用于命中后的计费
+		completionText := ""
+		for _, choice := range response.Choices {
+			completionText += choice.Message.StringContent()
+		}
+		response.Usage.PromptTokens = info.PromptTokens
+		response.Usage.CompletionTokens = CountTextToken(completionText, info.OriginModelName)
+		response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
+	}
+	data, err := common.Marshal(ResponseCacheEntry{
+		Response:  *response,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+	ttl := getResponseCacheTTL()
+	store := getResponseCacheStore()
+	if err := store.Set(lookup.Key, data, ttl); err != nil {
+		common.SysLog("failed to write response cache: " + err.Error())
+		return
+	}
+	if len(lookup.Vector) > 0 {
+		if err := store.AddVector(lookup.Scope, lookup.Key, lookup.Vector, ttl, operation_setting.GetResponseCacheSetting().MaxSemanticCandidates); err != nil {
+			common.SysLog("failed to write response cache vector: " + err.Error())
+		}
+	}
+}
+
+// mergeChatCompletionStream 将 SSE 流合并为一个非流式的聊天补全响应
+func mergeChatCompletionStream(body []byte) (*dto.OpenAITextResponse, error) {
+	type mergedChoice struct {
+		role         string
+		content      strings.Builder
+		reasoning    strings.Builder
+		toolCalls    []dto.ToolCallResponse
+		finishReason string
+	}
+	response := &dto.OpenAITextResponse{Object: "chat.completion"}
+	choices := make(map[int]*mergedChoice)
+	maxIndex := -1
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			return nil, err
+		}
+		if response.Id == "" {
+			response.Id = chunk.Id
+			response.Model = chunk.Model
+			response.Created = chunk.Created
+		}
+		if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+			response.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			merged := choices[choice.Index]
+			if merged == nil {
+				merged = &mergedChoice{}
+				choices[choice.Index] = merged
+			}
+			if choice.Index > maxIndex {
+				maxIndex = choice.Index
+			}
+			if choice.Delta.Role != "" {
+				merged.role = choice.Delta.Role
+			}
+			merged.content.WriteString(choice.Delta.GetContentString())
+			if choice.Delta.ReasoningContent != nil {
+				merged.reasoning.WriteString(*choice.Delta.ReasoningContent)
+			} else if choice.Delta.Reasoning != nil {
+				merged.reasoning.WriteString(*choice.Delta.Reasoning)
+			}
+			for _, toolCall := range choice.Delta.ToolCalls {
+				index := len(merged.toolCalls)
+				if toolCall.Index != nil {
+					index = *toolCall.Index
+				}
+				for len(merged.toolCalls) <= index {
+					merged.toolCalls = append(merged.toolCalls, dto.ToolCallResponse{})
+				}
+				target := &merged.toolCalls[index]
+				if toolCall.ID != "" {
+					target.ID = toolCall.ID
+				}
+				if toolCall.Type != nil {
+					target.Type = toolCall.Type
+				}
+				if toolCall.Function.Name != "" {
+					target.Function.Name = toolCall.Function.Name
+				}
+				target.Function.Arguments += toolCall.Function.Arguments
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				merged.finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := 0; i <= maxIndex; i++ {
+		merged := choices[i]
+		if merged == nil {
+			continue
+		}
+		role := merged.role
+		if role == "" {
+			role = "assistant"
+		}
+		message := dto.Message{
+			Role:             role,
+			ReasoningContent: merged.reasoning.String(),
+		}
+		message.SetStringContent(merged.content.String())
+		if len(merged.toolCalls) > 0 {
+			message.SetToolCalls(merged.toolCalls)
+		}
+		response.Choices = append(response.Choices, dto.OpenAITextResponseChoice{
+			Index:        i,
+			Message:      message,
+			FinishReason: merged.finishReason,
+		})
+	}
+	return response, nil
+}
+
+// ReplayResponseCache 将缓存的响应返回给客户端，流式请求按 SSE 分块重放
+func ReplayResponseCache(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) error {
+	response := entry.Response
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdAt := time.Now().Unix()
+	c.Header("X-Response-Cache", "HIT")
+	if !info.IsStream {
+		response.Id = responseId
+		response.Created = createdAt
+		c.JSON(http.StatusOK, response)
+		return nil
+	}
+
+	helper.SetEventStreamHeaders(c)
+	for _, choice := range response.Choices {
+		delta := dto.ChatCompletionsStreamResponseChoiceDelta{
+			Role: choice.Message.Role,
+		}
+		delta.SetContentString(choice.Message.StringContent())
+		if choice.Message.ReasoningContent != "" {
+			reasoning := choice.Message.ReasoningContent
+			delta.ReasoningContent = &reasoning
+		}
+		if len(choice.Message.ToolCalls) > 0 {
+			var toolCalls []dto.ToolCallResponse
+			if err := common.Unmarshal(choice.Message.ToolCalls, &toolCalls); err == nil {
+				for i := range toolCalls {
+					toolCalls[i].SetIndex(i)
+				}
+				delta.ToolCalls = toolCalls
+			}
+		}
+		chunk := dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: createdAt,
+			Model:   response.Model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{
+				Index: choice.Index,
+				Delta: delta,
+			}},
+		}
+		if err := helper.ObjectData(c, chunk); err != nil {
+			return err
+		}
+		finishReason := choice.FinishReason
+		if finishReason == "" {
+			finishReason = "stop"
+		}
+		stop := helper.GenerateStopResponse(responseId, createdAt, response.Model, finishReason)
+		stop.Choices[0].Index = choice.Index
+		if err := helper.ObjectData(c, stop); err != nil {
+			return err
+		}
+	}
+	if request, ok := info.Request.(*dto.GeneralOpenAIRequest); ok && request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		if err := helper.ObjectData(c, helper.GenerateFinalUsageResponse(responseId, createdAt, response.Model, response.Usage)); err != nil {
+			return err
+		}
+	}
+	helper.Done(c)
+	return nil
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 响应缓存存储，启用 Redis 时多节点共享，否则保存在当前节点内存中
+
+const (
+	responseCacheKeyPrefix    = "resp_cache:entry:"
+	responseCacheVectorPrefix = "resp_cache:vec:"
+)
+
+type responseCacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	// AddVector 记录缓存范围内一条缓存的向量，用于 semantic 模式
+	AddVector(scope string, key string, vector []float32, ttl time.Duration, maxCandidates int) error
+	Vectors(scope string) (map[string][]float32, error)
+}
+
+var (
+	responseCacheStoreOnce     sync.Once
+	responseCacheStoreInstance responseCacheStore
+)
+
+func getResponseCacheStore() responseCacheStore {
+	responseCacheStoreOnce.Do(func() {
+		if common.RedisEnabled {
+			responseCacheStoreInstance = &redisResponseCacheStore{}
+		} else {
+			responseCacheStoreInstance = newMemoryResponseCacheStore()
+		}
+	})
+	return responseCacheStoreInstance
+}
+
+type redisResponseCacheStore struct{}
+
+func (s *redisResponseCacheStore) Get(key string) ([]byte, bool, error) {
+	val, err := common.RDB.Get(context.Background(), responseCacheKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+func (s *redisResponseCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	return common.RDB.Set(context.Background(), responseCacheKeyPrefix+key, value, ttl).Err()
+}
+
+func (s *redisResponseCacheStore) AddVector(scope string, key string, vector []float32, ttl time.Duration, maxCandidates int) error {
+	ctx := context.Background()
+	vectorKey := responseCacheVectorPrefix + scope
+	if maxCandidates > 0 {
+		count, err := common.RDB.HLen(ctx, vectorKey).Result()
+		if err != nil {
+			return err
+		}
+		if count >= int64(maxCandidates) {
+			return nil
+		}
+	}
+	data, err := json.Marshal(vector)
+	if err != nil {
+		return err
+	}
+	pipe := common.RDB.TxPipeline()
+	pipe.HSet(ctx, vectorKey, key, data)
+	pipe.Expire(ctx, vectorKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisResponseCacheStore) Vectors(scope string) (map[string][]float32, error) {
+	values, err := common.RDB.HGetAll(context.Background(), responseCacheVectorPrefix+scope).Result()
+	if err != nil {
+		return nil, err
+	}
+	vectors := make(map[string][]float32, len(values))
+	for key, value := range values {
+		var vector []float32
+		if err := json.Unmarshal([]byte(value), &vector); err != nil {
+			continue
+		}
+		vectors[key] = vector
+	}
+	return vectors, nil
+}
+
+type memoryResponseCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+type memoryResponseCacheVector struct {
+	vector    []float32
+	expiresAt time.Time
+}
+
+// memoryResponseCacheVectorSweepInterval 清理过期向量的最小间隔
+const memoryResponseCacheVectorSweepInterval = time.Minute
+
+// memoryResponseCacheStore 内存缓存，条目数超出上限时按 LRU 淘汰
+type memoryResponseCacheStore struct {
+	mu        sync.Mutex
+	entries   map[string]*list.Element // 元素值为 *memoryResponseCacheEntry，越靠前越近被使用
+	lru       *list.List
+	vectors   map[string]map[string]memoryResponseCacheVector
+	lastSweep time.Time
+}
+
+func newMemoryResponseCacheStore() *memoryResponseCacheStore {
+	return &memoryResponseCacheStore{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		vectors: make(map[string]map[string]memoryResponseCacheVector),
+	}
+}
+
+func (s *memoryResponseCacheStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryResponseCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.removeLocked(elem)
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (s *memoryResponseCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*memoryResponseCacheEntry)
+		entry.value = value
+		entry.expiresAt = now.Add(ttl)
+		s.lru.MoveToFront(elem)
+	} else {
+		s.entries[key] = s.lru.PushFront(&memoryResponseCacheEntry{key: key, value: value, expiresAt: now.Add(ttl)})
+	}
+	for maxEntries := getResponseCacheMaxMemoryEntries(); s.lru.Len() > maxEntries; {
+		s.removeLocked(s.lru.Back())
+	}
+	s.sweepVectorsLocked(now)
+	return nil
+}
+
+func (s *memoryResponseCacheStore) removeLocked(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*memoryResponseCacheEntry).key)
+}
+
+// sweepVectorsLocked 定期清理过期的向量
+func (s *memoryResponseCacheStore) sweepVectorsLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryResponseCacheVectorSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for scope, vectors := range s.vectors {
+		for key, vector := range vectors {
+			if now.After(vector.expiresAt) {
+				delete(vectors, key)
+			}
+		}
+		if len(vectors) == 0 {
+			delete(s.vectors, scope)
+		}
+	}
+}
+
+func (s *memoryResponseCacheStore) AddVector(scope string, key string, vector []float32, ttl time.Duration, maxCandidates int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vectors := s.vectors[scope]
+	if vectors == nil {
+		vectors = make(map[string]memoryResponseCacheVector)
+		s.vectors[scope] = vectors
+	}
+	if maxCandidates > 0 && len(vectors) >= maxCandidates {
+		return nil
+	}
+	vectors[key] = memoryResponseCacheVector{vector: vector, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryResponseCacheStore) Vectors(scope string) (map[string][]float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	result := make(map[string][]float32, len(s.vectors[scope]))
+	for key, vector := range s.vectors[scope] {
+		if now.After(vector.expiresAt) {
+			delete(s.vectors[scope], key)
+			continue
+		}
+		result[key] = vector.vector
+	}
+	return result, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 会话粘性路由：同一会话的连续请求优先发往上次使用的渠道和 key，以命中上游的提示词缓存
+
+// SessionAffinityBinding 会话绑定的渠道和 key
+type SessionAffinityBinding struct {
+	ChannelId int    `json:"channel_id"`
+	KeyIndex  int    `json:"key_index"`
+	Group     string `json:"group"`
+}
+
+type sessionAffinityRequest struct {
+	User     string `json:"user"`
+	Metadata *struct {
+		UserId string `json:"user_id"`
+	} `json:"metadata"`
+	System   json.RawMessage   `json:"system"`
+	Messages []json.RawMessage `json:"messages"`
+	Input    json.RawMessage   `json:"input"`
+	Contents []json.RawMessage `json:"contents"`
+}
+
+func hashSessionPrefix(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// deriveSessionId 依次从请求头、user 字段、消息前缀哈希获取会话标识
+func deriveSessionId(c *gin.Context, setting *operation_setting.SessionAffinitySetting) string {
+	if setting.Header != "" {
+		if sessionId := c.GetHeader(setting.Header); sessionId != "" {
+			return "h:" + sessionId
+		}
+	}
+	if !setting.UseUserField && !setting.UsePrefixHash {
+		return ""
+	}
+	var request sessionAffinityRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return ""
+	}
+	if setting.UseUserField {
+		if request.User != "" {
+			return "u:" + request.User
+		}
+		if request.Metadata != nil && request.Metadata.UserId != "" {
+			return "u:" + request.Metadata.UserId
+		}
+	}
+	if !setting.UsePrefixHash {
+		return ""
+	}
+	messages := request.Messages
+	if len(messages) == 0 {
+		messages = request.Contents
+	}
+	prefixCount := setting.PrefixMessages
+	if prefixCount <= 0 {
+		prefixCount = 1
+	}
+	parts := [][]byte{request.System}
+	if len(messages) > 0 {
+		for i := 0; i < len(messages) && i < prefixCount; i++ {
+			parts = append(parts, messages[i])
+		}
+	} else if len(request.Input) > 0 && request.Input[0] == '[' {
+		var input []json.RawMessage
+		if err := json.Unmarshal(request.Input, &input); err == nil {
+			for i := 0; i < len(input) && i < prefixCount; i++ {
+				parts = append(parts, input[i])
+			}
+		}
+	}
+	if len(parts) == 1 && len(request.System) == 0 {
+		return ""
+	}
+	return "p:" + hashSessionPrefix(parts...)
+}
+
+// GetSessionAffinityKey 返回当前请求的会话绑定键，未启用或无法识别会话时返回空字符串
+func GetSessionAffinityKey(c *gin.Context, group string, modelName string) string {
+	setting := operation_setting.GetSessionAffinitySetting()
+	if !setting.IsModelEnabled(modelName) {
+		return ""
+	}
+	sessionId := deriveSessionId(c, setting)
+	if sessionId == "" {
+		return ""
+	}
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	// 会话标识可能很长，统一哈希后作为键，绑定按用户隔离
+	return fmt.Sprintf("session_affinity:%d:%s:%s:%s", userId, group, modelName, hashSessionPrefix([]byte(sessionId)))
+}
+
+func sessionAffinityTTL() time.Duration {
+	ttl := operation_setting.GetSessionAffinitySetting().TTLSeconds
+	if ttl <= 0 {
+		ttl = 3600
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+type memorySessionAffinityEntry struct {
+	binding   SessionAffinityBinding
+	expiresAt time.Time
+}
+
+var (
+	memorySessionAffinity     = make(map[string]memorySessionAffinityEntry)
+	memorySessionAffinityLock sync.Mutex
+	memorySessionAffinityOnce sync.Once
+)
+
+func cleanupMemorySessionAffinity() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now()
+		memorySessionAffinityLock.Lock()
+		for key, entry := range memorySessionAffinity {
+			if now.After(entry.expiresAt) {
+				delete(memorySessionAffinity, key)
+			}
+		}
+		memorySessionAffinityLock.Unlock()
+	}
+}
+
+// GetSessionAffinity 返回会话绑定的渠道，不存在时返回 nil
+func GetSessionAffinity(key string) *SessionAffinityBinding {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil || value == "" {
+			return nil
+		}
+		var binding SessionAffinityBinding
+		if err := common.UnmarshalJsonStr(value, &binding); err != nil {
+			return nil
+		}
+		return &binding
+	}
+	memorySessionAffinityLock.Lock()
+	defer memorySessionAffinityLock.Unlock()
+	entry, ok := memorySessionAffinity[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	binding := entry.binding
+	return &binding
+}
+
+// SetSessionAffinity 记录（或续期）会话绑定的渠道
+func SetSessionAffinity(key string, binding SessionAffinityBinding) {
+	ttl := sessionAffinityTTL()
+	if common.RedisEnabled {
+		data, err := common.Marshal(binding)
+		if err != nil {
+			return
+		}
+		if err := common.RedisSet(key, string(data), ttl); err != nil {
+			common.SysLog("failed to save session affinity: " + err.Error())
+		}
+		return
+	}
+	memorySessionAffinityOnce.Do(func() {
+		go cleanupMemorySessionAffinity()
+	})
+	memorySessionAffinityLock.Lock()
+	memorySessionAffinity[key] = memorySessionAffinityEntry{binding: binding, expiresAt: time.Now().Add(ttl)}
+	memorySessionAffinityLock.Unlock()
+}
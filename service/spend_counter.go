@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 消费上限计数器：每个令牌/用户的每个窗口一个计数器，包含已记录的消费和进行中请求预留的额度。
+// 检查上限与预留在同一次原子操作中完成，并发请求不会基于同一个旧的用量同时通过检查。
+// 计数器不存在时以数据库中的用量初始化，启用 Redis 时多节点共享，否则保存在当前节点内存中
+
+const spendCounterKeyPrefix = "spend_limit:"
+
+var spendCounterWindows = []string{model.SpendWindowDay, model.SpendWindowWeek, model.SpendWindowMonth}
+
+var (
+	// KEYS 为计数器，ARGV[1] 为预留额度，之后每个计数器依次为上限、初始用量、过期秒数。
+	// 全部通过时返回 {0, 0}，否则返回 {未通过的计数器序号, 当前用量}
+	spendReserveScript = redis.NewScript(`
+local quota = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+    local base = 2 + (i - 1) * 3
+    redis.call('SET', key, ARGV[base + 1], 'EX', ARGV[base + 2], 'NX')
+end
+for i, key in ipairs(KEYS) do
+    local limit = tonumber(ARGV[2 + (i - 1) * 3])
+    local used = tonumber(redis.call('GET', key))
+    if used >= limit or used + quota > limit then
+        return {i, used}
+    end
+end
+for _, key in ipairs(KEYS) do
+    redis.call('INCRBY', key, quota)
+end
+return {0, 0}`)
+	// 只调整已存在的计数器，不存在的计数器在下次检查时从数据库初始化
+	spendAdjustScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+    if redis.call('EXISTS', key) == 1 then
+        redis.call('INCRBY', key, ARGV[1])
+    end
+end
+return 0`)
+)
+
+// spendCounter 一个待检查的计数器
+type spendCounter struct {
+	key     string
+	limit   int64
+	used    int64 // 数据库中的用量，计数器不存在时作为初始值
+	resetAt int64
+}
+
+func spendCounterKey(subjectType string, subjectId int, window string, resetAt int64) string {
+	return fmt.Sprintf("%s%s:%d:%s:%d", spendCounterKeyPrefix, subjectType, subjectId, window, resetAt)
+}
+
+// spendCounterKeys 返回主体当前各窗口的计数器
+func spendCounterKeys(subjectType string, subjectId int) []string {
+	now := time.Now()
+	keys := make([]string, 0, len(spendCounterWindows))
+	for _, window := range spendCounterWindows {
+		keys = append(keys, spendCounterKey(subjectType, subjectId, window, model.SpendWindowResetAt(window, now)))
+	}
+	return keys
+}
+
+// monthSpendCounterKey 主体本月已记录消费的计数器，不包含预留额度，用于阶梯计价
+func monthSpendCounterKey(subjectType string, subjectId int, resetAt int64) string {
+	return fmt.Sprintf("%s%s:%d:recorded:%d", spendCounterKeyPrefix, subjectType, subjectId, resetAt)
+}
+
+// getMonthQuotaSpend 返回主体本月已记录的消费，计数器不存在时从数据库汇总并缓存到本月结束
+func getMonthQuotaSpend(subjectType string, subjectId int) (int64, error) {
+	resetAt := model.SpendWindowResetAt(model.SpendWindowMonth, time.Now())
+	key := monthSpendCounterKey(subjectType, subjectId, resetAt)
+	ctx := context.Background()
+	if common.RedisEnabled {
+		used, err := common.RDB.Get(ctx, key).Int64()
+		if err == nil {
+			return used, nil
+		}
+		if err != redis.Nil {
+			return 0, err
+		}
+	} else if used, ok := memorySpendCounters.get(key); ok {
+		return used, nil
+	}
+	used, _, _, err := model.GetMonthQuotaSpend(subjectType, subjectId)
+	if err != nil {
+		return 0, err
+	}
+	expireAt := resetAt + 3600
+	if common.RedisEnabled {
+		// 其他请求已初始化计数器时以计数器为准
+		ok, err := common.RDB.SetNX(ctx, key, used, time.Until(time.Unix(expireAt, 0))).Result()
+		if err != nil || ok {
+			return used, err
+		}
+		return common.RDB.Get(ctx, key).Int64()
+	}
+	return memorySpendCounters.init(key, used, expireAt), nil
+}
+
+// reserveSpendCounters 所有计数器加上 quota 后都不超过上限时原子地预留，否则返回未通过的计数器及其当前用量
+func reserveSpendCounters(counters []spendCounter, quota int) (failed int, used int64, err error) {
+	if common.RedisEnabled {
+		keys := make([]string, 0, len(counters))
+		args := make([]any, 0, 1+len(counters)*3)
+		args = append(args, quota)
+		now := time.Now().Unix()
+		for _, counter := range counters {
+			keys = append(keys, counter.key)
+			// 计数器在窗口重置后再保留一小时，供结算时调整
+			args = append(args, counter.limit, counter.used, max(counter.resetAt-now, 0)+3600)
+		}
+		result, err := spendReserveScript.Run(context.Background(), common.RDB, keys, args...).Int64Slice()
+		if err != nil {
+			return -1, 0, err
+		}
+		return int(result[0]) - 1, result[1], nil
+	}
+	return memorySpendCounters.reserve(counters, quota)
+}
+
+// adjustSpendCounters 调整已存在的计数器，quota 为负数时表示退款或释放预留
+func adjustSpendCounters(keys []string, quota int) {
+	if len(keys) == 0 || quota == 0 {
+		return
+	}
+	if common.RedisEnabled {
+		if err := spendAdjustScript.Run(context.Background(), common.RDB, keys, quota).Err(); err != nil {
+			common.SysLog("failed to adjust spend counters: " + err.Error())
+		}
+		return
+	}
+	memorySpendCounters.adjust(keys, quota)
+}
+
+type memorySpendCounter struct {
+	used     int64
+	expireAt int64
+}
+
+type memorySpendCounterStore struct {
+	mu        sync.Mutex
+	counters  map[string]*memorySpendCounter
+	cleanOnce sync.Once
+}
+
+var memorySpendCounters = &memorySpendCounterStore{counters: make(map[string]*memorySpendCounter)}
+
+func (s *memorySpendCounterStore) reserve(counters []spendCounter, quota int) (int, int64, error) {
+	s.cleanOnce.Do(func() {
+		go s.clearExpiredCounters()
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	current := make([]*memorySpendCounter, len(counters))
+	for i, counter := range counters {
+		c, ok := s.counters[counter.key]
+		if !ok || c.expireAt <= now {
+			c = &memorySpendCounter{used: counter.used, expireAt: counter.resetAt + 3600}
+			s.counters[counter.key] = c
+		}
+		current[i] = c
+	}
+	for i, counter := range counters {
+		if current[i].used >= counter.limit || current[i].used+int64(quota) > counter.limit {
+			return i, current[i].used, nil
+		}
+	}
+	for _, c := range current {
+		c.used += int64(quota)
+	}
+	return -1, 0, nil
+}
+
+// clearExpiredCounters 定期删除已过期的计数器
+func (s *memorySpendCounterStore) clearExpiredCounters() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now().Unix()
+		s.mu.Lock()
+		for key, c := range s.counters {
+			if c.expireAt <= now {
+				delete(s.counters, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *memorySpendCounterStore) get(key string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	if !ok || c.expireAt <= time.Now().Unix() {
+		return 0, false
+	}
+	return c.used, true
+}
+
+// init 计数器不存在时以 used 初始化，返回计数器的当前值
+func (s *memorySpendCounterStore) init(key string, used int64, expireAt int64) int64 {
+	s.cleanOnce.Do(func() {
+		go s.clearExpiredCounters()
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok && c.expireAt > time.Now().Unix() {
+		return c.used
+	}
+	s.counters[key] = &memorySpendCounter{used: used, expireAt: expireAt}
+	return used
+}
+
+func (s *memorySpendCounterStore) adjust(keys []string, quota int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if c, ok := s.counters[key]; ok {
+			c.used += int64(quota)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/logger"
+	"yunshuAPI/model"
+	relaycommon "yunshuAPI/relay/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+var spendWindowNames = map[string]string{
+	model.SpendWindowDay:   "每日",
+	model.SpendWindowWeek:  "每周",
+	model.SpendWindowMonth: "每月",
+}
+
+// reserveSpendLimit 检查主体已设置上限的各窗口，通过时原子地预留 quota，返回预留的计数器
+func reserveSpendLimit(subject string, subjectType string, subjectId int, limits model.SpendLimits, quota int) ([]string, error) {
+	statuses, err := model.GetSpendLimitStatus(subjectType, subjectId, limits)
+	if err != nil || len(statuses) == 0 {
+		return nil, err
+	}
+	counters := make([]spendCounter, 0, len(statuses))
+	keys := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		key := spendCounterKey(subjectType, subjectId, status.Window, status.ResetAt)
+		counters = append(counters, spendCounter{key: key, limit: int64(status.Limit), used: status.Used, resetAt: status.ResetAt})
+		keys = append(keys, key)
+	}
+	failed, used, err := reserveSpendCounters(counters, quota)
+	if err != nil {
+		return nil, err
+	}
+	if failed >= 0 {
+		status := statuses[failed]
+		return nil, fmt.Errorf("%s%s消费上限已达到，上限: %s, 已使用: %s, 将于 %s 重置", subject, spendWindowNames[status.Window],
+			logger.FormatQuota(status.Limit), logger.FormatQuota(int(used)), time.Unix(status.ResetAt, 0).Format("2006-01-02 15:04:05"))
+	}
+	return keys, nil
+}
+
+// CheckSpendLimits 检查令牌和用户的日/周/月消费上限，quota 为本次预计消耗的额度。
+// 通过时在计数器中预留该额度，请求结束后调用 ReleaseSpendReservation 释放
+func CheckSpendLimits(relayInfo *relaycommon.RelayInfo, quota int) error {
+	var keys []string
+	if !relayInfo.IsPlayground && relayInfo.TokenKey != "" {
+		token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+		if err != nil {
+			return err
+		}
+		tokenKeys, err := reserveSpendLimit("令牌", model.SpendSubjectToken, token.Id, token.GetSpendLimits(), quota)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, tokenKeys...)
+	}
+	user, err := model.GetUserCache(relayInfo.UserId)
+	if err == nil {
+		var userKeys []string
+		userKeys, err = reserveSpendLimit("用户", model.SpendSubjectUser, relayInfo.UserId, user.GetSpendLimits(), quota)
+		keys = append(keys, userKeys...)
+	}
+	if err != nil {
+		// 用户上限未通过时撤销令牌的预留
+		adjustSpendCounters(keys, -quota)
+		return err
+	}
+	if len(keys) > 0 && quota > 0 {
+		relayInfo.SpendReservation = &relaycommon.SpendReservation{Keys: keys, Quota: quota}
+	}
+	return nil
+}
+
+// releaseSpendReservation 释放预留额度中的 quota 部分，超过剩余预留时全部释放
+func releaseSpendReservation(relayInfo *relaycommon.RelayInfo, quota int) {
+	reservation := relayInfo.SpendReservation
+	if reservation == nil || quota <= 0 {
+		return
+	}
+	quota = min(quota, reservation.Quota)
+	adjustSpendCounters(reservation.Keys, -quota)
+	reservation.Quota -= quota
+	if reservation.Quota == 0 {
+		relayInfo.SpendReservation = nil
+	}
+}
+
+// ReleaseSpendReservation 请求结束后释放剩余的预留额度，实际消费已由 RecordQuotaSpend 记录
+func ReleaseSpendReservation(relayInfo *relaycommon.RelayInfo) {
+	if relayInfo == nil || relayInfo.SpendReservation == nil {
+		return
+	}
+	releaseSpendReservation(relayInfo, relayInfo.SpendReservation.Quota)
+}
+
+// RecordQuotaSpend 记录令牌和用户的消费，用于消费上限统计，quota 为负数时表示退款。
+// 计数器同步调整，数据库记录异步写入
+func RecordQuotaSpend(userId int, tokenId int, quota int) {
+	if quota == 0 {
+		return
+	}
+	if tokenId != 0 {
+		adjustSpendCounters(spendCounterKeys(model.SpendSubjectToken, tokenId), quota)
+	}
+	userKeys := spendCounterKeys(model.SpendSubjectUser, userId)
+	userKeys = append(userKeys, monthSpendCounterKey(model.SpendSubjectUser, userId, model.SpendWindowResetAt(model.SpendWindowMonth, time.Now())))
+	adjustSpendCounters(userKeys, quota)
+	gopool.Go(func() {
+		if tokenId != 0 {
+			if err := model.AddQuotaSpend(model.SpendSubjectToken, tokenId, quota); err != nil {
+				common.SysLog("failed to record token spend: " + err.Error())
+			}
+		}
+		if err := model.AddQuotaSpend(model.SpendSubjectUser, userId, quota); err != nil {
+			common.SysLog("failed to record user spend: " + err.Error())
+		}
+	})
+}
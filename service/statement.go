@@ -0,0 +1,325 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+)
+
+// 月度对账单：期初余额 + 充值 + 兑换 + 退款 - 消费 + 其他变动 = 期末余额
+
+type StatementTopUp struct {
+	TradeNo       string  `json:"trade_no"`
+	PaymentMethod string  `json:"payment_method"`
+	Money         float64 `json:"money"`
+	Quota         int64   `json:"quota"`
+	CompleteTime  int64   `json:"complete_time"`
+}
+
+type StatementRedemption struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Quota        int64  `json:"quota"`
+	RedeemedTime int64  `json:"redeemed_time"`
+}
+
+type StatementRefund struct {
+	Content   string `json:"content"`
+	Quota     int64  `json:"quota"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// StatementTotal 按模型或令牌汇总的消费
+type StatementTotal struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+	Quota int64  `json:"quota"`
+}
+
+type Statement struct {
+	UserId      int    `json:"user_id"`
+	Username    string `json:"username"`
+	Month       string `json:"month"`
+	PeriodStart int64  `json:"period_start"`
+	PeriodEnd   int64  `json:"period_end"`
+	GeneratedAt int64  `json:"generated_at"`
+
+	OpeningBalance int64 `json:"opening_balance"`
+	ClosingBalance int64 `json:"closing_balance"`
+	// 缺少月初余额快照时，期初或期末余额由已知余额和当月收支推算，此时不计算其他变动
+	BalanceEstimated bool `json:"balance_estimated"`
+
+	TopUps           []StatementTopUp           `json:"top_ups"`
+	TopUpTotal       int64                      `json:"top_up_total"`
+	Redemptions      []StatementRedemption      `json:"redemptions"`
+	RedemptionTotal  int64                      `json:"redemption_total"`
+	Refunds          []StatementRefund          `json:"refunds"`
+	RefundTotal      int64                      `json:"refund_total"`
+	Consumption      []model.ConsumptionSummary `json:"consumption"`
+	ConsumptionModel []StatementTotal           `json:"consumption_by_model"`
+	ConsumptionToken []StatementTotal           `json:"consumption_by_token"`
+	ConsumptionTotal int64                      `json:"consumption_total"`
+	// 管理员调整、注册赠送、未结算的预扣费等无法从账单明细得出的变动
+	Adjustments int64 `json:"adjustments"`
+
+	QuotaPerUnit float64 `json:"quota_per_unit"`
+}
+
+// NetChange 返回账单明细带来的余额变动
+func (s *Statement) NetChange() int64 {
+	return s.TopUpTotal + s.RedemptionTotal + s.RefundTotal - s.ConsumptionTotal
+}
+
+// ParseStatementMonth 解析 2006-01 形式的月份，返回当月的起止时间
+func ParseStatementMonth(month string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("月份格式错误，应为 YYYY-MM")
+	}
+	if start.After(time.Now()) {
+		return time.Time{}, time.Time{}, errors.New("不能生成未来月份的账单")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// GetStatementMonths 返回最近可查询账单的月份，最新的在前
+func GetStatementMonths(count int) []string {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	months := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		months = append(months, start.AddDate(0, -i, 0).Format("2006-01"))
+	}
+	return months
+}
+
+func sumStatementTotals(totals map[string]*StatementTotal) []StatementTotal {
+	result := make([]StatementTotal, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Quota > result[j].Quota
+	})
+	return result
+}
+
+// fillStatementEntries 查询时间范围内的充值、兑换、退款和消费
+func fillStatementEntries(statement *Statement, userId int, start int64, end int64) error {
+	topUps, err := model.GetUserTopUpsBetween(userId, start, end)
+	if err != nil {
+		return err
+	}
+	statement.TopUps = make([]StatementTopUp, 0, len(topUps))
+	for _, topUp := range topUps {
+		quota := int64(topUp.CreditedQuota())
+		statement.TopUps = append(statement.TopUps, StatementTopUp{
+			TradeNo:       topUp.TradeNo,
+			PaymentMethod: topUp.PaymentMethod,
+			Money:         topUp.Money,
+			Quota:         quota,
+			CompleteTime:  topUp.CompleteTime,
+		})
+		statement.TopUpTotal += quota
+	}
+
+	redemptions, err := model.GetUserRedemptionsBetween(userId, start, end)
+	if err != nil {
+		return err
+	}
+	statement.Redemptions = make([]StatementRedemption, 0, len(redemptions))
+	for _, redemption := range redemptions {
+		statement.Redemptions = append(statement.Redemptions, StatementRedemption{
+			Id:           redemption.Id,
+			Name:         redemption.Name,
+			Quota:        int64(redemption.Quota),
+			RedeemedTime: redemption.RedeemedTime,
+		})
+		statement.RedemptionTotal += int64(redemption.Quota)
+	}
+
+	refunds, err := model.GetUserLogsBetween(userId, model.LogTypeRefund, start, end)
+	if err != nil {
+		return err
+	}
+	statement.Refunds = make([]StatementRefund, 0, len(refunds))
+	for _, refund := range refunds {
+		statement.Refunds = append(statement.Refunds, StatementRefund{
+			Content:   refund.Content,
+			Quota:     int64(refund.Quota),
+			CreatedAt: refund.CreatedAt,
+		})
+		statement.RefundTotal += int64(refund.Quota)
+	}
+
+	consumption, err := model.GetUserConsumptionSummary(userId, start, end)
+	if err != nil {
+		return err
+	}
+	statement.Consumption = consumption
+	byModel := make(map[string]*StatementTotal)
+	byToken := make(map[string]*StatementTotal)
+	addTotal := func(totals map[string]*StatementTotal, name string, item model.ConsumptionSummary) {
+		total, ok := totals[name]
+		if !ok {
+			total = &StatementTotal{Name: name}
+			totals[name] = total
+		}
+		total.Count += item.Count
+		total.Quota += item.Quota
+	}
+	for _, item := range consumption {
+		statement.ConsumptionTotal += item.Quota
+		addTotal(byModel, item.ModelName, item)
+		addTotal(byToken, item.TokenName, item)
+	}
+	statement.ConsumptionModel = sumStatementTotals(byModel)
+	statement.ConsumptionToken = sumStatementTotals(byToken)
+	return nil
+}
+
+// BuildMonthlyStatement 生成用户某月的对账单，month 形如 2026-01
+func BuildMonthlyStatement(userId int, month string) (*Statement, error) {
+	start, end, err := ParseStatementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	statement := &Statement{
+		UserId:       user.Id,
+		Username:     user.Username,
+		Month:        month,
+		PeriodStart:  start.Unix(),
+		PeriodEnd:    end.Unix(),
+		GeneratedAt:  common.GetTimestamp(),
+		QuotaPerUnit: common.QuotaPerUnit,
+	}
+	if err = fillStatementEntries(statement, userId, start.Unix(), end.Unix()); err != nil {
+		return nil, err
+	}
+
+	opening, err := model.GetUserQuotaSnapshot(userId, model.StatementMonth(start))
+	if err != nil {
+		return nil, err
+	}
+	var closing *int64
+	if end.After(time.Now()) {
+		// 当月账单以当前余额作为期末余额
+		quota := int64(user.Quota)
+		closing = &quota
+	} else {
+		snapshot, err := model.GetUserQuotaSnapshot(userId, model.StatementMonth(end))
+		if err != nil {
+			return nil, err
+		}
+		if snapshot != nil {
+			quota := int64(snapshot.Quota)
+			closing = &quota
+		}
+	}
+
+	switch {
+	case opening != nil && closing != nil:
+		statement.OpeningBalance = int64(opening.Quota)
+		statement.ClosingBalance = *closing
+		statement.Adjustments = statement.ClosingBalance - statement.OpeningBalance - statement.NetChange()
+	case opening != nil:
+		statement.BalanceEstimated = true
+		statement.OpeningBalance = int64(opening.Quota)
+		statement.ClosingBalance = statement.OpeningBalance + statement.NetChange()
+	default:
+		statement.BalanceEstimated = true
+		if closing == nil {
+			// 没有任何快照时，用当前余额减去账单期之后的收支推算期末余额
+			after := &Statement{}
+			if err = fillStatementEntries(after, userId, end.Unix(), common.GetTimestamp()); err != nil {
+				return nil, err
+			}
+			quota := int64(user.Quota) - after.NetChange()
+			closing = &quota
+		}
+		statement.ClosingBalance = *closing
+		statement.OpeningBalance = statement.ClosingBalance - statement.NetChange()
+	}
+	return statement, nil
+}
+
+func formatStatementQuota(quota int64) string {
+	return strconv.FormatInt(quota, 10)
+}
+
+func formatStatementAmount(quota int64) string {
+	if common.QuotaPerUnit == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(quota)/common.QuotaPerUnit, 'f', 6, 64)
+}
+
+func formatStatementTime(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+// WriteStatementCSV 以 CSV 输出对账单，每行一个条目，金额同时给出额度和美元
+func WriteStatementCSV(w io.Writer, s *Statement) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{
+		{"section", "time", "description", "model", "token", "count", "prompt_tokens", "completion_tokens", "quota", "amount"},
+		{"summary", formatStatementTime(s.PeriodStart), "opening_balance", "", "", "", "", "", formatStatementQuota(s.OpeningBalance), formatStatementAmount(s.OpeningBalance)},
+	}
+	for _, topUp := range s.TopUps {
+		rows = append(rows, []string{"top_up", formatStatementTime(topUp.CompleteTime), fmt.Sprintf("%s %s", topUp.PaymentMethod, topUp.TradeNo), "", "", "", "", "", formatStatementQuota(topUp.Quota), formatStatementAmount(topUp.Quota)})
+	}
+	for _, redemption := range s.Redemptions {
+		rows = append(rows, []string{"redemption", formatStatementTime(redemption.RedeemedTime), fmt.Sprintf("#%d %s", redemption.Id, redemption.Name), "", "", "", "", "", formatStatementQuota(redemption.Quota), formatStatementAmount(redemption.Quota)})
+	}
+	for _, refund := range s.Refunds {
+		rows = append(rows, []string{"refund", formatStatementTime(refund.CreatedAt), refund.Content, "", "", "", "", "", formatStatementQuota(refund.Quota), formatStatementAmount(refund.Quota)})
+	}
+	for _, item := range s.Consumption {
+		rows = append(rows, []string{"consumption", "", "", item.ModelName, item.TokenName, strconv.FormatInt(item.Count, 10),
+			strconv.FormatInt(item.PromptTokens, 10), strconv.FormatInt(item.CompletionTokens, 10), formatStatementQuota(-item.Quota), formatStatementAmount(-item.Quota)})
+	}
+	if !s.BalanceEstimated {
+		rows = append(rows, []string{"adjustment", "", "other_adjustments", "", "", "", "", "", formatStatementQuota(s.Adjustments), formatStatementAmount(s.Adjustments)})
+	}
+	closingDescription := "closing_balance"
+	if s.BalanceEstimated {
+		closingDescription = "closing_balance (estimated)"
+	}
+	rows = append(rows, []string{"summary", formatStatementTime(s.PeriodEnd), closingDescription, "", "", "", "", "", formatStatementQuota(s.ClosingBalance), formatStatementAmount(s.ClosingBalance)})
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// SnapshotUserQuotasMonthly 每月第一天为所有用户记录月初余额，错过第一天的月份不补记，以免把月中余额当作期初余额
+func SnapshotUserQuotasMonthly() {
+	for {
+		now := time.Now()
+		if now.Day() == 1 {
+			month := model.StatementMonth(now)
+			rows, err := model.SnapshotUserQuotas(month)
+			if err != nil {
+				common.SysLog("failed to snapshot user quotas: " + err.Error())
+			} else if rows > 0 {
+				common.SysLog(fmt.Sprintf("recorded %d user quota snapshots for %d", rows, month))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
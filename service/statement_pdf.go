@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 对账单的 PDF 输出，使用 PDF 内置的 Courier 字体逐行输出文本，不依赖第三方库。
+// 内置字体不包含中文字形，非 ASCII 字符会以 ? 显示，需要完整内容时请使用 CSV 或 JSON
+
+const (
+	statementPdfPageWidth    = 595 // A4
+	statementPdfPageHeight   = 842
+	statementPdfMargin       = 40
+	statementPdfFontSize     = 9
+	statementPdfLineHeight   = 12
+	statementPdfLinesPerPage = (statementPdfPageHeight - 2*statementPdfMargin) / statementPdfLineHeight
+)
+
+func pdfEscapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func statementPdfLines(s *Statement) []string {
+	amount := func(quota int64) string {
+		return fmt.Sprintf("%14d  %14s", quota, formatStatementAmount(quota))
+	}
+	lines := []string{
+		fmt.Sprintf("Monthly Statement %s", s.Month),
+		fmt.Sprintf("User: %s (#%d)", s.Username, s.UserId),
+		fmt.Sprintf("Period: %s - %s", formatStatementTime(s.PeriodStart), formatStatementTime(s.PeriodEnd)),
+		fmt.Sprintf("Generated: %s", formatStatementTime(s.GeneratedAt)),
+		"",
+		fmt.Sprintf("%-40s  %14s  %14s", "", "quota", "amount (USD)"),
+		fmt.Sprintf("%-40s  %s", "Opening balance", amount(s.OpeningBalance)),
+		fmt.Sprintf("%-40s  %s", "Top-ups", amount(s.TopUpTotal)),
+		fmt.Sprintf("%-40s  %s", "Redemptions", amount(s.RedemptionTotal)),
+		fmt.Sprintf("%-40s  %s", "Refunds", amount(s.RefundTotal)),
+		fmt.Sprintf("%-40s  %s", "Consumption", amount(-s.ConsumptionTotal)),
+	}
+	if !s.BalanceEstimated {
+		lines = append(lines, fmt.Sprintf("%-40s  %s", "Other adjustments", amount(s.Adjustments)))
+	}
+	closing := "Closing balance"
+	if s.BalanceEstimated {
+		closing = "Closing balance (estimated)"
+	}
+	lines = append(lines, fmt.Sprintf("%-40s  %s", closing, amount(s.ClosingBalance)))
+
+	if len(s.TopUps) > 0 {
+		lines = append(lines, "", "Top-ups")
+		for _, topUp := range s.TopUps {
+			lines = append(lines, fmt.Sprintf("  %-19s %-18s %s", formatStatementTime(topUp.CompleteTime), topUp.PaymentMethod, amount(topUp.Quota)))
+		}
+	}
+	if len(s.Redemptions) > 0 {
+		lines = append(lines, "", "Redemptions")
+		for _, redemption := range s.Redemptions {
+			lines = append(lines, fmt.Sprintf("  %-19s #%-17d %s", formatStatementTime(redemption.RedeemedTime), redemption.Id, amount(redemption.Quota)))
+		}
+	}
+	if len(s.Refunds) > 0 {
+		lines = append(lines, "", "Refunds")
+		for _, refund := range s.Refunds {
+			lines = append(lines, fmt.Sprintf("  %-38s %s", formatStatementTime(refund.CreatedAt), amount(refund.Quota)))
+		}
+	}
+	if len(s.ConsumptionModel) > 0 {
+		lines = append(lines, "", "Consumption by model")
+		for _, total := range s.ConsumptionModel {
+			lines = append(lines, fmt.Sprintf("  %-30.30s %7d %s", total.Name, total.Count, amount(total.Quota)))
+		}
+		lines = append(lines, "", "Consumption by token")
+		for _, total := range s.ConsumptionToken {
+			lines = append(lines, fmt.Sprintf("  %-30.30s %7d %s", total.Name, total.Count, amount(total.Quota)))
+		}
+	}
+	return lines
+}
+
+// WriteStatementPDF 以 PDF 输出对账单
+func WriteStatementPDF(w io.Writer, s *Statement) error {
+	lines := statementPdfLines(s)
+	var pages [][]string
+	for len(lines) > 0 {
+		n := statementPdfLinesPerPage
+		if n > len(lines) {
+			n = len(lines)
+		}
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+
+	// 对象编号：1 目录，2 页面树，3 字体，之后每页依次为页面和内容流
+	var buf bytes.Buffer
+	offsets := []int{0}
+	writeObject := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets)-1, body)
+	}
+	buf.WriteString("%PDF-1.4\n")
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, 0, len(pages))
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+i*2))
+	}
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			statementPdfPageWidth, statementPdfPageHeight, 5+i*2))
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", statementPdfFontSize, statementPdfLineHeight,
+			statementPdfMargin, statementPdfPageHeight-statementPdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscapeText(line))
+		}
+		content.WriteString("ET")
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
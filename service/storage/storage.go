@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+)
+
+const (
+	TypeLocal = "local"
+	TypeS3    = "s3"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage 网关自有的对象存储，文件、批处理结果等均通过该接口读写
+type Storage interface {
+	Name() string
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultStorage     Storage
+	defaultStorageErr  error
+	defaultStorageOnce sync.Once
+)
+
+// GetStorage 返回根据环境变量初始化的默认存储
+func GetStorage() (Storage, error) {
+	defaultStorageOnce.Do(func() {
+		defaultStorage, defaultStorageErr = NewStorage(constant.StorageType)
+		if defaultStorageErr == nil {
+			common.SysLog(fmt.Sprintf("object storage initialized: %s", defaultStorage.Name()))
+		}
+	})
+	return defaultStorage, defaultStorageErr
+}
+
+func NewStorage(storageType string) (Storage, error) {
+	switch strings.ToLower(storageType) {
+	case "", TypeLocal:
+		return NewLocalStorage(constant.StorageLocalDir)
+	case TypeS3:
+		return NewS3Storage(S3Config{
+			Endpoint:        constant.StorageS3Endpoint,
+			Region:          constant.StorageS3Region,
+			Bucket:          constant.StorageS3Bucket,
+			AccessKeyId:     constant.StorageS3AccessKeyId,
+			SecretAccessKey: constant.StorageS3SecretAccessKey,
+			UsePathStyle:    constant.StorageS3UsePathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", storageType)
+	}
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+	"yunshuAPI/model"
+	"yunshuAPI/setting/operation_setting"
+	"yunshuAPI/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 异步任务完成回调：任务成功或失败时向提交时指定（或令牌默认）的地址 POST 结果，
+// 签名方式与用户 webhook 通知相同，投递失败按指数退避重试，每次投递都记录在 TaskCallbackDelivery 中
+
+const (
+	TaskCallbackEventSucceeded = "task.succeeded"
+	TaskCallbackEventFailed    = "task.failed"
+	TaskCallbackEventCancelled = "task.cancelled"
+
+	taskCallbackMaxRetryInterval = time.Hour
+	taskCallbackBatchSize        = 50
+	// 同时投递的回调数，避免个别慢速地址阻塞整批投递
+	taskCallbackWorkers = 10
+)
+
+// TaskCallbackPayload 回调请求的负载
+type TaskCallbackPayload struct {
+	Event      string          `json:"event"`
+	TaskType   string          `json:"task_type"`
+	TaskId     string          `json:"task_id"`
+	Model      string          `json:"model,omitempty"`
+	Action     string          `json:"action"`
+	Status     string          `json:"status"`
+	Progress   string          `json:"progress"`
+	FailReason string          `json:"fail_reason,omitempty"`
+	ResultUrl  string          `json:"result_url,omitempty"`
+	ImageUrl   string          `json:"image_url,omitempty"`
+	VideoUrl   string          `json:"video_url,omitempty"`
+	SubmitTime int64           `json:"submit_time"`
+	FinishTime int64           `json:"finish_time"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Timestamp  int64           `json:"timestamp"`
+}
+
+// GetTaskCallbackUrl 读取提交请求中的 callback_url（JSON 或表单字段），未指定时使用令牌的默认回调地址
+func GetTaskCallbackUrl(c *gin.Context) (string, error) {
+	if !operation_setting.GetTaskCallbackSetting().Enabled {
+		return "", nil
+	}
+	callbackUrl := ""
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") || c.ContentType() == "application/x-www-form-urlencoded" {
+		callbackUrl = c.PostForm("callback_url")
+	} else if body, err := common.GetRequestBody(c); err == nil {
+		callbackUrl = gjson.GetBytes(body, "callback_url").String()
+	}
+	callbackUrl = strings.TrimSpace(callbackUrl)
+	if callbackUrl == "" {
+		callbackUrl = common.GetContextKeyString(c, constant.ContextKeyTokenCallbackUrl)
+	}
+	if callbackUrl == "" {
+		return "", nil
+	}
+	if err := ValidateTaskCallbackUrl(callbackUrl); err != nil {
+		return "", err
+	}
+	return callbackUrl, nil
+}
+
+// ValidateTaskCallbackUrl 校验回调地址的格式，并按请求限制设置做 SSRF 检查
+func ValidateTaskCallbackUrl(callbackUrl string) error {
+	if len(callbackUrl) > 512 {
+		return errors.New("callback_url is too long")
+	}
+	u, err := url.Parse(callbackUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("callback_url must be an http or https url")
+	}
+	fetchSetting := system_setting.GetFetchSetting()
+	if err = common.ValidateURLWithFetchSetting(callbackUrl, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("callback_url rejected: %v", err)
+	}
+	return nil
+}
+
+func taskCallbackEvent(status string) string {
+	switch status {
+	case string(model.TaskStatusSuccess):
+		return TaskCallbackEventSucceeded
+	case string(model.TaskStatusFailure):
+		return TaskCallbackEventFailed
+	case string(model.TaskStatusCancelled):
+		return TaskCallbackEventCancelled
+	}
+	return ""
+}
+
+// NotifyTaskFinished 任务从未完成变为成功、失败或取消时投递回调，preStatus 为本次更新前的状态
+func NotifyTaskFinished(task *model.Task, preStatus model.TaskStatus) {
+	if task == nil || task.CallbackUrl == "" || preStatus == task.Status {
+		return
+	}
+	event := taskCallbackEvent(string(task.Status))
+	if event == "" || preStatus == model.TaskStatusSuccess || preStatus == model.TaskStatusFailure ||
+		preStatus == model.TaskStatusCancelled {
+		return
+	}
+	payload := TaskCallbackPayload{
+		Event:      event,
+		TaskType:   model.TaskCallbackTypeTask,
+		TaskId:     task.TaskID,
+		Model:      task.Properties.OriginModelName,
+		Action:     task.Action,
+		Status:     string(task.Status),
+		Progress:   task.Progress,
+		SubmitTime: task.SubmitTime,
+		FinishTime: task.FinishTime,
+		Data:       task.Data,
+	}
+	// 视频任务成功时结果地址保存在 FailReason 中
+	if task.Status == model.TaskStatusSuccess {
+		if strings.HasPrefix(task.FailReason, "http") {
+			payload.ResultUrl = task.FailReason
+		}
+	} else {
+		payload.FailReason = task.FailReason
+	}
+	enqueueTaskCallback(task.UserId, task.CallbackUrl, payload)
+}
+
+// NotifyMidjourneyFinished Midjourney 任务从未完成变为成功或失败时投递回调，preStatus 为本次更新前的状态
+func NotifyMidjourneyFinished(task *model.Midjourney, preStatus string) {
+	if task == nil || task.CallbackUrl == "" || preStatus == task.Status {
+		return
+	}
+	event := taskCallbackEvent(task.Status)
+	if event == "" || taskCallbackEvent(preStatus) != "" {
+		return
+	}
+	payload := TaskCallbackPayload{
+		Event:      event,
+		TaskType:   model.TaskCallbackTypeMidjourney,
+		TaskId:     task.MjId,
+		Action:     task.Action,
+		Status:     task.Status,
+		Progress:   task.Progress,
+		FailReason: task.FailReason,
+		ImageUrl:   task.ImageUrl,
+		VideoUrl:   task.VideoUrl,
+		SubmitTime: task.SubmitTime,
+		FinishTime: task.FinishTime,
+	}
+	if task.Buttons != "" && json.Valid([]byte(task.Buttons)) {
+		payload.Data = json.RawMessage(fmt.Sprintf(`{"buttons":%s}`, task.Buttons))
+	}
+	enqueueTaskCallback(task.UserId, task.CallbackUrl, payload)
+}
+
+func enqueueTaskCallback(userId int, callbackUrl string, payload TaskCallbackPayload) {
+	payload.Timestamp = time.Now().Unix()
+	data, err := common.Marshal(payload)
+	if err != nil {
+		common.SysLog("failed to marshal task callback payload: " + err.Error())
+		return
+	}
+	delivery := &model.TaskCallbackDelivery{
+		UserId:        userId,
+		TaskType:      payload.TaskType,
+		TaskId:        payload.TaskId,
+		Url:           callbackUrl,
+		Event:         payload.Event,
+		Payload:       string(data),
+		Status:        model.TaskCallbackStatusPending,
+		NextAttemptAt: common.GetTimestamp(),
+	}
+	if err = delivery.Insert(); err != nil {
+		common.SysLog(fmt.Sprintf("failed to enqueue callback for task %s: %s", payload.TaskId, err.Error()))
+	}
+}
+
+// DeliverTaskCallback 投递一次回调并更新投递记录，失败时安排下一次重试
+func DeliverTaskCallback(delivery *model.TaskCallbackDelivery) {
+	setting := operation_setting.GetTaskCallbackSetting()
+	secret := ""
+	if userSetting, err := model.GetUserSetting(delivery.UserId, false); err == nil {
+		secret = userSetting.WebhookSecret
+	}
+	timeout := time.Duration(setting.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	statusCode, err := PostSignedWebhook(ctx, delivery.Url, secret, []byte(delivery.Payload))
+	cancel()
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = model.TaskCallbackStatusSuccess
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= setting.MaxAttempts {
+			delivery.Status = model.TaskCallbackStatusFailed
+		} else {
+			interval := time.Duration(setting.RetryBaseSeconds) * time.Second << (delivery.Attempts - 1)
+			if interval <= 0 || interval > taskCallbackMaxRetryInterval {
+				interval = taskCallbackMaxRetryInterval
+			}
+			delivery.NextAttemptAt = time.Now().Add(interval).Unix()
+		}
+	}
+	if err := delivery.Update(); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update task callback delivery %d: %s", delivery.Id, err.Error()))
+	}
+}
+
+// RetryTaskCallback 将投递记录重新放入队列，立即重试
+func RetryTaskCallback(delivery *model.TaskCallbackDelivery) error {
+	if delivery.Status == model.TaskCallbackStatusSuccess {
+		return errors.New("回调已投递成功")
+	}
+	delivery.Status = model.TaskCallbackStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = common.GetTimestamp()
+	return delivery.Update()
+}
+
+// RunTaskCallbackWorker 定期投递到期的回调
+func RunTaskCallbackWorker() {
+	for {
+		deliveries, err := model.GetDueTaskCallbackDeliveries(taskCallbackBatchSize)
+		if err != nil {
+			common.SysLog("failed to query task callback deliveries: " + err.Error())
+		}
+		// 等待本批投递完成后再查询，避免同一条回调被重复取出
+		sem := make(chan struct{}, taskCallbackWorkers)
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			sem <- struct{}{}
+			gopool.Go(func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				DeliverTaskCallback(delivery)
+			})
+		}
+		wg.Wait()
+		if len(deliveries) < taskCallbackBatchSize {
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
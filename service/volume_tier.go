@@ -0,0 +1,79 @@
+package service
+
+import (
+	"yunshuAPI/common"
+	"yunshuAPI/model"
+	relaycommon "yunshuAPI/relay/common"
+	"yunshuAPI/setting/ratio_setting"
+)
+
+// 阶梯计价：按用户本月已消费的额度所在档位对超出部分打折，跨档时分段计费
+
+// ApplyVolumeTier 按阶梯调整本次消费的额度，结果记录在 relayInfo 中用于日志
+func ApplyVolumeTier(relayInfo *relaycommon.RelayInfo, quota int) int {
+	if quota <= 0 {
+		return quota
+	}
+	tiers := ratio_setting.GetVolumeTiers(relayInfo.UserGroup)
+	if len(tiers) == 0 {
+		return quota
+	}
+	used, err := getMonthQuotaSpend(model.SpendSubjectUser, relayInfo.UserId)
+	if err != nil {
+		common.SysLog("failed to get user month spend: " + err.Error())
+		return quota
+	}
+	// 本月计数器在记录消费时同步更新，预扣额度已计入，计算档位前扣除本次请求的预扣额度
+	used -= int64(relayInfo.FinalPreConsumedQuota)
+	if used < 0 {
+		used = 0
+	}
+	charged := ratio_setting.ApplyVolumeTiers(tiers, used, quota)
+	relayInfo.VolumeTier = &relaycommon.VolumeTierInfo{
+		PeriodUsed:    used,
+		Tier:          ratio_setting.VolumeTierIndex(tiers, used+int64(charged)),
+		OriginalQuota: quota,
+	}
+	return charged
+}
+
+// VolumeTierProgress 用户本月的阶梯计价进度
+type VolumeTierProgress struct {
+	Tiers       []ratio_setting.VolumeTier `json:"tiers"`
+	PeriodStart int64                      `json:"period_start"`
+	PeriodEnd   int64                      `json:"period_end"`
+	Used        int64                      `json:"used"`
+	Tier        int                        `json:"tier"`
+	Ratio       float64                    `json:"ratio"`
+	// 距离下一档还需消费的额度，已是最高档时为 0
+	NextTierRemaining int64   `json:"next_tier_remaining"`
+	NextTierRatio     float64 `json:"next_tier_ratio"`
+}
+
+// GetVolumeTierProgress 返回用户本月的阶梯进度，未启用阶梯计价时返回 nil
+func GetVolumeTierProgress(userId int, userGroup string) (*VolumeTierProgress, error) {
+	tiers := ratio_setting.GetVolumeTiers(userGroup)
+	if len(tiers) == 0 {
+		return nil, nil
+	}
+	used, start, end, err := model.GetMonthQuotaSpend(model.SpendSubjectUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	progress := &VolumeTierProgress{
+		Tiers:       tiers,
+		PeriodStart: start.Unix(),
+		PeriodEnd:   end.Unix(),
+		Used:        used,
+		Tier:        ratio_setting.VolumeTierIndex(tiers, used),
+		Ratio:       1,
+	}
+	if progress.Tier >= 0 {
+		progress.Ratio = tiers[progress.Tier].Ratio
+	}
+	if next := progress.Tier + 1; next < len(tiers) {
+		progress.NextTierRemaining = int64(tiers[next].From*common.QuotaPerUnit) - used
+		progress.NextTierRatio = tiers[next].Ratio
+	}
+	return progress, nil
+}
@@ -0,0 +1,36 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+// ArtifactSetting 任务产物转存设置：任务成功后把视频、图片下载到网关存储，
+// 并把结果地址改写为带签名的网关地址，避免上游地址过期后无法访问
+type ArtifactSetting struct {
+	// 是否转存成功任务的视频、图片
+	Enabled bool `json:"enabled"`
+	// 转存文件保留天数，到期后签名地址失效并删除文件，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+	// 单个转存文件最大体积（MB），超出时保留上游地址
+	MaxSizeMB int `json:"max_size_mb"`
+	// 下载上游结果的超时时间（秒）
+	DownloadTimeoutSeconds int `json:"download_timeout_seconds"`
+	// /api/file/upload 上传文件的保留小时数
+	UploadRetentionHours int `json:"upload_retention_hours"`
+}
+
+// 默认配置
+var artifactSetting = ArtifactSetting{
+	Enabled:                false,
+	RetentionDays:          7,
+	MaxSizeMB:              512,
+	DownloadTimeoutSeconds: 300,
+	UploadRetentionHours:   24,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("artifact_setting", &artifactSetting)
+}
+
+func GetArtifactSetting() *ArtifactSetting {
+	return &artifactSetting
+}
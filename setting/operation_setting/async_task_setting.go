@@ -0,0 +1,27 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+// AsyncTaskSetting 同步接口背后的异步任务设置：上游只支持异步任务的渠道（速创图片、Kie.ai 视频）
+// 在提交后写入任务表，由后台任务轮询更新状态，同步接口最多等待 MaxWaitSeconds 秒
+type AsyncTaskSetting struct {
+	// 同步接口等待任务完成的最长秒数，超时后返回任务对象，0 表示提交后直接返回任务对象
+	MaxWaitSeconds int `json:"max_wait_seconds"`
+	// 等待期间检查任务状态的间隔（秒）
+	CheckIntervalSeconds int `json:"check_interval_seconds"`
+}
+
+// 默认配置
+var asyncTaskSetting = AsyncTaskSetting{
+	MaxWaitSeconds:       120,
+	CheckIntervalSeconds: 2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("async_task_setting", &asyncTaskSetting)
+}
+
+func GetAsyncTaskSetting() *AsyncTaskSetting {
+	return &asyncTaskSetting
+}
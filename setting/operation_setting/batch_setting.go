@@ -0,0 +1,30 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// 同时执行的批处理数量
+	MaxConcurrentBatches int `json:"max_concurrent_batches"`
+	// 单个批处理内并发执行的请求数
+	WorkersPerBatch int `json:"workers_per_batch"`
+	// 单个批处理允许的最大请求行数
+	MaxRequestsPerBatch int `json:"max_requests_per_batch"`
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Enabled:              true,
+	MaxConcurrentBatches: 2,
+	WorkersPerBatch:      4,
+	MaxRequestsPerBatch:  50000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
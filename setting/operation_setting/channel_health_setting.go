@@ -0,0 +1,42 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type ChannelHealthSetting struct {
+	Enabled bool `json:"enabled"`
+	// 统计窗口（秒），健康分按窗口内的成功率计算
+	WindowSeconds int `json:"window_seconds"`
+	// 窗口内请求数达到该值后才会评估熔断
+	MinRequests int `json:"min_requests"`
+	// 窗口内错误率达到该值时熔断（0-1）
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// 熔断持续时间（秒），到期后进入半开状态
+	OpenSeconds int `json:"open_seconds"`
+	// 半开状态下允许同时放行的探测请求数
+	HalfOpenMaxRequests int `json:"half_open_max_requests"`
+	// 半开状态下连续成功多少次后恢复
+	HalfOpenSuccessThreshold int `json:"half_open_success_threshold"`
+	// 健康分对权重的最低折算比例，避免降级渠道完全没有流量
+	MinWeightFactor float64 `json:"min_weight_factor"`
+}
+
+// 默认配置
+var channelHealthSetting = ChannelHealthSetting{
+	Enabled:                  true,
+	WindowSeconds:            60,
+	MinRequests:              10,
+	ErrorRateThreshold:       0.5,
+	OpenSeconds:              30,
+	HalfOpenMaxRequests:      1,
+	HalfOpenSuccessThreshold: 2,
+	MinWeightFactor:          0.05,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_health_setting", &channelHealthSetting)
+}
+
+func GetChannelHealthSetting() *ChannelHealthSetting {
+	return &channelHealthSetting
+}
@@ -0,0 +1,36 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type ChannelRecoverySetting struct {
+	Enabled bool `json:"enabled"`
+	// 扫描自动禁用渠道和 key 的间隔（秒）
+	ScanIntervalSeconds int `json:"scan_interval_seconds"`
+	// 禁用后首次探测的等待时间（秒）
+	InitialIntervalSeconds int `json:"initial_interval_seconds"`
+	// 探测失败后等待时间按该倍数增长
+	BackoffMultiplier float64 `json:"backoff_multiplier"`
+	// 探测间隔上限（秒）
+	MaxIntervalSeconds int `json:"max_interval_seconds"`
+	// 探测记录保留天数
+	HistoryRetentionDays int `json:"history_retention_days"`
+}
+
+// 默认配置
+var channelRecoverySetting = ChannelRecoverySetting{
+	Enabled:                false,
+	ScanIntervalSeconds:    30,
+	InitialIntervalSeconds: 60,
+	BackoffMultiplier:      2,
+	MaxIntervalSeconds:     3600,
+	HistoryRetentionDays:   7,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_recovery_setting", &channelRecoverySetting)
+}
+
+func GetChannelRecoverySetting() *ChannelRecoverySetting {
+	return &channelRecoverySetting
+}
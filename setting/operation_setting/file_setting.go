@@ -0,0 +1,43 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type FileSetting struct {
+	// 单个文件最大体积（MB）
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// 存储单价（美元/GB），上传时一次性扣费，0 表示不收费
+	StoragePricePerGB float64 `json:"storage_price_per_gb"`
+	// 文件保留天数，0 表示永久保留
+	ExpireDays int `json:"expire_days"`
+	// 请求中以 file_id 引用文件时允许内联的最大体积（MB）
+	InlineMaxSizeMB int `json:"inline_max_size_mb"`
+	// 允许上传的 purpose
+	AllowedPurposes []string `json:"allowed_purposes"`
+}
+
+// 默认配置
+var fileSetting = FileSetting{
+	MaxFileSizeMB:     512,
+	StoragePricePerGB: 0,
+	ExpireDays:        30,
+	InlineMaxSizeMB:   32,
+	AllowedPurposes:   []string{"assistants", "batch", "fine-tune", "vision", "user_data", "evals"},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
+
+func (s *FileSetting) IsPurposeAllowed(purpose string) bool {
+	for _, p := range s.AllowedPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// 首个渠道超过该时间未返回时，向第二个渠道发起对冲请求（毫秒）
+	DelayMs int `json:"delay_ms"`
+	// 启用对冲的模型，为空表示所有模型
+	Models []string `json:"models"`
+}
+
+// 默认配置
+var hedgeSetting = HedgeSetting{
+	Enabled: false,
+	DelayMs: 2000,
+	Models:  []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// ShouldHedge 判断模型是否启用对冲请求
+func (s *HedgeSetting) ShouldHedge(model string) bool {
+	if !s.Enabled || s.DelayMs <= 0 {
+		return false
+	}
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type LogRetentionSetting struct {
+	Enabled bool `json:"enabled"`
+	// 各类型日志的保留天数，0 表示永久保留
+	ConsumeDays int `json:"consume_days"`
+	ErrorDays   int `json:"error_days"`
+	SystemDays  int `json:"system_days"`
+	TopupDays   int `json:"topup_days"`
+	ManageDays  int `json:"manage_days"`
+	RefundDays  int `json:"refund_days"`
+	// 删除前是否先归档为 gzip 压缩的 JSONL 文件
+	ArchiveEnabled bool `json:"archive_enabled"`
+	// 归档文件目录
+	ArchiveDir string `json:"archive_dir"`
+	// 每天执行清理的时刻（0-23，服务器时区）
+	RunHour int `json:"run_hour"`
+}
+
+// 默认配置
+var logRetentionSetting = LogRetentionSetting{
+	Enabled:        false,
+	ConsumeDays:    90,
+	ErrorDays:      30,
+	SystemDays:     30,
+	TopupDays:      0,
+	ManageDays:     0,
+	RefundDays:     0,
+	ArchiveEnabled: true,
+	ArchiveDir:     "./data/log_archive",
+	RunHour:        3,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_retention_setting", &logRetentionSetting)
+}
+
+func GetLogRetentionSetting() *LogRetentionSetting {
+	return &logRetentionSetting
+}
@@ -0,0 +1,43 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type ModelFallbackSetting struct {
+	Enabled bool `json:"enabled"`
+	// 模型降级链，key 为请求的模型，value 为依次尝试的备用模型
+	Chains map[string][]string `json:"chains"`
+	// 分组级别的降级链，优先于 Chains，key 为分组名
+	GroupChains map[string]map[string][]string `json:"group_chains"`
+	// 客户端通过该请求头（值为 true）关闭本次请求的模型降级
+	DisableHeader string `json:"disable_header"`
+}
+
+// 默认配置
+var modelFallbackSetting = ModelFallbackSetting{
+	Enabled:       false,
+	Chains:        map[string][]string{},
+	GroupChains:   map[string]map[string][]string{},
+	DisableHeader: "X-Disable-Model-Fallback",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback_setting", &modelFallbackSetting)
+}
+
+func GetModelFallbackSetting() *ModelFallbackSetting {
+	return &modelFallbackSetting
+}
+
+// GetFallbackChain 返回分组下模型的降级链，分组未配置时使用全局配置
+func (s *ModelFallbackSetting) GetFallbackChain(group string, model string) []string {
+	if !s.Enabled {
+		return nil
+	}
+	if chains, ok := s.GroupChains[group]; ok {
+		if chain, ok := chains[model]; ok {
+			return chain
+		}
+	}
+	return s.Chains[model]
+}
@@ -0,0 +1,47 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+// ModelRateLimit 单个模型的限流配置，0 表示不限制
+type ModelRateLimit struct {
+	RPM         int `json:"rpm"`         // 每分钟请求数
+	TPM         int `json:"tpm"`         // 每分钟 token 数
+	Concurrency int `json:"concurrency"` // 最大并发请求数
+}
+
+func (l ModelRateLimit) Enabled() bool {
+	return l.RPM > 0 || l.TPM > 0 || l.Concurrency > 0
+}
+
+type ModelRateLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// 模型名 -> 限流配置，按分组和模型计数，所有令牌共享，"*" 表示未单独配置的模型
+	Models map[string]ModelRateLimit `json:"models"`
+}
+
+// 默认配置
+var modelRateLimitSetting = ModelRateLimitSetting{
+	Enabled: false,
+	Models:  map[string]ModelRateLimit{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_rate_limit_setting", &modelRateLimitSetting)
+}
+
+func GetModelRateLimitSetting() *ModelRateLimitSetting {
+	return &modelRateLimitSetting
+}
+
+// GetModelRateLimit 返回模型的限流配置
+func (s *ModelRateLimitSetting) GetModelRateLimit(model string) (ModelRateLimit, bool) {
+	if !s.Enabled {
+		return ModelRateLimit{}, false
+	}
+	limit, ok := s.Models[model]
+	if !ok {
+		limit, ok = s.Models["*"]
+	}
+	return limit, ok && limit.Enabled()
+}
@@ -0,0 +1,69 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"yunshuAPI/setting/config"
+)
+
+type PayloadCaptureSetting struct {
+	Enabled bool `json:"enabled"`
+	// 需要抓取的令牌、用户和渠道，命中任意一项即抓取
+	TokenIds   []int `json:"token_ids"`
+	UserIds    []int `json:"user_ids"`
+	ChannelIds []int `json:"channel_ids"`
+	// 每段内容最多保存的大小（KB），超出部分截断；MySQL 的 text 字段最多 64KB，为 0 或超过上限时按上限处理
+	MaxBodySizeKB int `json:"max_body_size_kb"`
+	// 抓取内容的保留时间（小时）
+	TTLHours int `json:"ttl_hours"`
+	// 额外需要脱敏的字段名（不区分大小写），在内置的密钥类字段之外生效
+	RedactKeys []string `json:"redact_keys"`
+	// 需要脱敏的 JSON 路径，以 . 分隔，* 匹配任意数组下标或字段，例如 messages.*.content
+	RedactPaths []string `json:"redact_paths"`
+}
+
+// payloadCaptureMaxBodySizeKB 每段内容的大小上限，给脱敏后的内容留出余量，保证能写入 MySQL 的 text 字段
+const payloadCaptureMaxBodySizeKB = 60
+
+// 默认配置
+var payloadCaptureSetting = PayloadCaptureSetting{
+	Enabled:       false,
+	TokenIds:      []int{},
+	UserIds:       []int{},
+	ChannelIds:    []int{},
+	MaxBodySizeKB: payloadCaptureMaxBodySizeKB,
+	TTLHours:      72,
+	RedactKeys:    []string{},
+	RedactPaths:   []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payload_capture_setting", &payloadCaptureSetting)
+}
+
+func GetPayloadCaptureSetting() *PayloadCaptureSetting {
+	return &payloadCaptureSetting
+}
+
+// HasTargets 是否配置了任何抓取对象
+func (s *PayloadCaptureSetting) HasTargets() bool {
+	return len(s.TokenIds) > 0 || len(s.UserIds) > 0 || len(s.ChannelIds) > 0
+}
+
+// Matches 判断请求是否需要抓取，channelId 为 0 表示尚未选择渠道
+func (s *PayloadCaptureSetting) Matches(tokenId, userId, channelId int) bool {
+	if !s.Enabled {
+		return false
+	}
+	return slices.Contains(s.TokenIds, tokenId) || slices.Contains(s.UserIds, userId) ||
+		(channelId != 0 && slices.Contains(s.ChannelIds, channelId))
+}
+
+// MaxBodySize 返回每段内容最多保存的字节数
+func (s *PayloadCaptureSetting) MaxBodySize() int {
+	if s.MaxBodySizeKB <= 0 || s.MaxBodySizeKB > payloadCaptureMaxBodySizeKB {
+		return payloadCaptureMaxBodySizeKB << 10
+	}
+	return s.MaxBodySizeKB << 10
+}
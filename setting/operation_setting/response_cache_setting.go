@@ -0,0 +1,72 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+const (
+	ResponseCacheModeExact    = "exact"
+	ResponseCacheModeSemantic = "semantic"
+)
+
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// exact：请求完全一致才命中；semantic：在精确匹配的基础上按消息的向量相似度匹配
+	Mode string `json:"mode"`
+	// 缓存有效期（秒）
+	TTLSeconds int `json:"ttl_seconds"`
+	// 启用缓存的模型，为空表示所有模型
+	Models []string `json:"models"`
+	// 仅缓存 temperature=0 的请求
+	OnlyZeroTemperature bool `json:"only_zero_temperature"`
+	// 是否在不同用户之间共享缓存，关闭时缓存按用户隔离
+	ShareAcrossUsers bool `json:"share_across_users"`
+	// 单条缓存的最大响应大小（KB）
+	MaxResponseSizeKB int `json:"max_response_size_kb"`
+	// 内存缓存的最大条目数
+	MaxMemoryEntries int `json:"max_memory_entries"`
+	// semantic 模式使用的向量模型，从用户分组下的渠道中选择
+	EmbeddingModel string `json:"embedding_model"`
+	// semantic 模式的余弦相似度阈值
+	SimilarityThreshold float64 `json:"similarity_threshold"`
+	// semantic 模式下每个缓存范围保留的最大向量数
+	MaxSemanticCandidates int `json:"max_semantic_candidates"`
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:               false,
+	Mode:                  ResponseCacheModeExact,
+	TTLSeconds:            3600,
+	Models:                []string{},
+	OnlyZeroTemperature:   true,
+	ShareAcrossUsers:      false,
+	MaxResponseSizeKB:     512,
+	MaxMemoryEntries:      10000,
+	EmbeddingModel:        "text-embedding-3-small",
+	SimilarityThreshold:   0.97,
+	MaxSemanticCandidates: 1000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsModelEnabled 判断模型是否启用响应缓存
+func (s *ResponseCacheSetting) IsModelEnabled(model string) bool {
+	if !s.Enabled {
+		return false
+	}
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+// 渠道路由策略
+const (
+	RoutingStrategyWeightedRandom = "weighted_random"
+	RoutingStrategyLowestLatency  = "lowest_latency"
+	RoutingStrategyLeastInFlight  = "least_in_flight"
+	RoutingStrategyLowestCost     = "lowest_cost"
+)
+
+type RoutingSetting struct {
+	// 默认策略
+	DefaultStrategy string `json:"default_strategy"`
+	// 按分组指定策略，group -> strategy
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// 按模型指定策略，优先级高于分组，model -> strategy
+	ModelStrategies map[string]string `json:"model_strategies"`
+	// 延迟统计的平滑系数（0-1），越大越偏向最近的请求
+	LatencyEWMAAlpha float64 `json:"latency_ewma_alpha"`
+	// 策略筛选后保留得分最好的渠道数，再按权重随机选择，1 表示只用最优渠道
+	TopK int `json:"top_k"`
+}
+
+// 默认配置
+var routingSetting = RoutingSetting{
+	DefaultStrategy:  RoutingStrategyWeightedRandom,
+	GroupStrategies:  map[string]string{},
+	ModelStrategies:  map[string]string{},
+	LatencyEWMAAlpha: 0.2,
+	TopK:             3,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("routing_setting", &routingSetting)
+}
+
+func GetRoutingSetting() *RoutingSetting {
+	return &routingSetting
+}
+
+// GetRoutingStrategy 返回指定分组和模型使用的路由策略，模型配置优先于分组配置
+func GetRoutingStrategy(group string, model string) string {
+	if strategy, ok := routingSetting.ModelStrategies[model]; ok && strategy != "" {
+		return strategy
+	}
+	if strategy, ok := routingSetting.GroupStrategies[group]; ok && strategy != "" {
+		return strategy
+	}
+	if routingSetting.DefaultStrategy == "" {
+		return RoutingStrategyWeightedRandom
+	}
+	return routingSetting.DefaultStrategy
+}
@@ -0,0 +1,55 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type SessionAffinitySetting struct {
+	Enabled bool `json:"enabled"`
+	// 会话绑定的渠道保留时间（秒），每次命中后续期
+	TTLSeconds int `json:"ttl_seconds"`
+	// 从该请求头读取会话标识，优先级最高
+	Header string `json:"header"`
+	// 使用请求体中的 user 字段（Claude 为 metadata.user_id）作为会话标识
+	UseUserField bool `json:"use_user_field"`
+	// 没有会话标识时，使用 system 和前几条消息的哈希作为会话标识
+	UsePrefixHash bool `json:"use_prefix_hash"`
+	// 计算前缀哈希使用的消息条数
+	PrefixMessages int `json:"prefix_messages"`
+	// 启用会话绑定的模型，为空表示所有模型
+	Models []string `json:"models"`
+}
+
+// 默认配置
+var sessionAffinitySetting = SessionAffinitySetting{
+	Enabled:        false,
+	TTLSeconds:     3600,
+	Header:         "X-Session-Id",
+	UseUserField:   true,
+	UsePrefixHash:  true,
+	PrefixMessages: 2,
+	Models:         []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("session_affinity_setting", &sessionAffinitySetting)
+}
+
+func GetSessionAffinitySetting() *SessionAffinitySetting {
+	return &sessionAffinitySetting
+}
+
+// IsModelEnabled 判断模型是否启用会话绑定
+func (s *SessionAffinitySetting) IsModelEnabled(model string) bool {
+	if !s.Enabled {
+		return false
+	}
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
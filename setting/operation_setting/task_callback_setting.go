@@ -0,0 +1,31 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+type TaskCallbackSetting struct {
+	// 是否允许异步任务在完成时回调客户端
+	Enabled bool `json:"enabled"`
+	// 最多投递次数（含首次），全部失败后不再重试
+	MaxAttempts int `json:"max_attempts"`
+	// 首次重试的间隔（秒），之后每次翻倍，最长 1 小时
+	RetryBaseSeconds int `json:"retry_base_seconds"`
+	// 单次投递的超时时间（秒）
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// 默认配置
+var taskCallbackSetting = TaskCallbackSetting{
+	Enabled:          true,
+	MaxAttempts:      6,
+	RetryBaseSeconds: 30,
+	TimeoutSeconds:   10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_callback_setting", &taskCallbackSetting)
+}
+
+func GetTaskCallbackSetting() *TaskCallbackSetting {
+	return &taskCallbackSetting
+}
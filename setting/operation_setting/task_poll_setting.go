@@ -0,0 +1,56 @@
+package operation_setting
+
+import "yunshuAPI/setting/config"
+
+// TaskPollSetting 异步任务轮询设置：按平台和渠道并发查询上游，任务越久查询间隔越长，超过最长时间的任务判为失败并退款
+type TaskPollSetting struct {
+	// 全部平台同时查询上游的最大请求数
+	Concurrency int `json:"concurrency"`
+	// 单个渠道同时查询上游的最大请求数
+	ChannelConcurrency int `json:"channel_concurrency"`
+	// 每轮从数据库取出的到期任务数
+	BatchSize int `json:"batch_size"`
+	// 新任务的查询间隔（秒），也是调度的最小周期
+	MinIntervalSeconds int `json:"min_interval_seconds"`
+	// 长时间运行任务的最大查询间隔（秒）
+	MaxIntervalSeconds int `json:"max_interval_seconds"`
+	// 查询间隔占任务已运行时间的百分比，例如 10 表示运行 10 分钟的任务每 1 分钟查询一次
+	BackoffPercent int `json:"backoff_percent"`
+	// 任务最长运行时间（分钟），超过后判为失败并退款，0 表示不限制
+	MaxAgeMinutes int `json:"max_age_minutes"`
+	// 按平台覆盖最长运行时间，键为任务平台（如 suno 或渠道类型编号）
+	PlatformMaxAgeMinutes map[string]int `json:"platform_max_age_minutes"`
+}
+
+// 默认配置
+var taskPollSetting = TaskPollSetting{
+	Concurrency:           32,
+	ChannelConcurrency:    8,
+	BatchSize:             1000,
+	MinIntervalSeconds:    5,
+	MaxIntervalSeconds:    120,
+	BackoffPercent:        10,
+	MaxAgeMinutes:         1440,
+	PlatformMaxAgeMinutes: map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_poll_setting", &taskPollSetting)
+}
+
+func GetTaskPollSetting() *TaskPollSetting {
+	return &taskPollSetting
+}
+
+// GetMaxAgeSeconds 平台任务的最长运行时间（秒），0 表示不限制
+func (s *TaskPollSetting) GetMaxAgeSeconds(platform string) int64 {
+	minutes := s.MaxAgeMinutes
+	if v, ok := s.PlatformMaxAgeMinutes[platform]; ok {
+		minutes = v
+	}
+	if minutes <= 0 {
+		return 0
+	}
+	return int64(minutes) * 60
+}
@@ -0,0 +1,24 @@
+package ratio_setting
+
+import "yunshuAPI/setting/config"
+
+type BatchRatioSetting struct {
+	// 批处理请求的计费折扣，按分组倍率相乘，例如 0.5 表示五折
+	BatchDiscount float64 `json:"batch_discount"`
+}
+
+var batchRatioSetting = BatchRatioSetting{
+	BatchDiscount: 0.5,
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_ratio_setting", &batchRatioSetting)
+}
+
+func GetBatchDiscount() float64 {
+	discount := batchRatioSetting.BatchDiscount
+	if discount <= 0 || discount > 1 {
+		return 1
+	}
+	return discount
+}
@@ -0,0 +1,212 @@
+package ratio_setting
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"yunshuAPI/setting/config"
+)
+
+// RatioSchedule 按时段或日期生效的倍率调整，例如夜间折扣、限时促销
+type RatioSchedule struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// 每天生效的时间段（HH:MM），结束时间不晚于开始时间表示跨天，如 22:00-06:00；都为空表示全天
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// 生效的星期（0 为周日），为空表示每天；跨天时段按开始时间所在的日期判断
+	Weekdays []int `json:"weekdays"`
+	// 生效的日期范围（YYYY-MM-DD，包含首尾两天），为空表示不限
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	// 生效的分组和模型，为空表示全部；模型支持以 * 结尾的前缀匹配
+	Groups []string `json:"groups"`
+	Models []string `json:"models"`
+	// 在分组倍率、模型倍率（或按次价格）上相乘的系数，0 表示不调整
+	GroupMultiplier float64 `json:"group_multiplier"`
+	ModelMultiplier float64 `json:"model_multiplier"`
+}
+
+type RatioScheduleSetting struct {
+	Enabled bool `json:"enabled"`
+	// 计算时段使用的时区，如 Asia/Shanghai，为空使用服务器时区
+	Timezone  string          `json:"timezone"`
+	Schedules []RatioSchedule `json:"schedules"`
+}
+
+// ActiveRatioSchedule 当前生效的时段倍率，多个时段同时生效时系数相乘
+type ActiveRatioSchedule struct {
+	Names           []string
+	GroupMultiplier float64
+	ModelMultiplier float64
+}
+
+var ratioScheduleSetting = RatioScheduleSetting{
+	Enabled:   false,
+	Timezone:  "",
+	Schedules: []RatioSchedule{},
+}
+
+var (
+	scheduleLocationLock sync.Mutex
+	scheduleLocationName string
+	scheduleLocation     = time.Local
+)
+
+func init() {
+	config.GlobalConfig.Register("ratio_schedule_setting", &ratioScheduleSetting)
+}
+
+func GetRatioScheduleSetting() *RatioScheduleSetting {
+	return &ratioScheduleSetting
+}
+
+func getScheduleLocation() *time.Location {
+	scheduleLocationLock.Lock()
+	defer scheduleLocationLock.Unlock()
+	name := ratioScheduleSetting.Timezone
+	if name != scheduleLocationName {
+		scheduleLocationName = name
+		scheduleLocation = time.Local
+		if name != "" {
+			if loc, err := time.LoadLocation(name); err == nil {
+				scheduleLocation = loc
+			}
+		}
+	}
+	return scheduleLocation
+}
+
+// parseClock 解析 HH:MM，返回当天的分钟数
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+func scheduleMatchesModel(patterns []string, model string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == model {
+			return true
+		}
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(model, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func scheduleMatchesGroup(groups []string, group string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActiveAt 判断时段在指定时间是否生效，now 需已转换到配置的时区
+func (s *RatioSchedule) IsActiveAt(now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	day := now
+	if s.StartTime != "" || s.EndTime != "" {
+		start, ok1 := parseClock(s.StartTime)
+		end, ok2 := parseClock(s.EndTime)
+		if !ok1 || !ok2 {
+			return false
+		}
+		minute := now.Hour()*60 + now.Minute()
+		if start < end {
+			if minute < start || minute >= end {
+				return false
+			}
+		} else {
+			// 跨天时段，凌晨部分属于前一天开始的时段
+			if minute >= end && minute < start {
+				return false
+			}
+			if minute < end {
+				day = now.AddDate(0, 0, -1)
+			}
+		}
+	}
+	if len(s.Weekdays) > 0 {
+		matched := false
+		for _, w := range s.Weekdays {
+			if time.Weekday(w) == day.Weekday() {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	date := day.Format("2006-01-02")
+	if s.StartDate != "" && date < s.StartDate {
+		return false
+	}
+	if s.EndDate != "" && date > s.EndDate {
+		return false
+	}
+	return true
+}
+
+// GetActiveRatioSchedule 返回分组和模型当前生效的时段倍率，没有生效的时段时返回 nil
+func GetActiveRatioSchedule(group string, model string, now time.Time) *ActiveRatioSchedule {
+	if !ratioScheduleSetting.Enabled {
+		return nil
+	}
+	now = now.In(getScheduleLocation())
+	var active *ActiveRatioSchedule
+	for i := range ratioScheduleSetting.Schedules {
+		s := &ratioScheduleSetting.Schedules[i]
+		if !scheduleMatchesGroup(s.Groups, group) || !scheduleMatchesModel(s.Models, model) || !s.IsActiveAt(now) {
+			continue
+		}
+		if active == nil {
+			active = &ActiveRatioSchedule{GroupMultiplier: 1, ModelMultiplier: 1}
+		}
+		active.Names = append(active.Names, s.Name)
+		if s.GroupMultiplier > 0 {
+			active.GroupMultiplier *= s.GroupMultiplier
+		}
+		if s.ModelMultiplier > 0 {
+			active.ModelMultiplier *= s.ModelMultiplier
+		}
+	}
+	return active
+}
+
+// RatioScheduleStatus 用于定价页面展示的时段配置及当前是否生效
+type RatioScheduleStatus struct {
+	RatioSchedule
+	Active bool `json:"active"`
+}
+
+// GetRatioScheduleStatuses 返回所有启用的时段及其当前生效状态
+func GetRatioScheduleStatuses(now time.Time) []RatioScheduleStatus {
+	statuses := make([]RatioScheduleStatus, 0)
+	if !ratioScheduleSetting.Enabled {
+		return statuses
+	}
+	now = now.In(getScheduleLocation())
+	for _, s := range ratioScheduleSetting.Schedules {
+		if !s.Enabled {
+			continue
+		}
+		statuses = append(statuses, RatioScheduleStatus{RatioSchedule: s, Active: s.IsActiveAt(now)})
+	}
+	return statuses
+}
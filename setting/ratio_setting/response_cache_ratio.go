@@ -0,0 +1,24 @@
+package ratio_setting
+
+import "yunshuAPI/setting/config"
+
+type ResponseCacheRatioSetting struct {
+	// 命中响应缓存时的计费倍率，按分组倍率相乘，例如 0.1 表示按一折计费
+	ResponseCacheRatio float64 `json:"response_cache_ratio"`
+}
+
+var responseCacheRatioSetting = ResponseCacheRatioSetting{
+	ResponseCacheRatio: 0.1,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_ratio_setting", &responseCacheRatioSetting)
+}
+
+func GetResponseCacheRatio() float64 {
+	ratio := responseCacheRatioSetting.ResponseCacheRatio
+	if ratio < 0 || ratio > 1 {
+		return 1
+	}
+	return ratio
+}
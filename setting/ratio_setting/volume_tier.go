@@ -0,0 +1,104 @@
+package ratio_setting
+
+import (
+	"sort"
+
+	"yunshuAPI/common"
+	"yunshuAPI/setting/config"
+)
+
+// VolumeTier 阶梯计价的一档，用户当月消费超过 From（美元）后，超出部分按 Ratio 计费
+type VolumeTier struct {
+	From  float64 `json:"from"`
+	Ratio float64 `json:"ratio"`
+}
+
+type VolumeTierSetting struct {
+	Enabled bool `json:"enabled"`
+	// 默认阶梯，例如 [{"from":0,"ratio":1},{"from":100,"ratio":0.9},{"from":1000,"ratio":0.8}]
+	Tiers []VolumeTier `json:"tiers"`
+	// 按用户分组单独设置的阶梯，优先于默认阶梯，设置为空数组表示该分组不参与阶梯计价
+	GroupTiers map[string][]VolumeTier `json:"group_tiers"`
+}
+
+var volumeTierSetting = VolumeTierSetting{
+	Enabled:    false,
+	Tiers:      []VolumeTier{},
+	GroupTiers: map[string][]VolumeTier{},
+}
+
+func init() {
+	config.GlobalConfig.Register("volume_tier_setting", &volumeTierSetting)
+}
+
+func GetVolumeTierSetting() *VolumeTierSetting {
+	return &volumeTierSetting
+}
+
+// GetVolumeTiers 返回用户分组适用的阶梯，按起始金额升序，未启用时返回 nil
+func GetVolumeTiers(userGroup string) []VolumeTier {
+	if !volumeTierSetting.Enabled {
+		return nil
+	}
+	tiers, ok := volumeTierSetting.GroupTiers[userGroup]
+	if !ok {
+		tiers = volumeTierSetting.Tiers
+	}
+	result := make([]VolumeTier, 0, len(tiers))
+	for _, tier := range tiers {
+		if tier.From < 0 || tier.Ratio < 0 {
+			continue
+		}
+		result = append(result, tier)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].From < result[j].From
+	})
+	return result
+}
+
+// VolumeTierIndex 返回消费额（quota）所在的档位，低于第一档时返回 -1
+func VolumeTierIndex(tiers []VolumeTier, used int64) int {
+	index := -1
+	for i, tier := range tiers {
+		if float64(used) >= tier.From*common.QuotaPerUnit {
+			index = i
+		}
+	}
+	return index
+}
+
+// ApplyVolumeTiers 按阶梯计算本次消费，used 为本期已消费的额度，quota 为按原价计算的额度。
+// 跨越档位时分段计费，返回实际计费的额度
+func ApplyVolumeTiers(tiers []VolumeTier, used int64, quota int) int {
+	if len(tiers) == 0 || quota <= 0 {
+		return quota
+	}
+	remaining := float64(quota)
+	charged := 0.0
+	current := float64(used)
+	for remaining > 0 {
+		index := VolumeTierIndex(tiers, int64(current))
+		ratio := 1.0
+		if index >= 0 {
+			ratio = tiers[index].Ratio
+		}
+		// 本档剩余可消费的额度（按实际计费），最后一档不限
+		next := -1.0
+		if index+1 < len(tiers) {
+			next = tiers[index+1].From * common.QuotaPerUnit
+		}
+		if next < 0 || ratio == 0 || (next-current)/ratio >= remaining {
+			charged += remaining * ratio
+			break
+		}
+		segment := (next - current) / ratio
+		charged += segment * ratio
+		remaining -= segment
+		current = next
+	}
+	return int(charged + 0.5)
+}
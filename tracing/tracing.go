@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"yunshuAPI/common"
+	"yunshuAPI/constant"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry 链路追踪，未启用时使用 otel 默认的空实现，各埋点几乎没有开销
+
+const tracerName = "yunshuAPI"
+
+var (
+	provider *sdktrace.TracerProvider
+	enabled  bool
+)
+
+// InitTracing 根据环境变量初始化 OTLP 导出，端点等参数使用 OTEL_EXPORTER_OTLP_* 标准环境变量
+func InitTracing() error {
+	if !constant.OtelEnabled {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return err
+	}
+	SetupWithProcessor(sdktrace.NewBatchSpanProcessor(exporter))
+	common.SysLog("OpenTelemetry tracing enabled")
+	return nil
+}
+
+// SetupWithProcessor 使用指定的 span 处理器启用追踪，测试中可传入
+// sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()) 读取已结束的 span
+func SetupWithProcessor(processor sdktrace.SpanProcessor) {
+	res, _ := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(constant.OtelServiceName),
+		semconv.ServiceVersion(common.Version),
+	))
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(constant.OtelSampleRatio))),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+}
+
+// Shutdown 导出剩余的 span
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+func Enabled() bool {
+	return enabled
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartGinSpan 以请求上下文为父节点开始一个 span，并将其写入 c.Request 以便后续阶段成为子 span。
+// 返回的函数结束 span 并恢复父上下文，可以重复调用
+func StartGinSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) (trace.Span, func()) {
+	if !enabled || c.Request == nil {
+		return trace.SpanFromContext(context.Background()), func() {}
+	}
+	parent := c.Request.Context()
+	ctx, span := Tracer().Start(parent, name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	var once sync.Once
+	return span, func() {
+		once.Do(func() {
+			span.End()
+			if c.Request != nil {
+				c.Request = c.Request.WithContext(parent)
+			}
+		})
+	}
+}
+
+// RecordError 将错误记录到 span 并标记失败
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// InjectHeaders 将当前 span 的 W3C traceparent 写入上游请求头
+func InjectHeaders(ctx context.Context, header http.Header) {
+	if !enabled || !constant.OtelPropagateUpstream {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -82,6 +82,7 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeSpendLimitExceeded         ErrorCode = "spend_limit_exceeded"
 )
 
 type NewAPIError struct {
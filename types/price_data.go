@@ -3,9 +3,15 @@ package types
 import "fmt"
 
 type GroupRatioInfo struct {
-	GroupRatio        float64
-	GroupSpecialRatio float64
-	HasSpecialRatio   bool
+	GroupRatio         float64
+	GroupSpecialRatio  float64
+	HasSpecialRatio    bool
+	BatchDiscount      float64 // 批处理折扣，已计入 GroupRatio
+	ResponseCacheRatio float64 // 响应缓存命中倍率，已计入 GroupRatio
+	// 请求时生效的时段倍率，ScheduleGroupRatio 已计入 GroupRatio，ScheduleModelRatio 已计入模型倍率或价格
+	RatioSchedules     []string
+	ScheduleGroupRatio float64
+	ScheduleModelRatio float64
 }
 
 type PriceData struct {